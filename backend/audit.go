@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// defaultAuditLogPath is where mutations are recorded unless AUDIT_LOG_PATH says otherwise
+const defaultAuditLogPath = "/var/lib/envoy-gateway-extension/audit.jsonl"
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	AuditDenied  = "denied"
+)
+
+// AuditEntry is one line of the audit log
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Endpoint  string    `json:"endpoint"` // "POST /apply-yaml", or what started a background change
+	Context   string    `json:"context,omitempty"`
+	Action    string    `json:"action"` // "apply", "patch", "delete", "kubectl", "proxy" or "request"
+	Kind      string    `json:"kind,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Args      []string  `json:"args,omitempty"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// auditLog appends entries to a JSONL file. Entries are never rewritten or removed by the
+// backend.
+type auditLog struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func newAuditLog() *auditLog {
+	path := os.Getenv("AUDIT_LOG_PATH")
+	if path == "" {
+		path = defaultAuditLogPath
+	}
+	return &auditLog{path: path}
+}
+
+type auditEndpointKey struct{}
+
+// withAuditEndpoint names what a change made under ctx is recorded as coming from
+func withAuditEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, auditEndpointKey{}, endpoint)
+}
+
+func auditEndpointFrom(ctx context.Context) string {
+	endpoint, _ := ctx.Value(auditEndpointKey{}).(string)
+	return endpoint
+}
+
+// auditMiddleware tags each request's context with its endpoint
+func (s *Server) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(withAuditEndpoint(r.Context(), r.Method+" "+r.URL.Path)))
+	})
+}
+
+// record appends entry, filling in the time and endpoint. A failure to write is logged
+// rather than failing the change, which has already happened.
+func (a *auditLog) record(ctx context.Context, entry AuditEntry) {
+	entry.Time = time.Now().UTC()
+	if entry.Endpoint == "" {
+		entry.Endpoint = auditEndpointFrom(ctx)
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to encode audit entry: %v", err)
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if err := os.MkdirAll(filepath.Dir(a.path), 0700); err != nil {
+		log.Printf("Failed to write audit log %s: %v", a.path, err)
+		return
+	}
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Failed to write audit log %s: %v", a.path, err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write audit log %s: %v", a.path, err)
+	}
+}
+
+// auditFilter selects entries for /audit. Empty fields match everything.
+type auditFilter struct {
+	Endpoint  string
+	Context   string
+	Action    string
+	Result    string
+	Namespace string
+	Name      string
+	Since     time.Time
+	Limit     int
+}
+
+func (f auditFilter) matches(entry AuditEntry) bool {
+	return (f.Endpoint == "" || strings.Contains(entry.Endpoint, f.Endpoint)) &&
+		(f.Context == "" || entry.Context == f.Context) &&
+		(f.Action == "" || entry.Action == f.Action) &&
+		(f.Result == "" || entry.Result == f.Result) &&
+		(f.Namespace == "" || entry.Namespace == f.Namespace) &&
+		(f.Name == "" || entry.Name == f.Name) &&
+		!entry.Time.Before(f.Since)
+}
+
+// query returns the newest entries matching filter, newest first
+func (a *auditLog) query(filter auditFilter) ([]AuditEntry, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	file, err := os.Open(a.path)
+	if os.IsNotExist(err) {
+		return []AuditEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var matched []AuditEntry
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var entry AuditEntry
+			if json.Unmarshal(line, &entry) == nil && filter.matches(entry) {
+				matched = append(matched, entry)
+				if len(matched) > filter.Limit {
+					matched = matched[1:]
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make([]AuditEntry, 0, len(matched))
+	for i := len(matched) - 1; i >= 0; i-- {
+		entries = append(entries, matched[i])
+	}
+	return entries, nil
+}
+
+// handleAudit lists audit entries, newest first. Query parameters: endpoint (substring),
+// context, action, result, namespace, name, since (RFC 3339) and limit (default 100).
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := auditFilter{
+		Endpoint:  query.Get("endpoint"),
+		Context:   query.Get("context"),
+		Action:    query.Get("action"),
+		Result:    query.Get("result"),
+		Namespace: query.Get("namespace"),
+		Name:      query.Get("name"),
+		Limit:     100,
+	}
+	if since := query.Get("since"); since != "" {
+		parsed, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			s.sendError(w, fmt.Sprintf("Invalid since %q: expected RFC 3339, e.g. 2024-01-02T15:04:05Z", since), http.StatusBadRequest)
+			return
+		}
+		filter.Since = parsed
+	}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			s.sendError(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = parsed
+	}
+
+	entries, err := s.audit.query(filter)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to read audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+	response := APIResponse{Success: true, Data: entries}
+	s.sendResponse(w, response)
+}
+
+func auditResult(err error) (string, string) {
+	if err != nil {
+		return AuditFailure, err.Error()
+	}
+	return AuditSuccess, ""
+}
+
+// auditedKubeClient records every change made through a KubeClient. Dry runs and reads
+// pass through unrecorded.
+type auditedKubeClient struct {
+	KubeClient
+	audit *auditLog
+}
+
+func (c *auditedKubeClient) Apply(ctx context.Context, manifest string, dryRun bool) ([]*unstructured.Unstructured, error) {
+	applied, err := c.KubeClient.Apply(ctx, manifest, dryRun)
+	if dryRun {
+		return applied, err
+	}
+
+	for _, object := range applied {
+		c.audit.record(ctx, AuditEntry{
+			Context:   c.Target().Context,
+			Action:    "apply",
+			Kind:      object.GetKind(),
+			Namespace: object.GetNamespace(),
+			Name:      object.GetName(),
+			Result:    AuditSuccess,
+		})
+	}
+	if err != nil {
+		// Objects are applied in order, so the failure is the first one not applied
+		entry := AuditEntry{Context: c.Target().Context, Action: "apply", Result: AuditFailure, Error: err.Error()}
+		if objects, decodeErr := decodeManifest(manifest); decodeErr == nil && len(applied) < len(objects) {
+			failed := objects[len(applied)]
+			entry.Kind = failed.GetKind()
+			entry.Namespace = failed.GetNamespace()
+			entry.Name = failed.GetName()
+		}
+		c.audit.record(ctx, entry)
+	}
+	return applied, err
+}
+
+func (c *auditedKubeClient) Delete(ctx context.Context, resource, namespace, name string) error {
+	err := c.KubeClient.Delete(ctx, resource, namespace, name)
+	result, message := auditResult(err)
+	c.audit.record(ctx, AuditEntry{
+		Context:   c.Target().Context,
+		Action:    "delete",
+		Kind:      resource,
+		Namespace: namespace,
+		Name:      name,
+		Result:    result,
+		Error:     message,
+	})
+	return err
+}
+
+func (c *auditedKubeClient) Patch(ctx context.Context, resource, namespace, name string, patchType types.PatchType, patch []byte) (*unstructured.Unstructured, error) {
+	object, err := c.KubeClient.Patch(ctx, resource, namespace, name, patchType, patch)
+	result, message := auditResult(err)
+	c.audit.record(ctx, AuditEntry{
+		Context:   c.Target().Context,
+		Action:    "patch",
+		Kind:      resource,
+		Namespace: namespace,
+		Name:      name,
+		Args:      []string{string(patchType)}, // the patch itself may hold secrets
+		Result:    result,
+		Error:     message,
+	})
+	return object, err
+}
+
+// auditedAPIProxy guards the API proxy started by /start-proxy with the same policy as
+// /kubectl: each request is checked as the kubectl verb and resource it amounts to,
+// confirm verbs need an X-Confirm-Token, and requests that may change the cluster are
+// recorded
+func (s *Server) auditedAPIProxy(proxy http.Handler, kube KubeClient, port int) http.Handler {
+	endpoint := fmt.Sprintf("api-proxy :%d", port)
+	target := kube.Target()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		command := apiProxyCommand(r)
+		entry := AuditEntry{
+			Endpoint: endpoint,
+			Context:  target.Context,
+			Action:   "proxy",
+			Args:     []string{r.Method, r.URL.RequestURI()},
+		}
+		if err := s.policy.checkKubectl(kube, command); err != nil {
+			entry.Result = AuditDenied
+			entry.Error = err.Error()
+			s.audit.record(r.Context(), entry)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		if s.policy.confirmRequired(command) {
+			key := confirmationKey(target.Context, entry.Args)
+			token := r.Header.Get(confirmTokenHeader)
+			if token == "" {
+				issued, _, err := s.confirms.issue(key)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("failed to issue confirmation token: %v", err), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set(confirmTokenHeader, issued)
+				http.Error(w, fmt.Sprintf("%s %s needs confirming: repeat the request with the %s header within %s",
+					r.Method, r.URL.Path, confirmTokenHeader, kubectlConfirmationTTL), http.StatusPreconditionRequired)
+				return
+			}
+			if !s.confirms.redeem(token, key) {
+				http.Error(w, "confirmation token is invalid, expired or was issued for another request", http.StatusPreconditionFailed)
+				return
+			}
+			r.Header.Del(confirmTokenHeader)
+		}
+
+		if !command.mutating() {
+			proxy.ServeHTTP(w, r)
+			return
+		}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		proxy.ServeHTTP(recorder, r)
+		entry.Result = AuditSuccess
+		if recorder.status >= 400 {
+			entry.Result = AuditFailure
+			entry.Error = fmt.Sprintf("%d %s", recorder.status, http.StatusText(recorder.status))
+		}
+		s.audit.record(r.Context(), entry)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+type BackendTLSPolicyFormData struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ServiceName     string `json:"serviceName"`
+	SectionName     string `json:"sectionName,omitempty"` // Service port name, when only one port speaks TLS
+	Hostname        string `json:"hostname"`              // SNI sent to the backend and matched against its certificate
+	UseSystemCA     bool   `json:"useSystemCA,omitempty"`
+	CAConfigMapName string `json:"caConfigMapName,omitempty"`
+	CASecretName    string `json:"caSecretName,omitempty"` // cert-manager Secret to build the CA ConfigMap from
+}
+
+func (s *Server) handleCreateBackendTLSPolicy(w http.ResponseWriter, r *http.Request) {
+	var policyData BackendTLSPolicyFormData
+	if err := json.NewDecoder(r.Body).Decode(&policyData); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if errs := validateBackendTLSPolicyFormData(policyData); len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := kube.Get(r.Context(), "services", policyData.Namespace, policyData.ServiceName); err != nil {
+		log.Printf("BackendTLSPolicy target service %s/%s not found: %v", policyData.Namespace, policyData.ServiceName, err)
+		if !isKubeNotFound(err) {
+			s.sendError(w, err.Error(), kubeErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		s.sendError(w, fmt.Sprintf("Service %s not found in namespace %s", policyData.ServiceName, policyData.Namespace), http.StatusBadRequest)
+		return
+	}
+
+	if policyData.CASecretName != "" {
+		if policyData.CAConfigMapName == "" {
+			policyData.CAConfigMapName = policyData.Name + "-ca"
+		}
+
+		caCert, err := s.readCACertificate(r.Context(), kube, policyData.Namespace, policyData.CASecretName)
+		if err != nil {
+			s.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		configMapYAML, err := s.generateCAConfigMapYAML(policyData.CAConfigMapName, policyData.Namespace, caCert)
+		if err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to generate CA ConfigMap YAML: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if err := s.applyYAML(r.Context(), configMapYAML, "configmap"); err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to apply CA ConfigMap: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+	}
+
+	yamlContent, err := s.generateBackendTLSPolicyYAML(policyData)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to generate BackendTLSPolicy YAML: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, "backendtlspolicy"); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply BackendTLSPolicy: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Data:    fmt.Sprintf("BackendTLSPolicy %s created successfully in namespace %s", policyData.Name, policyData.Namespace),
+	}
+	s.sendResponse(w, response)
+}
+
+func validateBackendTLSPolicyFormData(data BackendTLSPolicyFormData) FieldErrors {
+	var errs FieldErrors
+	validateObjectName(&errs, "name", data.Name)
+	validateDNSLabel(&errs, "namespace", data.Namespace)
+	validateDNSLabel(&errs, "serviceName", data.ServiceName)
+	if data.SectionName != "" {
+		validateDNSLabel(&errs, "sectionName", data.SectionName)
+	}
+	if data.Hostname == "" {
+		errs.add("hostname", "is required")
+	} else {
+		validateHostname(&errs, "hostname", data.Hostname, false)
+	}
+
+	if data.UseSystemCA && (data.CAConfigMapName != "" || data.CASecretName != "") {
+		errs.add("useSystemCA", "cannot be combined with caConfigMapName or caSecretName")
+	}
+	if !data.UseSystemCA && data.CAConfigMapName == "" && data.CASecretName == "" {
+		errs.add("caConfigMapName", "one of useSystemCA, caConfigMapName or caSecretName is required")
+	}
+	if data.CAConfigMapName != "" {
+		validateObjectName(&errs, "caConfigMapName", data.CAConfigMapName)
+	}
+	if data.CASecretName != "" {
+		validateObjectName(&errs, "caSecretName", data.CASecretName)
+	}
+	return errs
+}
+
+// readCACertificate extracts the CA bundle from a cert-manager Secret. CA-issued
+// certificates carry it in ca.crt; self-signed ones only have tls.crt, which is its own CA.
+func (s *Server) readCACertificate(ctx context.Context, kube KubeClient, namespace, secretName string) (string, error) {
+	object, err := kube.Get(ctx, "secrets", namespace, secretName)
+	if err != nil {
+		return "", err
+	}
+
+	var secret struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := decodeInto(object, &secret); err != nil {
+		return "", fmt.Errorf("failed to parse Secret %s/%s: %v", namespace, secretName, err)
+	}
+
+	for _, key := range []string{"ca.crt", "tls.crt"} {
+		encoded, ok := secret.Data[key]
+		if !ok || encoded == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode %s from Secret %s/%s: %v", key, namespace, secretName, err)
+		}
+		return string(decoded), nil
+	}
+	return "", fmt.Errorf("Secret %s/%s has no ca.crt or tls.crt", namespace, secretName)
+}
+
+func (s *Server) generateCAConfigMapYAML(name, namespace, caCert string) (string, error) {
+	configMap := ConfigMapResource{
+		TypeMeta: TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		Metadata: ObjectMeta{Name: name, Namespace: namespace},
+		Data:     map[string]string{"ca.crt": caCert},
+	}
+	return marshalResource(configMap)
+}
+
+func (s *Server) generateBackendTLSPolicyYAML(data BackendTLSPolicyFormData) (string, error) {
+	policy := BackendTLSPolicyResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.networking.k8s.io/v1alpha3", Kind: "BackendTLSPolicy"},
+		Metadata: ObjectMeta{Name: data.Name, Namespace: data.Namespace},
+		Spec: BackendTLSPolicySpec{
+			TargetRefs: []LocalPolicyTargetReference{
+				{Group: "", Kind: "Service", Name: data.ServiceName, SectionName: data.SectionName},
+			},
+			Validation: BackendTLSPolicyValidation{Hostname: data.Hostname},
+		},
+	}
+	if data.UseSystemCA {
+		policy.Spec.Validation.WellKnownCACertificates = "System"
+	} else {
+		policy.Spec.Validation.CACertificateRefs = []LocalObjectReference{
+			{Group: "", Kind: "ConfigMap", Name: data.CAConfigMapName},
+		}
+	}
+	return marshalResource(policy)
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type BackendTrafficPolicyFormData struct {
+	Name           string                  `json:"name"`
+	Namespace      string                  `json:"namespace"`
+	TargetRefs     []PolicyTargetRef       `json:"targetRefs"`
+	Retry          *RetryFormData          `json:"retry,omitempty"`
+	CircuitBreaker *CircuitBreakerFormData `json:"circuitBreaker,omitempty"`
+	HealthCheck    *HealthCheckFormData    `json:"healthCheck,omitempty"`
+	LoadBalancer   *LoadBalancerFormData   `json:"loadBalancer,omitempty"`
+	RateLimit      *LocalRateLimitFormData `json:"rateLimit,omitempty"`
+}
+
+type RetryFormData struct {
+	NumRetries      *int     `json:"numRetries,omitempty"`
+	RetryOn         []string `json:"retryOn,omitempty"` // triggers such as "5xx", "reset" or "connect-failure"
+	HTTPStatusCodes []int    `json:"httpStatusCodes,omitempty"`
+	PerRetryTimeout string   `json:"perRetryTimeout,omitempty"`
+	BackOffBase     string   `json:"backOffBaseInterval,omitempty"`
+	BackOffMax      string   `json:"backOffMaxInterval,omitempty"`
+}
+
+type CircuitBreakerFormData struct {
+	MaxConnections           int `json:"maxConnections,omitempty"`
+	MaxPendingRequests       int `json:"maxPendingRequests,omitempty"`
+	MaxParallelRequests      int `json:"maxParallelRequests,omitempty"`
+	MaxParallelRetries       int `json:"maxParallelRetries,omitempty"`
+	MaxRequestsPerConnection int `json:"maxRequestsPerConnection,omitempty"`
+}
+
+type HealthCheckFormData struct {
+	Active  *ActiveHealthCheckFormData  `json:"active,omitempty"`
+	Passive *PassiveHealthCheckFormData `json:"passive,omitempty"`
+}
+
+type ActiveHealthCheckFormData struct {
+	Type               string `json:"type"` // "HTTP" or "TCP"
+	Timeout            string `json:"timeout,omitempty"`
+	Interval           string `json:"interval,omitempty"`
+	UnhealthyThreshold int    `json:"unhealthyThreshold,omitempty"`
+	HealthyThreshold   int    `json:"healthyThreshold,omitempty"`
+	Path               string `json:"path,omitempty"`
+	Method             string `json:"method,omitempty"`
+	ExpectedStatuses   []int  `json:"expectedStatuses,omitempty"`
+}
+
+type PassiveHealthCheckFormData struct {
+	Consecutive5XxErrors     int    `json:"consecutive5XxErrors,omitempty"`
+	ConsecutiveGatewayErrors int    `json:"consecutiveGatewayErrors,omitempty"`
+	Interval                 string `json:"interval,omitempty"`
+	BaseEjectionTime         string `json:"baseEjectionTime,omitempty"`
+	MaxEjectionPercent       int    `json:"maxEjectionPercent,omitempty"`
+}
+
+type LoadBalancerFormData struct {
+	Type            string `json:"type"`               // "RoundRobin", "LeastRequest", "Random" or "ConsistentHash"
+	HashType        string `json:"hashType,omitempty"` // "SourceIP", "Header" or "Cookie" for ConsistentHash
+	HashHeaderName  string `json:"hashHeaderName,omitempty"`
+	HashCookieName  string `json:"hashCookieName,omitempty"`
+	HashCookieTTL   string `json:"hashCookieTtl,omitempty"`
+	SlowStartWindow string `json:"slowStartWindow,omitempty"`
+}
+
+type LocalRateLimitFormData struct {
+	Rules []LocalRateLimitRuleFormData `json:"rules"`
+}
+
+type LocalRateLimitRuleFormData struct {
+	Requests int                            `json:"requests"`
+	Unit     string                         `json:"unit"` // "Second", "Minute", "Hour" or "Day"
+	Headers  []HTTPRouteHeaderMatchFormData `json:"headers,omitempty"`
+}
+
+var retryTriggers = map[string]bool{
+	"5xx": true, "gateway-error": true, "reset": true, "connect-failure": true,
+	"retriable-4xx": true, "refused-stream": true, "retriable-status-codes": true,
+	"cancelled": true, "deadline-exceeded": true, "internal": true,
+	"resource-exhausted": true, "unavailable": true,
+}
+
+func (s *Server) handleCreateBackendTrafficPolicy(w http.ResponseWriter, r *http.Request) {
+	var policyData BackendTrafficPolicyFormData
+	if err := json.NewDecoder(r.Body).Decode(&policyData); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if errs := validateBackendTrafficPolicyFormData(policyData); len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+
+	if err := s.validatePolicyTargets(r.Context(), policyData.Namespace, policyData.TargetRefs); err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	yamlContent, err := s.generateBackendTrafficPolicyYAML(policyData)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to generate BackendTrafficPolicy YAML: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, "backendtrafficpolicy"); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply BackendTrafficPolicy: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Data:    fmt.Sprintf("BackendTrafficPolicy %s created successfully in namespace %s", policyData.Name, policyData.Namespace),
+	}
+	s.sendResponse(w, response)
+}
+
+func validateBackendTrafficPolicyFormData(data BackendTrafficPolicyFormData) FieldErrors {
+	var errs FieldErrors
+	validateObjectName(&errs, "name", data.Name)
+	validateDNSLabel(&errs, "namespace", data.Namespace)
+	validatePolicyTargetRefs(&errs, data.TargetRefs, policyTargetKinds)
+
+	if retry := data.Retry; retry != nil {
+		if retry.NumRetries != nil && *retry.NumRetries < 0 {
+			errs.add("retry.numRetries", "must not be negative")
+		}
+		for i, trigger := range retry.RetryOn {
+			if !retryTriggers[trigger] {
+				errs.add(fmt.Sprintf("retry.retryOn[%d]", i), "unsupported trigger %q", trigger)
+			}
+		}
+		for i, code := range retry.HTTPStatusCodes {
+			if code < 100 || code > 599 {
+				errs.add(fmt.Sprintf("retry.httpStatusCodes[%d]", i), "%d is not a valid HTTP status code", code)
+			}
+		}
+		validateGatewayDuration(&errs, "retry.perRetryTimeout", retry.PerRetryTimeout)
+		validateGatewayDuration(&errs, "retry.backOffBaseInterval", retry.BackOffBase)
+		validateGatewayDuration(&errs, "retry.backOffMaxInterval", retry.BackOffMax)
+	}
+
+	if cb := data.CircuitBreaker; cb != nil {
+		validateNonNegative(&errs, "circuitBreaker.maxConnections", cb.MaxConnections)
+		validateNonNegative(&errs, "circuitBreaker.maxPendingRequests", cb.MaxPendingRequests)
+		validateNonNegative(&errs, "circuitBreaker.maxParallelRequests", cb.MaxParallelRequests)
+		validateNonNegative(&errs, "circuitBreaker.maxParallelRetries", cb.MaxParallelRetries)
+		validateNonNegative(&errs, "circuitBreaker.maxRequestsPerConnection", cb.MaxRequestsPerConnection)
+	}
+
+	if data.HealthCheck != nil {
+		if active := data.HealthCheck.Active; active != nil {
+			switch active.Type {
+			case "HTTP":
+				if !strings.HasPrefix(active.Path, "/") {
+					errs.add("healthCheck.active.path", "is required for HTTP health checks and must start with '/'")
+				}
+				if active.Method != "" && !httpMethods[active.Method] {
+					errs.add("healthCheck.active.method", "%q is not a supported HTTP method", active.Method)
+				}
+				for i, status := range active.ExpectedStatuses {
+					if status < 100 || status > 599 {
+						errs.add(fmt.Sprintf("healthCheck.active.expectedStatuses[%d]", i), "%d is not a valid HTTP status code", status)
+					}
+				}
+			case "TCP":
+			default:
+				errs.add("healthCheck.active.type", "must be HTTP or TCP")
+			}
+			validateGatewayDuration(&errs, "healthCheck.active.timeout", active.Timeout)
+			validateGatewayDuration(&errs, "healthCheck.active.interval", active.Interval)
+			validateNonNegative(&errs, "healthCheck.active.unhealthyThreshold", active.UnhealthyThreshold)
+			validateNonNegative(&errs, "healthCheck.active.healthyThreshold", active.HealthyThreshold)
+		}
+		if passive := data.HealthCheck.Passive; passive != nil {
+			validateNonNegative(&errs, "healthCheck.passive.consecutive5XxErrors", passive.Consecutive5XxErrors)
+			validateNonNegative(&errs, "healthCheck.passive.consecutiveGatewayErrors", passive.ConsecutiveGatewayErrors)
+			validateGatewayDuration(&errs, "healthCheck.passive.interval", passive.Interval)
+			validateGatewayDuration(&errs, "healthCheck.passive.baseEjectionTime", passive.BaseEjectionTime)
+			if passive.MaxEjectionPercent < 0 || passive.MaxEjectionPercent > 100 {
+				errs.add("healthCheck.passive.maxEjectionPercent", "must be between 0 and 100")
+			}
+		}
+	}
+
+	if lb := data.LoadBalancer; lb != nil {
+		switch lb.Type {
+		case "RoundRobin", "LeastRequest", "Random":
+		case "ConsistentHash":
+			switch lb.HashType {
+			case "SourceIP":
+			case "Header":
+				if !headerNamePattern.MatchString(lb.HashHeaderName) {
+					errs.add("loadBalancer.hashHeaderName", "a valid header name is required for Header hashing")
+				}
+			case "Cookie":
+				if lb.HashCookieName == "" {
+					errs.add("loadBalancer.hashCookieName", "is required for Cookie hashing")
+				}
+			default:
+				errs.add("loadBalancer.hashType", "must be SourceIP, Header or Cookie")
+			}
+		default:
+			errs.add("loadBalancer.type", "must be RoundRobin, LeastRequest, Random or ConsistentHash")
+		}
+		validateGatewayDuration(&errs, "loadBalancer.hashCookieTtl", lb.HashCookieTTL)
+		validateGatewayDuration(&errs, "loadBalancer.slowStartWindow", lb.SlowStartWindow)
+		if lb.SlowStartWindow != "" && (lb.Type == "Random" || lb.Type == "ConsistentHash") {
+			errs.add("loadBalancer.slowStartWindow", "is only supported by the RoundRobin and LeastRequest load balancers")
+		}
+	}
+
+	if data.RateLimit != nil {
+		if len(data.RateLimit.Rules) == 0 {
+			errs.add("rateLimit.rules", "at least one rule is required")
+		}
+		for i, rule := range data.RateLimit.Rules {
+			field := fmt.Sprintf("rateLimit.rules[%d]", i)
+			if rule.Requests <= 0 {
+				errs.add(field+".requests", "must be greater than 0")
+			}
+			switch rule.Unit {
+			case "Second", "Minute", "Hour", "Day":
+			default:
+				errs.add(field+".unit", "must be Second, Minute, Hour or Day")
+			}
+			for j, header := range rule.Headers {
+				headerField := fmt.Sprintf("%s.headers[%d]", field, j)
+				switch header.Type {
+				case "", "Exact", "Distinct":
+				case "RegularExpression":
+					validateRegex(&errs, headerField+".value", header.Value)
+				default:
+					errs.add(headerField+".type", "must be Exact, RegularExpression or Distinct")
+				}
+				if !headerNamePattern.MatchString(header.Name) {
+					errs.add(headerField+".name", "%q is not a valid header name", header.Name)
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+func (s *Server) generateBackendTrafficPolicyYAML(data BackendTrafficPolicyFormData) (string, error) {
+	policy := BackendTrafficPolicyResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.envoyproxy.io/v1alpha1", Kind: "BackendTrafficPolicy"},
+		Metadata: ObjectMeta{Name: data.Name, Namespace: data.Namespace},
+		Spec: BackendTrafficPolicySpec{
+			TargetRefs: convertPolicyTargetRefs(data.TargetRefs),
+		},
+	}
+
+	if data.Retry != nil {
+		policy.Spec.Retry = convertRetry(*data.Retry)
+	}
+	if data.CircuitBreaker != nil {
+		policy.Spec.CircuitBreaker = convertCircuitBreaker(*data.CircuitBreaker)
+	}
+	if data.HealthCheck != nil {
+		policy.Spec.HealthCheck = convertHealthCheck(*data.HealthCheck)
+	}
+	if data.LoadBalancer != nil {
+		policy.Spec.LoadBalancer = convertLoadBalancer(*data.LoadBalancer)
+	}
+	if data.RateLimit != nil {
+		policy.Spec.RateLimit = convertLocalRateLimit(*data.RateLimit)
+	}
+
+	return marshalResource(policy)
+}
+
+func convertRetry(retry RetryFormData) *Retry {
+	result := &Retry{NumRetries: retry.NumRetries}
+
+	if len(retry.RetryOn) > 0 || len(retry.HTTPStatusCodes) > 0 {
+		result.RetryOn = &RetryOn{
+			Triggers:        retry.RetryOn,
+			HTTPStatusCodes: retry.HTTPStatusCodes,
+		}
+	}
+
+	if retry.PerRetryTimeout != "" || retry.BackOffBase != "" || retry.BackOffMax != "" {
+		result.PerRetry = &PerRetryPolicy{Timeout: retry.PerRetryTimeout}
+		if retry.BackOffBase != "" || retry.BackOffMax != "" {
+			result.PerRetry.BackOff = &BackOffPolicy{
+				BaseInterval: retry.BackOffBase,
+				MaxInterval:  retry.BackOffMax,
+			}
+		}
+	}
+
+	return result
+}
+
+func convertCircuitBreaker(cb CircuitBreakerFormData) *CircuitBreaker {
+	return &CircuitBreaker{
+		MaxConnections:           cb.MaxConnections,
+		MaxPendingRequests:       cb.MaxPendingRequests,
+		MaxParallelRequests:      cb.MaxParallelRequests,
+		MaxParallelRetries:       cb.MaxParallelRetries,
+		MaxRequestsPerConnection: cb.MaxRequestsPerConnection,
+	}
+}
+
+func convertHealthCheck(hc HealthCheckFormData) *HealthCheck {
+	result := &HealthCheck{}
+
+	if active := hc.Active; active != nil {
+		result.Active = &ActiveHealthCheck{
+			Type:               active.Type,
+			Timeout:            active.Timeout,
+			Interval:           active.Interval,
+			UnhealthyThreshold: active.UnhealthyThreshold,
+			HealthyThreshold:   active.HealthyThreshold,
+		}
+		if active.Type == "HTTP" {
+			result.Active.HTTP = &HTTPActiveHealthChecker{
+				Path:             active.Path,
+				Method:           active.Method,
+				ExpectedStatuses: active.ExpectedStatuses,
+			}
+		}
+	}
+
+	if passive := hc.Passive; passive != nil {
+		result.Passive = &PassiveHealthCheck{
+			Consecutive5XxErrors:     passive.Consecutive5XxErrors,
+			ConsecutiveGatewayErrors: passive.ConsecutiveGatewayErrors,
+			Interval:                 passive.Interval,
+			BaseEjectionTime:         passive.BaseEjectionTime,
+			MaxEjectionPercent:       passive.MaxEjectionPercent,
+		}
+	}
+
+	return result
+}
+
+func convertLoadBalancer(lb LoadBalancerFormData) *LoadBalancer {
+	result := &LoadBalancer{Type: lb.Type}
+
+	if lb.Type == "ConsistentHash" {
+		result.ConsistentHash = &ConsistentHash{Type: lb.HashType}
+		switch lb.HashType {
+		case "Header":
+			result.ConsistentHash.Header = &HeaderHash{Name: lb.HashHeaderName}
+		case "Cookie":
+			result.ConsistentHash.Cookie = &CookieHash{Name: lb.HashCookieName, TTL: lb.HashCookieTTL}
+		}
+	}
+
+	// Slow start is only supported by the RoundRobin and LeastRequest balancers
+	if lb.SlowStartWindow != "" && (lb.Type == "RoundRobin" || lb.Type == "LeastRequest") {
+		result.SlowStart = &SlowStart{Window: lb.SlowStartWindow}
+	}
+
+	return result
+}
+
+func convertLocalRateLimit(rateLimit LocalRateLimitFormData) *RateLimit {
+	rules := make([]RateLimitRule, len(rateLimit.Rules))
+	for i, rule := range rateLimit.Rules {
+		rules[i] = RateLimitRule{
+			Limit: RateLimitValue{Requests: rule.Requests, Unit: rule.Unit},
+		}
+		if len(rule.Headers) > 0 {
+			headers := make([]HTTPHeaderMatch, len(rule.Headers))
+			for j, header := range rule.Headers {
+				headers[j] = HTTPHeaderMatch{Type: header.Type, Name: header.Name, Value: header.Value}
+			}
+			rules[i].ClientSelectors = []RateLimitSelectCondition{{Headers: headers}}
+		}
+	}
+
+	return &RateLimit{
+		Type:  "Local",
+		Local: &LocalRateLimit{Rules: rules},
+	}
+}
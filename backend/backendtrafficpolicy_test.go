@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestValidateBackendTrafficPolicySlowStart(t *testing.T) {
+	tests := []struct {
+		loadBalancer LoadBalancerFormData
+		want         []string
+	}{
+		{LoadBalancerFormData{Type: "RoundRobin", SlowStartWindow: "30s"}, nil},
+		{LoadBalancerFormData{Type: "LeastRequest", SlowStartWindow: "30s"}, nil},
+		{LoadBalancerFormData{Type: "Random", SlowStartWindow: "30s"}, []string{"loadBalancer.slowStartWindow"}},
+		{LoadBalancerFormData{Type: "ConsistentHash", HashType: "SourceIP", SlowStartWindow: "30s"}, []string{"loadBalancer.slowStartWindow"}},
+		{LoadBalancerFormData{Type: "ConsistentHash", HashType: "SourceIP"}, nil},
+		{LoadBalancerFormData{Type: "RoundRobin", SlowStartWindow: "30 seconds"}, []string{"loadBalancer.slowStartWindow"}},
+	}
+	for _, test := range tests {
+		loadBalancer := test.loadBalancer
+		data := BackendTrafficPolicyFormData{
+			Name:         "lb",
+			Namespace:    "default",
+			TargetRefs:   []PolicyTargetRef{{Kind: "HTTPRoute", Name: "web"}},
+			LoadBalancer: &loadBalancer,
+		}
+		checkFieldErrors(t, loadBalancer.Type+" "+loadBalancer.SlowStartWindow, validateBackendTrafficPolicyFormData(data), test.want)
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// canarySettleTime gives Envoy time to pick up new weights before traffic is measured
+const canarySettleTime = 3 * time.Second
+
+var defaultCanarySteps = []int{5, 25, 50, 100}
+
+type CanaryRolloutRequest struct {
+	RouteName string            `json:"routeName"`
+	Namespace string            `json:"namespace"`
+	RuleIndex int               `json:"ruleIndex"`
+	Stable    BackendRef        `json:"stable"`
+	Canary    BackendRef        `json:"canary"`
+	Steps     []int             `json:"steps,omitempty"` // canary weight in percent at each step, ending at 100
+	Traffic   TrafficTestConfig `json:"traffic"`         // duration applies to each step, default 30 seconds
+	Gates     CanaryGates       `json:"gates"`
+}
+
+type CanaryGates struct {
+	MaxErrorRate    float64 `json:"maxErrorRate"`              // percent of failed requests
+	MaxAvgLatencyMs float64 `json:"maxAvgLatencyMs,omitempty"` // 0 disables the latency gate
+	MinRequests     int     `json:"minRequests,omitempty"`     // below this a step is inconclusive and fails
+}
+
+type CanaryStatus struct {
+	RouteName    string             `json:"routeName"`
+	Namespace    string             `json:"namespace"`
+	Phase        string             `json:"phase"` // "Running", "Succeeded", "RolledBack", "Aborted" or "Failed"
+	Message      string             `json:"message,omitempty"`
+	CurrentStep  int                `json:"currentStep"`
+	CanaryWeight int                `json:"canaryWeight"`
+	Steps        []CanaryStepResult `json:"steps"`
+	StartedAt    time.Time          `json:"startedAt"`
+	FinishedAt   *time.Time         `json:"finishedAt,omitempty"`
+}
+
+type CanaryStepResult struct {
+	Weight          int     `json:"weight"`
+	TotalRequests   int     `json:"totalRequests"`
+	ErrorRate       float64 `json:"errorRate"`
+	AvgResponseTime float64 `json:"avgResponseTime"`
+	Passed          bool    `json:"passed"`
+	Reason          string  `json:"reason,omitempty"`
+}
+
+type CanaryRollout struct {
+	request CanaryRolloutRequest
+	// originalBackendRefs is the rule's backendRefs before the rollout, restored on rollback
+	originalBackendRefs []interface{}
+	// kube stays pinned to the cluster the rollout was started against
+	kube      KubeClient
+	abortChan chan struct{}
+	status    CanaryStatus
+	mutex     sync.RWMutex
+}
+
+func (s *Server) handleStartCanary(w http.ResponseWriter, r *http.Request) {
+	var req CanaryRolloutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Steps) == 0 {
+		req.Steps = defaultCanarySteps
+	}
+	if req.Traffic.Duration <= 0 {
+		req.Traffic.Duration = 30
+	}
+	if err := validateCanaryRolloutRequest(req); err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mutex.Lock()
+	if s.canary != nil && s.canary.phase() == "Running" {
+		s.mutex.Unlock()
+		s.sendError(w, "A canary rollout is already running", http.StatusConflict)
+		return
+	}
+	s.mutex.Unlock()
+
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	original, err := s.getRuleBackendRefs(r.Context(), req.Namespace, req.RouteName, req.RuleIndex)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hasStable := false
+	for i, ref := range original {
+		name, _ := ref.(map[string]interface{})["name"].(string)
+		if name != req.Stable.Name && name != req.Canary.Name {
+			s.sendError(w, fmt.Sprintf("rules[%d].backendRefs[%d]: %s is neither the stable nor the canary backend", req.RuleIndex, i, name), http.StatusBadRequest)
+			return
+		}
+		hasStable = hasStable || name == req.Stable.Name
+	}
+	if !hasStable {
+		s.sendError(w, fmt.Sprintf("rules[%d] of HTTPRoute %s does not route to the stable backend %s", req.RuleIndex, req.RouteName, req.Stable.Name), http.StatusBadRequest)
+		return
+	}
+
+	rollout := &CanaryRollout{
+		request:             req,
+		originalBackendRefs: original,
+		kube:                kube,
+		abortChan:           make(chan struct{}),
+		status: CanaryStatus{
+			RouteName: req.RouteName,
+			Namespace: req.Namespace,
+			Phase:     "Running",
+			Steps:     []CanaryStepResult{},
+			StartedAt: time.Now(),
+		},
+	}
+
+	s.mutex.Lock()
+	if s.canary != nil && s.canary.phase() == "Running" {
+		s.mutex.Unlock()
+		s.sendError(w, "A canary rollout is already running", http.StatusConflict)
+		return
+	}
+	s.canary = rollout
+	s.mutex.Unlock()
+
+	go s.runCanary(rollout)
+
+	response := APIResponse{
+		Success: true,
+		Data:    fmt.Sprintf("Canary rollout of %s started on HTTPRoute %s/%s", req.Canary.Name, req.Namespace, req.RouteName),
+	}
+	s.sendResponse(w, response)
+}
+
+func (s *Server) handleCanaryStatus(w http.ResponseWriter, r *http.Request) {
+	s.mutex.RLock()
+	rollout := s.canary
+	s.mutex.RUnlock()
+
+	if rollout == nil {
+		s.sendError(w, "No canary rollout has been started", http.StatusNotFound)
+		return
+	}
+
+	rollout.mutex.RLock()
+	status := rollout.status
+	status.Steps = append([]CanaryStepResult(nil), rollout.status.Steps...)
+	rollout.mutex.RUnlock()
+
+	response := APIResponse{Success: true, Data: status}
+	s.sendResponse(w, response)
+}
+
+func (s *Server) handleAbortCanary(w http.ResponseWriter, r *http.Request) {
+	s.mutex.RLock()
+	rollout := s.canary
+	s.mutex.RUnlock()
+
+	if rollout == nil || rollout.phase() != "Running" {
+		s.sendError(w, "No canary rollout is currently running", http.StatusBadRequest)
+		return
+	}
+
+	rollout.abort()
+
+	response := APIResponse{
+		Success: true,
+		Data:    "Canary rollout aborted; restoring the original backend weights",
+	}
+	s.sendResponse(w, response)
+}
+
+func validateCanaryRolloutRequest(req CanaryRolloutRequest) error {
+	if req.RouteName == "" || req.Namespace == "" {
+		return fmt.Errorf("routeName and namespace are required")
+	}
+	if req.RuleIndex < 0 {
+		return fmt.Errorf("ruleIndex must not be negative")
+	}
+	if req.Stable.Name == "" || req.Canary.Name == "" || req.Stable.Name == req.Canary.Name {
+		return fmt.Errorf("stable and canary must name two different backends")
+	}
+	if req.Canary.Port < 1 || req.Canary.Port > 65535 {
+		return fmt.Errorf("canary.port must be between 1 and 65535")
+	}
+	if req.Traffic.TargetURL == "" {
+		return fmt.Errorf("traffic.targetUrl is required")
+	}
+	if req.Gates.MaxErrorRate < 0 || req.Gates.MaxErrorRate > 100 {
+		return fmt.Errorf("gates.maxErrorRate must be between 0 and 100")
+	}
+
+	previous := 0
+	for i, weight := range req.Steps {
+		if weight <= previous || weight > 100 {
+			return fmt.Errorf("steps[%d]: weights must increase and stay within 1-100", i)
+		}
+		previous = weight
+	}
+	if previous != 100 {
+		return fmt.Errorf("the last step must move the canary to 100")
+	}
+	return nil
+}
+
+func (rollout *CanaryRollout) phase() string {
+	rollout.mutex.RLock()
+	defer rollout.mutex.RUnlock()
+	return rollout.status.Phase
+}
+
+func (rollout *CanaryRollout) abort() {
+	rollout.mutex.Lock()
+	defer rollout.mutex.Unlock()
+	select {
+	case <-rollout.abortChan:
+	default:
+		close(rollout.abortChan)
+	}
+}
+
+func (rollout *CanaryRollout) finish(phase, message string) {
+	rollout.mutex.Lock()
+	defer rollout.mutex.Unlock()
+	now := time.Now()
+	rollout.status.Phase = phase
+	rollout.status.Message = message
+	rollout.status.FinishedAt = &now
+	log.Printf("Canary rollout on HTTPRoute %s/%s finished: %s %s", rollout.status.Namespace, rollout.status.RouteName, phase, message)
+}
+
+// runCanary walks the rollout through its steps. Any failed gate, error or abort puts the
+// rule's original backendRefs back.
+func (s *Server) runCanary(rollout *CanaryRollout) {
+	req := rollout.request
+
+	for i, weight := range req.Steps {
+		rollout.mutex.Lock()
+		rollout.status.CurrentStep = i
+		rollout.mutex.Unlock()
+
+		if err := s.setCanaryWeight(rollout, weight); err != nil {
+			s.rollbackCanary(rollout, "Failed", fmt.Sprintf("step %d: %v", i, err))
+			return
+		}
+
+		select {
+		case <-time.After(canarySettleTime):
+		case <-rollout.abortChan:
+			s.rollbackCanary(rollout, "Aborted", fmt.Sprintf("aborted at step %d", i))
+			return
+		}
+
+		// The rollout takes over the shared traffic generator for the length of the step
+		test, err := s.startTrafficTest(req.Traffic, rollout.kube, rollout)
+		if err != nil {
+			s.rollbackCanary(rollout, "Failed", fmt.Sprintf("step %d: %v", i, err))
+			return
+		}
+		select {
+		case <-test.done:
+		case <-rollout.abortChan:
+			test.stop()
+			<-test.done
+			s.rollbackCanary(rollout, "Aborted", fmt.Sprintf("aborted at step %d", i))
+			return
+		}
+
+		// Gate on this step's own test, whatever else has been started since
+		test.mutex.RLock()
+		metrics := test.calculateMetrics()
+		test.mutex.RUnlock()
+
+		result := evaluateCanaryGates(req.Gates, weight, metrics)
+		rollout.mutex.Lock()
+		rollout.status.Steps = append(rollout.status.Steps, result)
+		rollout.mutex.Unlock()
+
+		if !result.Passed {
+			s.rollbackCanary(rollout, "RolledBack", fmt.Sprintf("step %d (%d%%) failed: %s", i, weight, result.Reason))
+			return
+		}
+	}
+
+	rollout.finish("Succeeded", fmt.Sprintf("%s now receives all traffic", req.Canary.Name))
+}
+
+func evaluateCanaryGates(gates CanaryGates, weight int, metrics TrafficMetrics) CanaryStepResult {
+	result := CanaryStepResult{
+		Weight:          weight,
+		TotalRequests:   metrics.TotalRequests,
+		ErrorRate:       metrics.ErrorRate,
+		AvgResponseTime: metrics.AvgResponseTime,
+		Passed:          true,
+	}
+
+	minRequests := gates.MinRequests
+	if minRequests <= 0 {
+		minRequests = 1
+	}
+	switch {
+	case metrics.TotalRequests < minRequests:
+		result.Passed = false
+		result.Reason = fmt.Sprintf("only %d requests completed, need at least %d", metrics.TotalRequests, minRequests)
+	case metrics.ErrorRate > gates.MaxErrorRate:
+		result.Passed = false
+		result.Reason = fmt.Sprintf("error rate %.2f%% exceeds %.2f%%", metrics.ErrorRate, gates.MaxErrorRate)
+	case gates.MaxAvgLatencyMs > 0 && metrics.AvgResponseTime > gates.MaxAvgLatencyMs:
+		result.Passed = false
+		result.Reason = fmt.Sprintf("average latency %.1fms exceeds %.1fms", metrics.AvgResponseTime, gates.MaxAvgLatencyMs)
+	}
+	return result
+}
+
+func (s *Server) rollbackCanary(rollout *CanaryRollout, phase, message string) {
+	req := rollout.request
+	if err := s.patchRuleBackendRefs(rollout.kube, req.Namespace, req.RouteName, req.RuleIndex, rollout.originalBackendRefs); err != nil {
+		rollout.finish("Failed", fmt.Sprintf("%s; rollback failed: %v", message, err))
+		return
+	}
+	rollout.mutex.Lock()
+	rollout.status.CanaryWeight = 0
+	rollout.mutex.Unlock()
+	rollout.finish(phase, message)
+}
+
+// setCanaryWeight splits the rule between the stable and canary backends, adding the
+// canary backendRef the first time
+func (s *Server) setCanaryWeight(rollout *CanaryRollout, weight int) error {
+	req := rollout.request
+	backendRefs := []interface{}{}
+	hasCanary := false
+	for _, ref := range rollout.originalBackendRefs {
+		updated := map[string]interface{}{}
+		for key, value := range ref.(map[string]interface{}) {
+			updated[key] = value
+		}
+		switch updated["name"] {
+		case req.Stable.Name:
+			updated["weight"] = 100 - weight
+		case req.Canary.Name:
+			updated["weight"] = weight
+			hasCanary = true
+		}
+		backendRefs = append(backendRefs, updated)
+	}
+	if !hasCanary {
+		backendRefs = append(backendRefs, map[string]interface{}{
+			"name":   req.Canary.Name,
+			"port":   req.Canary.Port,
+			"weight": weight,
+		})
+	}
+
+	if err := s.patchRuleBackendRefs(rollout.kube, req.Namespace, req.RouteName, req.RuleIndex, backendRefs); err != nil {
+		return err
+	}
+
+	rollout.mutex.Lock()
+	rollout.status.CanaryWeight = weight
+	rollout.mutex.Unlock()
+	return nil
+}
+
+func (s *Server) getRuleBackendRefs(ctx context.Context, namespace, routeName string, ruleIndex int) ([]interface{}, error) {
+	kube, err := s.kubeClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	object, err := kube.Get(ctx, "httproutes.gateway.networking.k8s.io", namespace, routeName)
+	if err != nil {
+		return nil, err
+	}
+
+	var route struct {
+		Spec struct {
+			Rules []struct {
+				BackendRefs []interface{} `json:"backendRefs"`
+			} `json:"rules"`
+		} `json:"spec"`
+	}
+	if err := decodeInto(object, &route); err != nil {
+		return nil, fmt.Errorf("failed to parse HTTPRoute %s/%s: %v", namespace, routeName, err)
+	}
+	if ruleIndex >= len(route.Spec.Rules) {
+		return nil, fmt.Errorf("HTTPRoute %s/%s has no rule %d", namespace, routeName, ruleIndex)
+	}
+	return route.Spec.Rules[ruleIndex].BackendRefs, nil
+}
+
+// patchRuleBackendRefs replaces the backendRefs of a single rule, leaving the rest of the
+// route untouched
+func (s *Server) patchRuleBackendRefs(kube KubeClient, namespace, routeName string, ruleIndex int, backendRefs []interface{}) error {
+	patch, err := json.Marshal([]map[string]interface{}{
+		{
+			"op":    "replace",
+			"path":  fmt.Sprintf("/spec/rules/%d/backendRefs", ruleIndex),
+			"value": backendRefs,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Steps and rollbacks run after /start-canary has answered, so they are audited under it
+	ctx := withAuditEndpoint(context.Background(), "POST /start-canary")
+	_, err = kube.Patch(ctx, "httproutes.gateway.networking.k8s.io", namespace, routeName, types.JSONPatchType, patch)
+	return err
+}
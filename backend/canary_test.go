@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestEvaluateCanaryGates(t *testing.T) {
+	gates := CanaryGates{MaxErrorRate: 1, MaxAvgLatencyMs: 200, MinRequests: 50}
+	tests := []struct {
+		name    string
+		gates   CanaryGates
+		metrics TrafficMetrics
+		passed  bool
+		reason  string
+	}{
+		{"passes", gates, TrafficMetrics{TotalRequests: 100, ErrorRate: 0.5, AvgResponseTime: 120}, true, ""},
+		{"too few requests", gates, TrafficMetrics{TotalRequests: 10}, false, "only 10 requests"},
+		{"error rate", gates, TrafficMetrics{TotalRequests: 100, ErrorRate: 2, AvgResponseTime: 300}, false, "error rate 2.00%"},
+		{"latency", gates, TrafficMetrics{TotalRequests: 100, AvgResponseTime: 300}, false, "average latency 300.0ms"},
+		{"latency gate disabled", CanaryGates{MaxErrorRate: 1}, TrafficMetrics{TotalRequests: 1, AvgResponseTime: 5000}, true, ""},
+		{"no requests at all", CanaryGates{MaxErrorRate: 100}, TrafficMetrics{}, false, "need at least 1"},
+	}
+	for _, test := range tests {
+		result := evaluateCanaryGates(test.gates, 25, test.metrics)
+		if result.Passed != test.passed || !strings.Contains(result.Reason, test.reason) {
+			t.Errorf("%s: got %+v, want passed=%v with reason containing %q", test.name, result, test.passed, test.reason)
+		}
+		if result.Weight != 25 || result.TotalRequests != test.metrics.TotalRequests {
+			t.Errorf("%s: result %+v does not carry the step's weight and metrics", test.name, result)
+		}
+	}
+}
+
+// patchedBackendRefs decodes the backendRefs of a JSON patch sent by patchRuleBackendRefs
+func patchedBackendRefs(t *testing.T, patch string) (string, []interface{}) {
+	t.Helper()
+	var operations []struct {
+		Path  string        `json:"path"`
+		Value []interface{} `json:"value"`
+	}
+	if err := json.Unmarshal([]byte(patch), &operations); err != nil || len(operations) != 1 {
+		t.Fatalf("patch %s: %v", patch, err)
+	}
+	return operations[0].Path, operations[0].Value
+}
+
+func TestSetCanaryWeight(t *testing.T) {
+	route := &unstructured.Unstructured{}
+	route.SetAPIVersion("gateway.networking.k8s.io/v1")
+	route.SetKind("HTTPRoute")
+	route.SetNamespace("default")
+	route.SetName("web")
+	kube := newFakeKubeClient(route)
+	s := newTestServer(t, kube)
+	rollout := &CanaryRollout{
+		request: CanaryRolloutRequest{
+			Namespace: "default",
+			RouteName: "web",
+			RuleIndex: 1,
+			Stable:    BackendRef{Name: "web-v1", Port: 8080},
+			Canary:    BackendRef{Name: "web-v2", Port: 8080},
+		},
+		originalBackendRefs: []interface{}{
+			map[string]interface{}{"name": "web-v1", "port": 8080.0},
+			map[string]interface{}{"name": "metrics", "port": 9090.0, "weight": 0.0},
+		},
+		kube: kube,
+	}
+
+	if err := s.setCanaryWeight(rollout, 25); err != nil {
+		t.Fatal(err)
+	}
+	path, backendRefs := patchedBackendRefs(t, kube.patched[0])
+	want := []interface{}{
+		map[string]interface{}{"name": "web-v1", "port": 8080.0, "weight": 75.0},
+		map[string]interface{}{"name": "metrics", "port": 9090.0, "weight": 0.0},
+		map[string]interface{}{"name": "web-v2", "port": 8080.0, "weight": 25.0},
+	}
+	if path != "/spec/rules/1/backendRefs" || !reflect.DeepEqual(backendRefs, want) {
+		t.Errorf("patched %s = %v, want %v", path, backendRefs, want)
+	}
+	if rollout.status.CanaryWeight != 25 {
+		t.Errorf("canaryWeight = %d, want 25", rollout.status.CanaryWeight)
+	}
+	if _, ok := rollout.originalBackendRefs[0].(map[string]interface{})["weight"]; ok {
+		t.Error("setCanaryWeight modified the original backendRefs")
+	}
+
+	// A canary already in the rule is reweighted rather than added again
+	rollout.originalBackendRefs = want
+	if err := s.setCanaryWeight(rollout, 100); err != nil {
+		t.Fatal(err)
+	}
+	_, backendRefs = patchedBackendRefs(t, kube.patched[1])
+	if len(backendRefs) != 3 {
+		t.Fatalf("backendRefs = %v, want the three existing refs", backendRefs)
+	}
+	for i, weight := range []float64{0, 0, 100} {
+		if got := backendRefs[i].(map[string]interface{})["weight"]; got != weight {
+			t.Errorf("backendRefs[%d].weight = %v, want %v", i, got, weight)
+		}
+	}
+
+	kube.errs["patch"] = errors.New("boom")
+	if err := s.setCanaryWeight(rollout, 50); err == nil || rollout.status.CanaryWeight != 100 {
+		t.Errorf("failed patch: err = %v, canaryWeight = %d; want an error and the weight unchanged", err, rollout.status.CanaryWeight)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type ClientTrafficPolicyFormData struct {
+	Name              string                     `json:"name"`
+	Namespace         string                     `json:"namespace"`
+	TargetRefs        []PolicyTargetRef          `json:"targetRefs"` // Gateways, optionally narrowed to a listener with sectionName
+	HTTP2             *ClientHTTP2FormData       `json:"http2,omitempty"`
+	EnableHTTP3       bool                       `json:"enableHttp3,omitempty"`
+	TCPKeepalive      *TCPKeepaliveFormData      `json:"tcpKeepalive,omitempty"`
+	TLS               *ClientTLSFormData         `json:"tls,omitempty"`
+	ClientIPDetection *ClientIPDetectionFormData `json:"clientIPDetection,omitempty"`
+	Connection        *ClientConnectionFormData  `json:"connection,omitempty"`
+	Path              *PathSettingsFormData      `json:"path,omitempty"`
+}
+
+type ClientHTTP2FormData struct {
+	Disabled             bool `json:"disabled,omitempty"` // restricts ALPN to http/1.1
+	MaxConcurrentStreams int  `json:"maxConcurrentStreams,omitempty"`
+}
+
+type TCPKeepaliveFormData struct {
+	Probes   int    `json:"probes,omitempty"`
+	IdleTime string `json:"idleTime,omitempty"`
+	Interval string `json:"interval,omitempty"`
+}
+
+type ClientTLSFormData struct {
+	MinVersion string   `json:"minVersion,omitempty"` // "Auto", "1.0", "1.1", "1.2" or "1.3"
+	MaxVersion string   `json:"maxVersion,omitempty"`
+	Ciphers    []string `json:"ciphers,omitempty"`
+}
+
+type ClientIPDetectionFormData struct {
+	XFFNumTrustedHops   int  `json:"xffNumTrustedHops,omitempty"`
+	EnableProxyProtocol bool `json:"enableProxyProtocol,omitempty"`
+}
+
+type ClientConnectionFormData struct {
+	ConnectionLimit int    `json:"connectionLimit,omitempty"`
+	CloseDelay      string `json:"closeDelay,omitempty"`
+	BufferLimit     string `json:"bufferLimit,omitempty"` // quantity such as "32Ki"
+}
+
+type PathSettingsFormData struct {
+	EscapedSlashesAction string `json:"escapedSlashesAction,omitempty"` // "KeepUnchanged", "RejectRequest", "UnescapeAndForward" or "UnescapeAndRedirect"
+	DisableMergeSlashes  bool   `json:"disableMergeSlashes,omitempty"`
+}
+
+var tlsVersions = map[string]int{"Auto": 0, "1.0": 10, "1.1": 11, "1.2": 12, "1.3": 13}
+
+func (s *Server) handleCreateClientTrafficPolicy(w http.ResponseWriter, r *http.Request) {
+	var policyData ClientTrafficPolicyFormData
+	if err := json.NewDecoder(r.Body).Decode(&policyData); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if errs := validateClientTrafficPolicyFormData(policyData); len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+
+	if err := s.validateClientTrafficPolicyTargets(r.Context(), policyData); err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	yamlContent, err := s.generateClientTrafficPolicyYAML(policyData)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to generate ClientTrafficPolicy YAML: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, "clienttrafficpolicy"); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply ClientTrafficPolicy: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Data:    fmt.Sprintf("ClientTrafficPolicy %s created successfully in namespace %s", policyData.Name, policyData.Namespace),
+	}
+	s.sendResponse(w, response)
+}
+
+func validateClientTrafficPolicyFormData(data ClientTrafficPolicyFormData) FieldErrors {
+	var errs FieldErrors
+	validateObjectName(&errs, "name", data.Name)
+	validateDNSLabel(&errs, "namespace", data.Namespace)
+	// ClientTrafficPolicy configures listeners, so it can only target a Gateway
+	validatePolicyTargetRefs(&errs, data.TargetRefs, []string{"Gateway"})
+
+	if data.HTTP2 != nil {
+		validateNonNegative(&errs, "http2.maxConcurrentStreams", data.HTTP2.MaxConcurrentStreams)
+	}
+
+	if data.TCPKeepalive != nil {
+		validateNonNegative(&errs, "tcpKeepalive.probes", data.TCPKeepalive.Probes)
+		validateGatewayDuration(&errs, "tcpKeepalive.idleTime", data.TCPKeepalive.IdleTime)
+		validateGatewayDuration(&errs, "tcpKeepalive.interval", data.TCPKeepalive.Interval)
+	}
+
+	if data.TLS != nil {
+		minVersion, minOK := tlsVersions[data.TLS.MinVersion]
+		maxVersion, maxOK := tlsVersions[data.TLS.MaxVersion]
+		if data.TLS.MinVersion != "" && !minOK {
+			errs.add("tls.minVersion", "must be Auto, 1.0, 1.1, 1.2 or 1.3")
+		}
+		if data.TLS.MaxVersion != "" && !maxOK {
+			errs.add("tls.maxVersion", "must be Auto, 1.0, 1.1, 1.2 or 1.3")
+		}
+		if minVersion > 0 && maxVersion > 0 && minVersion > maxVersion {
+			errs.add("tls.minVersion", "must not be greater than maxVersion (%s > %s)", data.TLS.MinVersion, data.TLS.MaxVersion)
+		}
+	}
+
+	if data.ClientIPDetection != nil {
+		validateNonNegative(&errs, "clientIPDetection.xffNumTrustedHops", data.ClientIPDetection.XFFNumTrustedHops)
+	}
+
+	if data.Connection != nil {
+		validateNonNegative(&errs, "connection.connectionLimit", data.Connection.ConnectionLimit)
+		validateGatewayDuration(&errs, "connection.closeDelay", data.Connection.CloseDelay)
+	}
+
+	if data.Path != nil {
+		switch data.Path.EscapedSlashesAction {
+		case "", "KeepUnchanged", "RejectRequest", "UnescapeAndForward", "UnescapeAndRedirect":
+		default:
+			errs.add("path.escapedSlashesAction", "must be KeepUnchanged, RejectRequest, UnescapeAndForward or UnescapeAndRedirect")
+		}
+	}
+
+	return errs
+}
+
+// validateClientTrafficPolicyTargets checks that each target Gateway exists and, when a
+// sectionName is given, that the Gateway has a listener with that name
+func (s *Server) validateClientTrafficPolicyTargets(ctx context.Context, data ClientTrafficPolicyFormData) error {
+	for i, ref := range data.TargetRefs {
+		listeners, err := s.getGatewayListeners(ctx, data.Namespace, ref.Name)
+		if err != nil {
+			return fmt.Errorf("targetRefs[%d]: %v", i, err)
+		}
+		if ref.SectionName == "" {
+			continue
+		}
+
+		found := false
+		for _, listener := range listeners {
+			if listener.Name == ref.SectionName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("targetRefs[%d]: Gateway %s has no listener named %s", i, ref.Name, ref.SectionName)
+		}
+	}
+	return nil
+}
+
+func (s *Server) generateClientTrafficPolicyYAML(data ClientTrafficPolicyFormData) (string, error) {
+	policy := ClientTrafficPolicyResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.envoyproxy.io/v1alpha1", Kind: "ClientTrafficPolicy"},
+		Metadata: ObjectMeta{Name: data.Name, Namespace: data.Namespace},
+		Spec: ClientTrafficPolicySpec{
+			TargetRefs: convertPolicyTargetRefs(data.TargetRefs),
+		},
+	}
+	spec := &policy.Spec
+
+	if data.HTTP2 != nil && data.HTTP2.MaxConcurrentStreams > 0 {
+		spec.HTTP2 = &HTTP2Settings{MaxConcurrentStreams: data.HTTP2.MaxConcurrentStreams}
+	}
+	if data.EnableHTTP3 {
+		spec.HTTP3 = &struct{}{}
+	}
+
+	if keepalive := data.TCPKeepalive; keepalive != nil {
+		spec.TCPKeepalive = &TCPKeepalive{
+			Probes:   keepalive.Probes,
+			IdleTime: keepalive.IdleTime,
+			Interval: keepalive.Interval,
+		}
+	}
+
+	tls := ClientTLSSettings{}
+	if data.TLS != nil {
+		tls.MinVersion = data.TLS.MinVersion
+		tls.MaxVersion = data.TLS.MaxVersion
+		tls.Ciphers = data.TLS.Ciphers
+	}
+	// HTTP/2 is negotiated through ALPN, so disabling it means only advertising HTTP/1.1
+	if data.HTTP2 != nil && data.HTTP2.Disabled {
+		tls.ALPNProtocols = []string{"http/1.1"}
+	}
+	if tls.MinVersion != "" || tls.MaxVersion != "" || len(tls.Ciphers) > 0 || len(tls.ALPNProtocols) > 0 {
+		spec.TLS = &tls
+	}
+
+	if detection := data.ClientIPDetection; detection != nil {
+		if detection.XFFNumTrustedHops > 0 {
+			spec.ClientIPDetection = &ClientIPDetection{
+				XForwardedFor: &XForwardedForSettings{NumTrustedHops: detection.XFFNumTrustedHops},
+			}
+		}
+		spec.EnableProxyProtocol = detection.EnableProxyProtocol
+	}
+
+	if connection := data.Connection; connection != nil && (connection.ConnectionLimit > 0 || connection.BufferLimit != "") {
+		spec.Connection = &ClientConnection{BufferLimit: connection.BufferLimit}
+		if connection.ConnectionLimit > 0 {
+			spec.Connection.ConnectionLimit = &ConnectionLimit{
+				Value:      connection.ConnectionLimit,
+				CloseDelay: connection.CloseDelay,
+			}
+		}
+	}
+
+	if path := data.Path; path != nil && (path.EscapedSlashesAction != "" || path.DisableMergeSlashes) {
+		spec.Path = &PathSettings{
+			EscapedSlashesAction: path.EscapedSlashesAction,
+			DisableMergeSlashes:  path.DisableMergeSlashes,
+		}
+	}
+
+	return marshalResource(policy)
+}
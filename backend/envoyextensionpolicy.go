@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type EnvoyExtensionPolicyFormData struct {
+	Name       string            `json:"name"`
+	Namespace  string            `json:"namespace"`
+	TargetRefs []PolicyTargetRef `json:"targetRefs"`
+	Lua        []LuaFormData     `json:"lua,omitempty"`
+	Wasm       []WasmFormData    `json:"wasm,omitempty"`
+	ExtProc    []ExtProcFormData `json:"extProc,omitempty"`
+}
+
+type LuaFormData struct {
+	Script string `json:"script"`
+}
+
+type WasmFormData struct {
+	Name       string          `json:"name"`
+	RootID     string          `json:"rootId,omitempty"`
+	SourceType string          `json:"sourceType"` // "HTTP" or "Image"
+	URL        string          `json:"url"`
+	SHA256     string          `json:"sha256,omitempty"`
+	Config     json.RawMessage `json:"config,omitempty"`
+	FailOpen   bool            `json:"failOpen,omitempty"`
+}
+
+type ExtProcFormData struct {
+	BackendRefs      []HTTPBackendRefFormData `json:"backendRefs"`
+	ProcessRequest   bool                     `json:"processRequest,omitempty"`
+	RequestBodyMode  string                   `json:"requestBodyMode,omitempty"` // "Streamed", "Buffered" or "BufferedPartial"
+	ProcessResponse  bool                     `json:"processResponse,omitempty"`
+	ResponseBodyMode string                   `json:"responseBodyMode,omitempty"`
+	MessageTimeout   string                   `json:"messageTimeout,omitempty"`
+	FailOpen         bool                     `json:"failOpen,omitempty"`
+}
+
+type EnvoyExtensionPolicyResult struct {
+	Message    string            `json:"message"`
+	Accepted   bool              `json:"accepted"`
+	Conditions []PolicyCondition `json:"conditions"`
+}
+
+func (s *Server) handleCreateEnvoyExtensionPolicy(w http.ResponseWriter, r *http.Request) {
+	var policyData EnvoyExtensionPolicyFormData
+	if err := json.NewDecoder(r.Body).Decode(&policyData); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if errs := validateEnvoyExtensionPolicyFormData(policyData); len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+
+	if err := s.validatePolicyTargets(r.Context(), policyData.Namespace, policyData.TargetRefs); err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	yamlContent, err := s.generateEnvoyExtensionPolicyYAML(policyData)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to generate EnvoyExtensionPolicy YAML: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, "envoyextensionpolicy"); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply EnvoyExtensionPolicy: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	// Wasm modules are fetched asynchronously, so give the controller a moment to report
+	conditions, err := s.waitForPolicyCondition(r.Context(), "envoyextensionpolicies.gateway.envoyproxy.io", policyData.Namespace, policyData.Name, "Accepted", 10*time.Second)
+	if err != nil {
+		log.Printf("Failed to read EnvoyExtensionPolicy status: %v", err)
+	}
+
+	// The policy stays applied when the controller rejects it, so the rejection is a
+	// warning on a successful response, as for EnvoyPatchPolicy
+	result := EnvoyExtensionPolicyResult{
+		Message:    fmt.Sprintf("EnvoyExtensionPolicy %s created successfully in namespace %s", policyData.Name, policyData.Namespace),
+		Conditions: conditions,
+	}
+	for _, condition := range conditions {
+		if condition.Type == "Accepted" && condition.Status == "True" {
+			result.Accepted = true
+		}
+	}
+
+	response := APIResponse{Success: true, Data: result}
+	if rejection := policyRejection(conditions); rejection != "" {
+		response.Warnings = []string{fmt.Sprintf("EnvoyExtensionPolicy %s was applied but rejected: %s", policyData.Name, rejection)}
+	} else if len(conditions) == 0 {
+		response.Warnings = []string{"No status reported yet; check the policy again shortly"}
+	}
+	s.sendResponse(w, response)
+}
+
+func validateEnvoyExtensionPolicyFormData(data EnvoyExtensionPolicyFormData) FieldErrors {
+	var errs FieldErrors
+	validateObjectName(&errs, "name", data.Name)
+	validateDNSLabel(&errs, "namespace", data.Namespace)
+	validatePolicyTargetRefs(&errs, data.TargetRefs, policyTargetKinds)
+	if len(data.Lua) == 0 && len(data.Wasm) == 0 && len(data.ExtProc) == 0 {
+		errs.add("", "at least one lua, wasm or extProc extension is required")
+	}
+
+	for i, lua := range data.Lua {
+		field := fmt.Sprintf("lua[%d].script", i)
+		if strings.TrimSpace(lua.Script) == "" {
+			errs.add(field, "is required")
+		} else if !strings.Contains(lua.Script, "envoy_on_request") && !strings.Contains(lua.Script, "envoy_on_response") {
+			errs.add(field, "must define envoy_on_request or envoy_on_response")
+		}
+	}
+
+	for i, wasm := range data.Wasm {
+		field := fmt.Sprintf("wasm[%d]", i)
+		if wasm.Name == "" {
+			errs.add(field+".name", "is required")
+		}
+		if wasm.URL == "" {
+			errs.add(field+".url", "is required")
+		}
+		switch wasm.SourceType {
+		case "HTTP":
+			// Envoy Gateway requires a checksum for modules downloaded over HTTP
+			if wasm.SHA256 == "" {
+				errs.add(field+".sha256", "is required for HTTP sources")
+			}
+		case "Image":
+		default:
+			errs.add(field+".sourceType", "must be HTTP or Image")
+		}
+		if len(wasm.Config) > 0 && !json.Valid(wasm.Config) {
+			errs.add(field+".config", "is not valid JSON")
+		}
+	}
+
+	for i, extProc := range data.ExtProc {
+		field := fmt.Sprintf("extProc[%d]", i)
+		if len(extProc.BackendRefs) == 0 {
+			errs.add(field+".backendRefs", "at least one backendRef is required")
+		}
+		for j, ref := range extProc.BackendRefs {
+			validateBackendRef(&errs, fmt.Sprintf("%s.backendRefs[%d]", field, j), ref)
+		}
+		validateBodyMode(&errs, field+".requestBodyMode", extProc.RequestBodyMode)
+		validateBodyMode(&errs, field+".responseBodyMode", extProc.ResponseBodyMode)
+		validateGatewayDuration(&errs, field+".messageTimeout", extProc.MessageTimeout)
+	}
+
+	return errs
+}
+
+func validateBodyMode(errs *FieldErrors, field, mode string) {
+	switch mode {
+	case "", "Streamed", "Buffered", "BufferedPartial":
+	default:
+		errs.add(field, "must be Streamed, Buffered or BufferedPartial")
+	}
+}
+
+func (s *Server) generateEnvoyExtensionPolicyYAML(data EnvoyExtensionPolicyFormData) (string, error) {
+	policy := EnvoyExtensionPolicyResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.envoyproxy.io/v1alpha1", Kind: "EnvoyExtensionPolicy"},
+		Metadata: ObjectMeta{Name: data.Name, Namespace: data.Namespace},
+		Spec: EnvoyExtensionPolicySpec{
+			TargetRefs: convertPolicyTargetRefs(data.TargetRefs),
+		},
+	}
+
+	for _, script := range data.Lua {
+		policy.Spec.Lua = append(policy.Spec.Lua, Lua{Type: "Inline", Inline: script.Script})
+	}
+
+	for i, module := range data.Wasm {
+		source := &WasmSource{URL: module.URL, SHA256: module.SHA256}
+		wasm := Wasm{
+			Name:     module.Name,
+			RootID:   module.RootID,
+			Code:     WasmCodeSource{Type: module.SourceType},
+			FailOpen: module.FailOpen,
+		}
+		if module.SourceType == "HTTP" {
+			wasm.Code.HTTP = source
+		} else {
+			wasm.Code.Image = source
+		}
+		if len(module.Config) > 0 {
+			if err := json.Unmarshal(module.Config, &wasm.Config); err != nil {
+				return "", fmt.Errorf("wasm[%d]: %v", i, err)
+			}
+		}
+		policy.Spec.Wasm = append(policy.Spec.Wasm, wasm)
+	}
+
+	for _, extProc := range data.ExtProc {
+		processor := ExtProc{
+			BackendRefs:    make([]BackendObjectReference, len(extProc.BackendRefs)),
+			MessageTimeout: extProc.MessageTimeout,
+			FailOpen:       extProc.FailOpen,
+		}
+		for j, ref := range extProc.BackendRefs {
+			processor.BackendRefs[j] = BackendObjectReference{Name: ref.Name, Namespace: ref.Namespace, Port: ref.Port}
+		}
+
+		// Envoy only sends a phase to the processor when it appears in processingMode
+		if extProc.ProcessRequest || extProc.ProcessResponse {
+			processor.ProcessingMode = &ExtProcProcessingMode{}
+			if extProc.ProcessRequest {
+				processor.ProcessingMode.Request = &ProcessingModeOptions{Body: extProc.RequestBodyMode}
+			}
+			if extProc.ProcessResponse {
+				processor.ProcessingMode.Response = &ProcessingModeOptions{Body: extProc.ResponseBodyMode}
+			}
+		}
+		policy.Spec.ExtProc = append(policy.Spec.ExtProc, processor)
+	}
+
+	return marshalResource(policy)
+}
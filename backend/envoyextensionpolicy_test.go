@@ -0,0 +1,12 @@
+package main
+
+import "testing"
+
+func TestValidateEnvoyExtensionPolicyWithoutExtensions(t *testing.T) {
+	data := EnvoyExtensionPolicyFormData{
+		Name:       "ext",
+		Namespace:  "default",
+		TargetRefs: []PolicyTargetRef{{Kind: "Gateway", Name: "eg"}},
+	}
+	checkFieldErrors(t, "no extensions", validateEnvoyExtensionPolicyFormData(data), []string{""})
+}
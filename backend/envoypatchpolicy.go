@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const envoyGatewayNamespace = "envoy-gateway-system"
+
+type EnvoyPatchPolicyFormData struct {
+	Name                string              `json:"name"`
+	Namespace           string              `json:"namespace"`
+	GatewayName         string              `json:"gatewayName"`
+	Priority            int                 `json:"priority,omitempty"`
+	Patches             []JSONPatchFormData `json:"patches"`
+	SkipConfigDumpCheck bool                `json:"skipConfigDumpCheck,omitempty"`
+}
+
+type JSONPatchFormData struct {
+	ResourceType string          `json:"resourceType"` // "Listener", "RouteConfiguration" or "Cluster"
+	ResourceName string          `json:"resourceName"`
+	Op           string          `json:"op"` // "add", "remove", "replace", "move", "copy" or "test"
+	Path         string          `json:"path"`
+	From         string          `json:"from,omitempty"`
+	Value        json.RawMessage `json:"value,omitempty"`
+}
+
+type EnvoyPatchPolicyResult struct {
+	Message    string            `json:"message"`
+	Programmed bool              `json:"programmed"`
+	Conditions []PolicyCondition `json:"conditions"`
+}
+
+// xdsTypeURLs maps the resource types a patch can target to their xDS type URLs
+var xdsTypeURLs = map[string]string{
+	"Listener":           "type.googleapis.com/envoy.config.listener.v3.Listener",
+	"RouteConfiguration": "type.googleapis.com/envoy.config.route.v3.RouteConfiguration",
+	"Cluster":            "type.googleapis.com/envoy.config.cluster.v3.Cluster",
+}
+
+func (s *Server) handleCreateEnvoyPatchPolicy(w http.ResponseWriter, r *http.Request) {
+	var policyData EnvoyPatchPolicyFormData
+	if err := json.NewDecoder(r.Body).Decode(&policyData); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if errs := validateEnvoyPatchPolicyFormData(policyData); len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if !policyData.SkipConfigDumpCheck {
+		names, err := s.getXDSResourceNames(r.Context(), kube, policyData.Namespace, policyData.GatewayName)
+		if err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to read Envoy config dump: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for i, patch := range policyData.Patches {
+			if !names[patch.ResourceType][patch.ResourceName] {
+				s.sendError(w, fmt.Sprintf("patches[%d]: %s %q does not exist in the Envoy config dump (known: %s)",
+					i, patch.ResourceType, patch.ResourceName, strings.Join(sortedKeys(names[patch.ResourceType]), ", ")), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	yamlContent, err := s.generateEnvoyPatchPolicyYAML(policyData)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to generate EnvoyPatchPolicy YAML: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, "envoypatchpolicy"); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply EnvoyPatchPolicy: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	conditions, err := s.waitForPolicyCondition(r.Context(), "envoypatchpolicies.gateway.envoyproxy.io", policyData.Namespace, policyData.Name, "Programmed", 10*time.Second)
+	if err != nil {
+		log.Printf("Failed to read EnvoyPatchPolicy status: %v", err)
+	}
+
+	result := EnvoyPatchPolicyResult{
+		Message:    fmt.Sprintf("EnvoyPatchPolicy %s created successfully in namespace %s", policyData.Name, policyData.Namespace),
+		Conditions: conditions,
+	}
+	for _, condition := range conditions {
+		if condition.Type == "Programmed" && condition.Status == "True" {
+			result.Programmed = true
+		}
+	}
+
+	response := APIResponse{Success: true, Data: result}
+	if rejection := policyRejection(conditions); rejection != "" {
+		response.Warnings = []string{rejection}
+	} else if len(conditions) == 0 {
+		response.Warnings = []string{"No status reported yet; EnvoyPatchPolicy must be enabled in the EnvoyGateway config (extensionApis.enableEnvoyPatchPolicy)"}
+	}
+	s.sendResponse(w, response)
+}
+
+func validateEnvoyPatchPolicyFormData(data EnvoyPatchPolicyFormData) FieldErrors {
+	var errs FieldErrors
+	validateObjectName(&errs, "name", data.Name)
+	validateDNSLabel(&errs, "namespace", data.Namespace)
+	validateObjectName(&errs, "gatewayName", data.GatewayName)
+	if len(data.Patches) == 0 {
+		errs.add("patches", "at least one patch is required")
+	}
+	for i, patch := range data.Patches {
+		field := fmt.Sprintf("patches[%d]", i)
+		if _, ok := xdsTypeURLs[patch.ResourceType]; !ok {
+			errs.add(field+".resourceType", "must be Listener, RouteConfiguration or Cluster")
+		}
+		if patch.ResourceName == "" {
+			errs.add(field+".resourceName", "is required")
+		}
+		if !strings.HasPrefix(patch.Path, "/") && patch.Path != "" {
+			errs.add(field+".path", "must be a JSON pointer starting with '/'")
+		}
+		switch patch.Op {
+		case "add", "replace", "test":
+			if len(patch.Value) == 0 {
+				errs.add(field+".value", "is required for op %s", patch.Op)
+			}
+		case "remove":
+		case "move", "copy":
+			if patch.From == "" {
+				errs.add(field+".from", "is required for op %s", patch.Op)
+			}
+		default:
+			errs.add(field+".op", "must be add, remove, replace, move, copy or test")
+		}
+		if len(patch.Value) > 0 && !json.Valid(patch.Value) {
+			errs.add(field+".value", "is not valid JSON")
+		}
+	}
+	return errs
+}
+
+// envoyPodSelector selects the Envoy pods Envoy Gateway runs for a Gateway
+func envoyPodSelector(namespace, gatewayName string) string {
+	return fmt.Sprintf("gateway.envoyproxy.io/owning-gateway-name=%s,gateway.envoyproxy.io/owning-gateway-namespace=%s", gatewayName, namespace)
+}
+
+// getXDSResourceNames port-forwards to the admin interface of one of the Gateway's Envoy
+// pods and collects the listener, route configuration and cluster names from its config dump
+func (s *Server) getXDSResourceNames(ctx context.Context, kube KubeClient, namespace, gatewayName string) (map[string]map[string]bool, error) {
+	pods, err := kube.List(ctx, "pods", envoyGatewayNamespace, metav1.ListOptions{LabelSelector: envoyPodSelector(namespace, gatewayName), FieldSelector: "status.phase=Running"})
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no running Envoy pod found for Gateway %s/%s", namespace, gatewayName)
+	}
+	podName := pods[0].GetName()
+
+	localPort, err := freeLocalPort()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := kube.KubectlCommand(ctx, "port-forward", "pod/"+podName, "-n", envoyGatewayNamespace, fmt.Sprintf("%d:19000", localPort))
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to port-forward to %s: %v", podName, err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	url := fmt.Sprintf("http://localhost:%d/config_dump", localPort)
+	var body []byte
+	for attempt := 0; attempt < 10; attempt++ {
+		time.Sleep(500 * time.Millisecond)
+		resp, err := client.Get(url)
+		if err != nil {
+			continue
+		}
+		body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err == nil {
+			break
+		}
+		body = nil
+	}
+	if body == nil {
+		return nil, fmt.Errorf("Envoy admin interface on %s did not respond", podName)
+	}
+
+	return parseXDSResourceNames(body)
+}
+
+func parseXDSResourceNames(configDump []byte) (map[string]map[string]bool, error) {
+	var dump struct {
+		Configs []struct {
+			Type             string `json:"@type"`
+			DynamicListeners []struct {
+				Name string `json:"name"`
+			} `json:"dynamic_listeners"`
+			DynamicRouteConfigs []struct {
+				RouteConfig struct {
+					Name string `json:"name"`
+				} `json:"route_config"`
+			} `json:"dynamic_route_configs"`
+			DynamicActiveClusters []struct {
+				Cluster struct {
+					Name string `json:"name"`
+				} `json:"cluster"`
+			} `json:"dynamic_active_clusters"`
+		} `json:"configs"`
+	}
+	if err := json.Unmarshal(configDump, &dump); err != nil {
+		return nil, fmt.Errorf("failed to parse config dump: %v", err)
+	}
+
+	names := map[string]map[string]bool{
+		"Listener":           {},
+		"RouteConfiguration": {},
+		"Cluster":            {},
+	}
+	for _, config := range dump.Configs {
+		for _, listener := range config.DynamicListeners {
+			names["Listener"][listener.Name] = true
+		}
+		for _, route := range config.DynamicRouteConfigs {
+			names["RouteConfiguration"][route.RouteConfig.Name] = true
+		}
+		for _, cluster := range config.DynamicActiveClusters {
+			names["Cluster"][cluster.Cluster.Name] = true
+		}
+	}
+	return names, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func freeLocalPort() (int, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free local port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (s *Server) generateEnvoyPatchPolicyYAML(data EnvoyPatchPolicyFormData) (string, error) {
+	patches := make([]EnvoyJSONPatchConfig, len(data.Patches))
+	for i, patch := range data.Patches {
+		patches[i] = EnvoyJSONPatchConfig{
+			Type: xdsTypeURLs[patch.ResourceType],
+			Name: patch.ResourceName,
+			Operation: JSONPatchOperation{
+				Op:   patch.Op,
+				Path: patch.Path,
+				From: patch.From,
+			},
+		}
+		if len(patch.Value) > 0 {
+			if err := json.Unmarshal(patch.Value, &patches[i].Operation.Value); err != nil {
+				return "", fmt.Errorf("patches[%d]: %v", i, err)
+			}
+		}
+	}
+
+	policy := EnvoyPatchPolicyResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.envoyproxy.io/v1alpha1", Kind: "EnvoyPatchPolicy"},
+		Metadata: ObjectMeta{Name: data.Name, Namespace: data.Namespace},
+		Spec: EnvoyPatchPolicySpec{
+			Type:        "JSONPatch",
+			JSONPatches: patches,
+			TargetRef: LocalPolicyTargetReference{
+				Group: "gateway.networking.k8s.io",
+				Kind:  "Gateway",
+				Name:  data.GatewayName,
+			},
+			Priority: data.Priority,
+		},
+	}
+	return marshalResource(policy)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// fakeKubeClient is an in-memory KubeClient. Objects are keyed by their "plural.group"
+// resource, namespace and name, and applied objects are pluralized naively from their
+// Kind by fakePlural, which holds for every kind the handlers under test use. Setting
+// errs[op] makes that operation fail with the error, classified the way kubeClient
+// classifies it.
+type fakeKubeClient struct {
+	mutex   sync.Mutex
+	objects map[string]*unstructured.Unstructured
+	errs    map[string]error
+	applied []string          // manifests passed to Apply without dryRun
+	forced  []bool            // whether each Apply without dryRun was forced
+	deleted []string          // "resource namespace/name" of each Delete
+	patched []string          // patch bodies passed to Patch
+	logs    map[string]string // pod logs by "namespace/pod"
+}
+
+var _ KubeClient = (*fakeKubeClient)(nil)
+
+func newFakeKubeClient(objects ...*unstructured.Unstructured) *fakeKubeClient {
+	fake := &fakeKubeClient{objects: map[string]*unstructured.Unstructured{}, errs: map[string]error{}, logs: map[string]string{}}
+	for _, object := range objects {
+		fake.objects[fakeObjectKey(fakeResourceFor(object), object.GetNamespace(), object.GetName())] = object
+	}
+	return fake
+}
+
+func fakeResourceFor(object *unstructured.Unstructured) string {
+	resource := fakePlural(strings.ToLower(object.GetKind()))
+	if group := object.GroupVersionKind().Group; group != "" {
+		resource += "." + group
+	}
+	return resource
+}
+
+// fakePlural is enough English for the kinds the tests use, "policy" included
+func fakePlural(kind string) string {
+	if len(kind) > 1 && kind[len(kind)-1] == 'y' && !strings.ContainsRune("aeiou", rune(kind[len(kind)-2])) {
+		return kind[:len(kind)-1] + "ies"
+	}
+	return kind + "s"
+}
+
+func fakeObjectKey(resource, namespace, name string) string {
+	return resource + "/" + namespace + "/" + name
+}
+
+func (f *fakeKubeClient) fail(op, resource, namespace, name string) error {
+	if err := f.errs[op]; err != nil {
+		return wrapKubeError(err, op, resource, namespace, name)
+	}
+	return nil
+}
+
+func (f *fakeKubeClient) Apply(ctx context.Context, manifest string, dryRun bool) ([]*unstructured.Unstructured, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.fail("apply", "", "", ""); err != nil {
+		return nil, err
+	}
+	objects, err := decodeManifest(manifest)
+	if err != nil {
+		return nil, wrapKubeError(apierrors.NewBadRequest(err.Error()), "apply", "", "", "")
+	}
+	if dryRun {
+		return objects, nil
+	}
+	for _, object := range objects {
+		f.objects[fakeObjectKey(fakeResourceFor(object), object.GetNamespace(), object.GetName())] = object
+	}
+	f.applied = append(f.applied, manifest)
+	f.forced = append(f.forced, forceApplyFrom(ctx))
+	return objects, nil
+}
+
+func (f *fakeKubeClient) Get(ctx context.Context, resource, namespace, name string) (*unstructured.Unstructured, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.fail("get", resource, namespace, name); err != nil {
+		return nil, err
+	}
+	object, ok := f.objects[fakeObjectKey(resource, namespace, name)]
+	if !ok {
+		return nil, wrapKubeError(apierrors.NewNotFound(schema.ParseGroupResource(resource), name), "get", resource, namespace, name)
+	}
+	return object.DeepCopy(), nil
+}
+
+func (f *fakeKubeClient) List(ctx context.Context, resource, namespace string, opts metav1.ListOptions) ([]unstructured.Unstructured, error) {
+	objects, _, err := f.ListWithVersion(ctx, resource, namespace, opts)
+	return objects, err
+}
+
+func (f *fakeKubeClient) ListWithVersion(ctx context.Context, resource, namespace string, opts metav1.ListOptions) ([]unstructured.Unstructured, string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.fail("list", resource, namespace, ""); err != nil {
+		return nil, "", err
+	}
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, "", wrapKubeError(apierrors.NewBadRequest(err.Error()), "list", resource, namespace, "")
+	}
+
+	var objects []unstructured.Unstructured
+	for key, object := range f.objects {
+		if !strings.HasPrefix(key, resource+"/") {
+			continue
+		}
+		if namespace != "" && object.GetNamespace() != namespace {
+			continue
+		}
+		if !selector.Matches(labels.Set(object.GetLabels())) {
+			continue
+		}
+		objects = append(objects, *object.DeepCopy())
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].GetName() < objects[j].GetName() })
+	return objects, "1", nil
+}
+
+func (f *fakeKubeClient) Watch(ctx context.Context, resource, namespace string, opts metav1.ListOptions) (watch.Interface, error) {
+	if err := f.fail("watch", resource, namespace, ""); err != nil {
+		return nil, err
+	}
+	return watch.NewFake(), nil
+}
+
+func (f *fakeKubeClient) Delete(ctx context.Context, resource, namespace, name string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.fail("delete", resource, namespace, name); err != nil {
+		return err
+	}
+	key := fakeObjectKey(resource, namespace, name)
+	if _, ok := f.objects[key]; !ok {
+		return wrapKubeError(apierrors.NewNotFound(schema.ParseGroupResource(resource), name), "delete", resource, namespace, name)
+	}
+	delete(f.objects, key)
+	f.deleted = append(f.deleted, fmt.Sprintf("%s %s/%s", resource, namespace, name))
+	return nil
+}
+
+func (f *fakeKubeClient) Patch(ctx context.Context, resource, namespace, name string, patchType types.PatchType, patch []byte) (*unstructured.Unstructured, error) {
+	f.mutex.Lock()
+	if err := f.fail("patch", resource, namespace, name); err != nil {
+		f.mutex.Unlock()
+		return nil, err
+	}
+	f.patched = append(f.patched, string(patch))
+	f.mutex.Unlock()
+	return f.Get(ctx, resource, namespace, name)
+}
+
+func (f *fakeKubeClient) PodLogs(ctx context.Context, namespace, pod string, opts *corev1.PodLogOptions) (io.ReadCloser, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return io.NopCloser(strings.NewReader(f.logs[namespace+"/"+pod])), nil
+}
+
+func (f *fakeKubeClient) ServerVersion() (string, error) {
+	return "v1.33.0", nil
+}
+
+func (f *fakeKubeClient) APIProxy() (http.Handler, error) {
+	return http.NotFoundHandler(), nil
+}
+
+func (f *fakeKubeClient) Kubectl(ctx context.Context, args ...string) ([]byte, error) {
+	return nil, fmt.Errorf("kubectl is not available in tests")
+}
+
+func (f *fakeKubeClient) KubectlCommand(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, "false")
+}
+
+// ResourceName pluralizes a singular "kind.group" the same naive way Apply does
+func (f *fakeKubeClient) ResourceName(resource string) (string, error) {
+	name, group, _ := strings.Cut(strings.ToLower(resource), ".")
+	if !strings.HasSuffix(name, "s") {
+		name = fakePlural(name)
+	}
+	if group != "" {
+		name += "." + group
+	}
+	return name, nil
+}
+
+func (f *fakeKubeClient) Target() KubeTarget {
+	return KubeTarget{Context: testKubeContext, Cluster: testKubeContext}
+}
+
+const testKubeContext = "test"
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: test
+  cluster:
+    server: https://cluster.test:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+users:
+- name: test
+  user:
+    token: secret
+`
+
+// newTestServer returns a Server whose only context, "test", is served by kube. The
+// kubeconfig, the per-context files and the audit log all live in the test's temp dirs.
+func newTestServer(t *testing.T, kube KubeClient) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(kubeconfigPath, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer()
+	s.policy = &AccessPolicy{}
+	s.audit = &auditLog{path: filepath.Join(dir, "audit.log")}
+	s.kubeconfigs = &kubeconfigStore{
+		sourcePath:   kubeconfigPath,
+		loopbackHost: defaultLoopbackHost,
+		dir:          t.TempDir(),
+		written:      map[string]string{},
+	}
+
+	config, err := s.kubeconfigs.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, digest, err := s.kubeconfigs.contextFile(config, testKubeContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.kubeClients[testKubeContext] = &cachedKubeClient{client: kube, digest: digest}
+	return s
+}
+
+// serve sends a request through the server's router and decodes the APIResponse
+func serve(t *testing.T, s *Server, method, target, body string) (int, APIResponse) {
+	t.Helper()
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, request)
+
+	var response APIResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("%s %s: invalid response %q: %v", method, target, recorder.Body.String(), err)
+	}
+	return recorder.Code, response
+}
+
+// mustServe sends a GET request and fails the test unless it succeeds
+func mustServe(t *testing.T, s *Server, target string) APIResponse {
+	t.Helper()
+	status, response := serve(t, s, http.MethodGet, target, "")
+	if status != http.StatusOK || !response.Success {
+		t.Fatalf("%s: status = %d, response = %+v", target, status, response)
+	}
+	return response
+}
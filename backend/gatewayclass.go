@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const envoyGatewayControllerName = "gateway.envoyproxy.io/gatewayclass-controller"
+
+type GatewayClassFormData struct {
+	Name           string              `json:"name"`
+	ControllerName string              `json:"controllerName,omitempty"`
+	Description    string              `json:"description,omitempty"`
+	EnvoyProxy     *EnvoyProxyFormData `json:"envoyProxy,omitempty"` // generated and referenced through parametersRef
+}
+
+type EnvoyProxyFormData struct {
+	Name               string                `json:"name"`
+	Namespace          string                `json:"namespace"`
+	Replicas           int                   `json:"replicas,omitempty"`
+	Resources          *ResourceRequirements `json:"resources,omitempty"`
+	ServiceType        string                `json:"serviceType,omitempty"` // "LoadBalancer", "NodePort" or "ClusterIP"
+	ServiceAnnotations map[string]string     `json:"serviceAnnotations,omitempty"`
+	LogLevel           string                `json:"logLevel,omitempty"` // "trace", "debug", "info", "warn" or "error"
+}
+
+type ResourceRequirements struct {
+	Requests *ResourceList `json:"requests,omitempty"`
+	Limits   *ResourceList `json:"limits,omitempty"`
+}
+
+type ResourceList struct {
+	CPU    string `json:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty"`
+}
+
+type GatewayClassInfo struct {
+	Name            string `json:"name"`
+	ControllerName  string `json:"controllerName"`
+	Description     string `json:"description,omitempty"`
+	ParametersRef   string `json:"parametersRef,omitempty"`
+	Accepted        bool   `json:"accepted"`
+	AcceptedReason  string `json:"acceptedReason,omitempty"`
+	AcceptedMessage string `json:"acceptedMessage,omitempty"`
+	CreatedAt       string `json:"createdAt"`
+}
+
+func (s *Server) handleListGatewayClasses(w http.ResponseWriter, r *http.Request) {
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	items, err := kube.List(r.Context(), "gatewayclasses.gateway.networking.k8s.io", "", metav1.ListOptions{})
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to list GatewayClasses: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	var kubeList struct {
+		Items []struct {
+			Metadata struct {
+				Name              string `json:"name"`
+				CreationTimestamp string `json:"creationTimestamp"`
+			} `json:"metadata"`
+			Spec struct {
+				ControllerName string `json:"controllerName"`
+				Description    string `json:"description"`
+				ParametersRef  *struct {
+					Kind      string `json:"kind"`
+					Name      string `json:"name"`
+					Namespace string `json:"namespace"`
+				} `json:"parametersRef"`
+			} `json:"spec"`
+			Status struct {
+				Conditions []struct {
+					Type    string `json:"type"`
+					Status  string `json:"status"`
+					Reason  string `json:"reason"`
+					Message string `json:"message"`
+				} `json:"conditions"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+
+	if err := decodeInto(items, &kubeList.Items); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to parse GatewayClass list: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	classes := make([]GatewayClassInfo, 0, len(kubeList.Items))
+	for _, item := range kubeList.Items {
+		class := GatewayClassInfo{
+			Name:           item.Metadata.Name,
+			ControllerName: item.Spec.ControllerName,
+			Description:    item.Spec.Description,
+			CreatedAt:      item.Metadata.CreationTimestamp,
+		}
+		if ref := item.Spec.ParametersRef; ref != nil {
+			class.ParametersRef = fmt.Sprintf("%s %s/%s", ref.Kind, ref.Namespace, ref.Name)
+		}
+		for _, condition := range item.Status.Conditions {
+			if condition.Type == "Accepted" {
+				class.Accepted = condition.Status == "True"
+				class.AcceptedReason = condition.Reason
+				class.AcceptedMessage = condition.Message
+				break
+			}
+		}
+		classes = append(classes, class)
+	}
+
+	response := APIResponse{Success: true, Data: classes}
+	s.sendResponse(w, response)
+}
+
+func (s *Server) handleCreateGatewayClass(w http.ResponseWriter, r *http.Request) {
+	var classData GatewayClassFormData
+	if err := json.NewDecoder(r.Body).Decode(&classData); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	var errs FieldErrors
+	validateObjectName(&errs, "name", classData.Name)
+	if classData.EnvoyProxy != nil {
+		validateEnvoyProxyFormData(&errs, "envoyProxy.", *classData.EnvoyProxy)
+	}
+	if len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+	if classData.ControllerName == "" {
+		classData.ControllerName = envoyGatewayControllerName
+	}
+
+	if classData.EnvoyProxy != nil {
+		proxyYAML, err := s.generateEnvoyProxyYAML(*classData.EnvoyProxy)
+		if err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to generate EnvoyProxy YAML: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if err := s.applyYAML(r.Context(), proxyYAML, "envoyproxy"); err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to apply EnvoyProxy: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+	}
+
+	yamlContent, err := s.generateGatewayClassYAML(classData)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to generate GatewayClass YAML: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, "gatewayclass"); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply GatewayClass: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Data:    fmt.Sprintf("GatewayClass %s created successfully", classData.Name),
+	}
+	s.sendResponse(w, response)
+}
+
+func (s *Server) handleCreateEnvoyProxy(w http.ResponseWriter, r *http.Request) {
+	var proxyData EnvoyProxyFormData
+	if err := json.NewDecoder(r.Body).Decode(&proxyData); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	var errs FieldErrors
+	validateEnvoyProxyFormData(&errs, "", proxyData)
+	if len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+
+	yamlContent, err := s.generateEnvoyProxyYAML(proxyData)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to generate EnvoyProxy YAML: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, "envoyproxy"); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply EnvoyProxy: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Data:    fmt.Sprintf("EnvoyProxy %s created successfully in namespace %s", proxyData.Name, proxyData.Namespace),
+	}
+	s.sendResponse(w, response)
+}
+
+// validateEnvoyProxyFormData reports fields under prefix, which is "envoyProxy." when
+// the EnvoyProxy is nested in a GatewayClass form
+func validateEnvoyProxyFormData(errs *FieldErrors, prefix string, data EnvoyProxyFormData) {
+	validateObjectName(errs, prefix+"name", data.Name)
+	validateDNSLabel(errs, prefix+"namespace", data.Namespace)
+	validateNonNegative(errs, prefix+"replicas", data.Replicas)
+	switch data.ServiceType {
+	case "", "LoadBalancer", "NodePort", "ClusterIP":
+	default:
+		errs.add(prefix+"serviceType", "must be LoadBalancer, NodePort or ClusterIP")
+	}
+	switch data.LogLevel {
+	case "", "trace", "debug", "info", "warn", "error":
+	default:
+		errs.add(prefix+"logLevel", "must be trace, debug, info, warn or error")
+	}
+}
+
+func (s *Server) generateGatewayClassYAML(data GatewayClassFormData) (string, error) {
+	gatewayClass := GatewayClassResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.networking.k8s.io/v1", Kind: "GatewayClass"},
+		Metadata: ObjectMeta{Name: data.Name},
+		Spec: GatewayClassSpec{
+			ControllerName: data.ControllerName,
+			Description:    data.Description,
+		},
+	}
+	if data.EnvoyProxy != nil {
+		gatewayClass.Spec.ParametersRef = &ParametersReference{
+			Group:     "gateway.envoyproxy.io",
+			Kind:      "EnvoyProxy",
+			Name:      data.EnvoyProxy.Name,
+			Namespace: data.EnvoyProxy.Namespace,
+		}
+	}
+	return marshalResource(gatewayClass)
+}
+
+func (s *Server) generateEnvoyProxyYAML(data EnvoyProxyFormData) (string, error) {
+	envoyProxy := EnvoyProxyResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.envoyproxy.io/v1alpha1", Kind: "EnvoyProxy"},
+		Metadata: ObjectMeta{Name: data.Name, Namespace: data.Namespace},
+		Spec: EnvoyProxySpec{
+			Provider: EnvoyProxyProvider{Type: "Kubernetes"},
+		},
+	}
+	kubernetes := &envoyProxy.Spec.Provider.Kubernetes
+
+	deployment := KubernetesDeploymentSpec{Replicas: data.Replicas}
+	if data.Resources != nil {
+		resources := ContainerResources{
+			Requests: convertResourceList(data.Resources.Requests),
+			Limits:   convertResourceList(data.Resources.Limits),
+		}
+		if resources.Requests != nil || resources.Limits != nil {
+			deployment.Container = &KubernetesContainerSpec{Resources: resources}
+		}
+	}
+	if deployment.Replicas > 0 || deployment.Container != nil {
+		kubernetes.EnvoyDeployment = &deployment
+	}
+
+	if data.ServiceType != "" || len(data.ServiceAnnotations) > 0 {
+		kubernetes.EnvoyService = &KubernetesServiceSpec{
+			Type:        data.ServiceType,
+			Annotations: data.ServiceAnnotations,
+		}
+	}
+
+	if data.LogLevel != "" {
+		envoyProxy.Spec.Logging = &ProxyLogging{
+			Level: map[string]string{"default": data.LogLevel},
+		}
+	}
+
+	return marshalResource(envoyProxy)
+}
+
+func convertResourceList(list *ResourceList) map[string]string {
+	if list == nil || (list.CPU == "" && list.Memory == "") {
+		return nil
+	}
+	result := map[string]string{}
+	if list.CPU != "" {
+		result["cpu"] = list.CPU
+	}
+	if list.Memory != "" {
+		result["memory"] = list.Memory
+	}
+	return result
+}
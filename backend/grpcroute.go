@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type GRPCRouteFormData struct {
+	Name                   string             `json:"name"`
+	Namespace              string             `json:"namespace"`
+	ParentGateway          string             `json:"parentGateway"`
+	ParentGatewayNamespace string             `json:"parentGatewayNamespace"`
+	Hostnames              []string           `json:"hostnames"`
+	Rules                  []GRPCRuleFormData `json:"rules"`
+}
+
+type GRPCRuleFormData struct {
+	Name        string                    `json:"name,omitempty"`
+	Matches     []GRPCRouteMatchFormData  `json:"matches"`
+	Filters     []GRPCRouteFilterFormData `json:"filters,omitempty"`
+	BackendRefs []GRPCBackendRefFormData  `json:"backendRefs"`
+}
+
+type GRPCRouteMatchFormData struct {
+	MethodType string                         `json:"methodType"` // "Exact" or "RegularExpression"
+	Service    string                         `json:"service,omitempty"`
+	Method     string                         `json:"method,omitempty"`
+	Headers    []HTTPRouteHeaderMatchFormData `json:"headers"`
+}
+
+type GRPCBackendRefFormData struct {
+	Name    string                    `json:"name"`
+	Port    int                       `json:"port"`
+	Weight  *int                      `json:"weight,omitempty"`
+	Filters []GRPCRouteFilterFormData `json:"filters,omitempty"`
+}
+
+type GRPCRouteFilterFormData struct {
+	Type                   string                  `json:"type"` // "RequestHeaderModifier", "ResponseHeaderModifier" or "RequestMirror"
+	RequestHeaderModifier  *HeaderModifierFormData `json:"requestHeaderModifier,omitempty"`
+	ResponseHeaderModifier *HeaderModifierFormData `json:"responseHeaderModifier,omitempty"`
+	RequestMirror          *BackendRef             `json:"requestMirror,omitempty"`
+}
+
+type HeaderModifierFormData struct {
+	Set    []HTTPHeaderFormData `json:"set,omitempty"`
+	Add    []HTTPHeaderFormData `json:"add,omitempty"`
+	Remove []string             `json:"remove,omitempty"`
+}
+
+type HTTPHeaderFormData struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (s *Server) handleCreateGRPCRoute(w http.ResponseWriter, r *http.Request) {
+	var routeData GRPCRouteFormData
+	if err := json.NewDecoder(r.Body).Decode(&routeData); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if errs := validateGRPCRouteFormData(routeData); len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+
+	yamlContent, err := s.generateGRPCRouteYAML(routeData)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to generate GRPCRoute YAML: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, "grpcroute"); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply GRPCRoute: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Data:    fmt.Sprintf("GRPCRoute %s created successfully in namespace %s", routeData.Name, routeData.Namespace),
+	}
+	s.sendResponse(w, response)
+}
+
+func (s *Server) generateGRPCRouteYAML(data GRPCRouteFormData) (string, error) {
+	route := GRPCRouteResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.networking.k8s.io/v1", Kind: "GRPCRoute"},
+		Metadata: ObjectMeta{Name: data.Name, Namespace: data.Namespace},
+		Spec: GRPCRouteSpec{
+			ParentRefs: []ParentReference{{Name: data.ParentGateway, Namespace: data.ParentGatewayNamespace}},
+			Hostnames:  data.Hostnames,
+			Rules:      s.convertGRPCRulesFromFormData(data.Rules),
+		},
+	}
+	return marshalResource(route)
+}
+
+func (s *Server) convertGRPCRulesFromFormData(rules []GRPCRuleFormData) []GRPCRouteRule {
+	result := make([]GRPCRouteRule, len(rules))
+	for i, rule := range rules {
+		routeRule := GRPCRouteRule{
+			Name:    rule.Name,
+			Filters: s.convertGRPCFilters(rule.Filters),
+		}
+
+		for _, match := range rule.Matches {
+			routeMatch := GRPCRouteMatch{}
+			if match.Service != "" || match.Method != "" {
+				routeMatch.Method = &GRPCMethodMatch{
+					Type:    match.MethodType,
+					Service: match.Service,
+					Method:  match.Method,
+				}
+			}
+			for _, header := range match.Headers {
+				routeMatch.Headers = append(routeMatch.Headers, HTTPHeaderMatch{
+					Type:  header.Type,
+					Name:  header.Name,
+					Value: header.Value,
+				})
+			}
+			routeRule.Matches = append(routeRule.Matches, routeMatch)
+		}
+
+		routeRule.BackendRefs = make([]GRPCBackendRef, len(rule.BackendRefs))
+		for j, ref := range rule.BackendRefs {
+			routeRule.BackendRefs[j] = GRPCBackendRef{
+				BackendObjectReference: BackendObjectReference{Name: ref.Name, Port: ref.Port},
+				Weight:                 ref.Weight,
+				Filters:                s.convertGRPCFilters(ref.Filters),
+			}
+		}
+
+		result[i] = routeRule
+	}
+	return result
+}
+
+func (s *Server) convertGRPCFilters(filters []GRPCRouteFilterFormData) []GRPCRouteFilter {
+	var result []GRPCRouteFilter
+	for _, filter := range filters {
+		routeFilter := GRPCRouteFilter{Type: filter.Type}
+		switch filter.Type {
+		case "RequestHeaderModifier":
+			routeFilter.RequestHeaderModifier = convertHeaderModifier(filter.RequestHeaderModifier)
+		case "ResponseHeaderModifier":
+			routeFilter.ResponseHeaderModifier = convertHeaderModifier(filter.ResponseHeaderModifier)
+		case "RequestMirror":
+			if filter.RequestMirror != nil {
+				routeFilter.RequestMirror = &HTTPRequestMirrorFilter{
+					BackendRef: BackendObjectReference{Name: filter.RequestMirror.Name, Port: filter.RequestMirror.Port},
+				}
+			}
+		}
+		result = append(result, routeFilter)
+	}
+	return result
+}
+
+func convertHeaderModifier(modifier *HeaderModifierFormData) *HTTPHeaderFilter {
+	if modifier == nil {
+		return nil
+	}
+	result := &HTTPHeaderFilter{Remove: modifier.Remove}
+	for _, header := range modifier.Set {
+		result.Set = append(result.Set, HTTPHeader{Name: header.Name, Value: header.Value})
+	}
+	for _, header := range modifier.Add {
+		result.Add = append(result.Add, HTTPHeader{Name: header.Name, Value: header.Value})
+	}
+	return result
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// inventoryKind is a resource type the inventory endpoints understand
+type inventoryKind struct {
+	Name       string // the path segment, e.g. "httproutes"
+	Kind       string
+	Resource   string
+	Namespaced bool
+}
+
+// inventoryKinds are listed in the order /inventory returns them
+var inventoryKinds = []inventoryKind{
+	{"gatewayclasses", "GatewayClass", "gatewayclasses.gateway.networking.k8s.io", false},
+	{"gateways", "Gateway", "gateways.gateway.networking.k8s.io", true},
+	{"httproutes", "HTTPRoute", "httproutes.gateway.networking.k8s.io", true},
+	{"grpcroutes", "GRPCRoute", "grpcroutes.gateway.networking.k8s.io", true},
+	{"tlsroutes", "TLSRoute", "tlsroutes.gateway.networking.k8s.io", true},
+	{"tcproutes", "TCPRoute", "tcproutes.gateway.networking.k8s.io", true},
+	{"udproutes", "UDPRoute", "udproutes.gateway.networking.k8s.io", true},
+	{"backendtlspolicies", "BackendTLSPolicy", "backendtlspolicies.gateway.networking.k8s.io", true},
+	{"securitypolicies", "SecurityPolicy", "securitypolicies.gateway.envoyproxy.io", true},
+	{"backendtrafficpolicies", "BackendTrafficPolicy", "backendtrafficpolicies.gateway.envoyproxy.io", true},
+	{"clienttrafficpolicies", "ClientTrafficPolicy", "clienttrafficpolicies.gateway.envoyproxy.io", true},
+	{"envoypatchpolicies", "EnvoyPatchPolicy", "envoypatchpolicies.gateway.envoyproxy.io", true},
+	{"envoyextensionpolicies", "EnvoyExtensionPolicy", "envoyextensionpolicies.gateway.envoyproxy.io", true},
+}
+
+// lookupInventoryKind accepts the plural, the singular or the Kind, in any case
+func lookupInventoryKind(name string) (inventoryKind, bool) {
+	name = strings.ToLower(name)
+	for _, kind := range inventoryKinds {
+		if name == kind.Name || name == strings.ToLower(kind.Kind) {
+			return kind, true
+		}
+	}
+	return inventoryKind{}, false
+}
+
+// InventoryCondition is a status condition. Parent names the Gateway, route or policy
+// target it was reported for, when the resource reports conditions per parent.
+type InventoryCondition struct {
+	Parent             string `json:"parent,omitempty"`
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	Reason             string `json:"reason,omitempty"`
+	Message            string `json:"message,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+}
+
+type InventoryRef struct {
+	Kind        string `json:"kind,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name"`
+	SectionName string `json:"sectionName,omitempty"`
+	Port        int    `json:"port,omitempty"`
+}
+
+type InventoryListener struct {
+	Name           string               `json:"name"`
+	Port           int                  `json:"port"`
+	Protocol       string               `json:"protocol"`
+	Hostname       string               `json:"hostname,omitempty"`
+	AttachedRoutes int                  `json:"attachedRoutes"`
+	SupportedKinds []string             `json:"supportedKinds,omitempty"`
+	Programmed     *bool                `json:"programmed,omitempty"`
+	Conditions     []InventoryCondition `json:"conditions,omitempty"`
+}
+
+// InventoryItem is a Gateway API or Envoy Gateway resource with its status parsed. The
+// summary flags are true when every parent reports the condition True, false when any
+// reports False, and absent until the controller reports the condition at all.
+type InventoryItem struct {
+	Kind         string               `json:"kind"`
+	Name         string               `json:"name"`
+	Namespace    string               `json:"namespace,omitempty"`
+	Labels       map[string]string    `json:"labels,omitempty"`
+	Generation   int64                `json:"generation,omitempty"`
+	CreatedAt    string               `json:"createdAt"`
+	Accepted     *bool                `json:"accepted,omitempty"`
+	Programmed   *bool                `json:"programmed,omitempty"`
+	ResolvedRefs *bool                `json:"resolvedRefs,omitempty"`
+	Conditions   []InventoryCondition `json:"conditions,omitempty"`
+
+	ControllerName   string              `json:"controllerName,omitempty"`   // GatewayClass
+	GatewayClassName string              `json:"gatewayClassName,omitempty"` // Gateway
+	Addresses        []GatewayAddress    `json:"addresses,omitempty"`        // Gateway, as assigned
+	Listeners        []InventoryListener `json:"listeners,omitempty"`        // Gateway
+	Hostnames        []string            `json:"hostnames,omitempty"`        // routes
+	ParentRefs       []InventoryRef      `json:"parentRefs,omitempty"`       // routes
+	BackendRefs      []InventoryRef      `json:"backendRefs,omitempty"`      // routes
+	TargetRefs       []InventoryRef      `json:"targetRefs,omitempty"`       // policies
+}
+
+type inventoryConditionJSON struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	Reason             string `json:"reason"`
+	Message            string `json:"message"`
+	LastTransitionTime string `json:"lastTransitionTime"`
+	ObservedGeneration int64  `json:"observedGeneration"`
+}
+
+type inventoryRefJSON struct {
+	Kind        string `json:"kind"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	SectionName string `json:"sectionName"`
+	Port        int    `json:"port"`
+}
+
+// inventoryObject covers the fields of every inventory kind; each kind fills in its own
+type inventoryObject struct {
+	Metadata struct {
+		Name              string            `json:"name"`
+		Namespace         string            `json:"namespace"`
+		Labels            map[string]string `json:"labels"`
+		Generation        int64             `json:"generation"`
+		CreationTimestamp string            `json:"creationTimestamp"`
+	} `json:"metadata"`
+	Spec struct {
+		ControllerName   string `json:"controllerName"`
+		GatewayClassName string `json:"gatewayClassName"`
+		Listeners        []struct {
+			Name     string `json:"name"`
+			Port     int    `json:"port"`
+			Protocol string `json:"protocol"`
+			Hostname string `json:"hostname"`
+		} `json:"listeners"`
+		Hostnames  []string           `json:"hostnames"`
+		ParentRefs []inventoryRefJSON `json:"parentRefs"`
+		Rules      []struct {
+			BackendRefs []inventoryRefJSON `json:"backendRefs"`
+		} `json:"rules"`
+		TargetRef  *inventoryRefJSON  `json:"targetRef"`
+		TargetRefs []inventoryRefJSON `json:"targetRefs"`
+	} `json:"spec"`
+	Status struct {
+		Conditions []inventoryConditionJSON `json:"conditions"`
+		Addresses  []GatewayAddress         `json:"addresses"`
+		Listeners  []struct {
+			Name           string `json:"name"`
+			AttachedRoutes int    `json:"attachedRoutes"`
+			SupportedKinds []struct {
+				Kind string `json:"kind"`
+			} `json:"supportedKinds"`
+			Conditions []inventoryConditionJSON `json:"conditions"`
+		} `json:"listeners"`
+		Parents []struct {
+			ParentRef  inventoryRefJSON         `json:"parentRef"`
+			Conditions []inventoryConditionJSON `json:"conditions"`
+		} `json:"parents"`
+		Ancestors []struct {
+			AncestorRef inventoryRefJSON         `json:"ancestorRef"`
+			Conditions  []inventoryConditionJSON `json:"conditions"`
+		} `json:"ancestors"`
+	} `json:"status"`
+}
+
+func (r inventoryRefJSON) toRef(defaultKind, defaultNamespace string) InventoryRef {
+	ref := InventoryRef{Kind: r.Kind, Namespace: r.Namespace, Name: r.Name, SectionName: r.SectionName, Port: r.Port}
+	if ref.Kind == "" {
+		ref.Kind = defaultKind
+	}
+	if ref.Namespace == "" {
+		ref.Namespace = defaultNamespace
+	}
+	return ref
+}
+
+func (r InventoryRef) String() string {
+	name := r.Name
+	if r.Namespace != "" {
+		name = r.Namespace + "/" + name
+	}
+	if r.Kind != "" {
+		name = r.Kind + " " + name
+	}
+	if r.SectionName != "" {
+		name += "#" + r.SectionName
+	}
+	return name
+}
+
+func inventoryConditions(parent string, conditions []inventoryConditionJSON) []InventoryCondition {
+	result := make([]InventoryCondition, 0, len(conditions))
+	for _, condition := range conditions {
+		result = append(result, InventoryCondition{
+			Parent:             parent,
+			Type:               condition.Type,
+			Status:             condition.Status,
+			Reason:             condition.Reason,
+			Message:            condition.Message,
+			LastTransitionTime: condition.LastTransitionTime,
+			ObservedGeneration: condition.ObservedGeneration,
+		})
+	}
+	return result
+}
+
+// summarizeCondition folds every reported condition of one type into a single flag
+func summarizeCondition(conditions []InventoryCondition, conditionType string) *bool {
+	var summary *bool
+	for _, condition := range conditions {
+		if condition.Type != conditionType {
+			continue
+		}
+		switch condition.Status {
+		case "False":
+			return boolPtr(false)
+		case "True":
+			summary = boolPtr(true)
+		}
+	}
+	return summary
+}
+
+// normalizeInventoryItem parses an object of the given kind into an InventoryItem
+func normalizeInventoryItem(kind inventoryKind, object *unstructured.Unstructured) (InventoryItem, error) {
+	var parsed inventoryObject
+	if err := decodeInto(object.Object, &parsed); err != nil {
+		return InventoryItem{}, fmt.Errorf("failed to parse %s %s: %v", kind.Kind, object.GetName(), err)
+	}
+	metadata, spec, status := parsed.Metadata, parsed.Spec, parsed.Status
+	item := InventoryItem{
+		Kind:             kind.Kind,
+		Name:             metadata.Name,
+		Namespace:        metadata.Namespace,
+		Labels:           metadata.Labels,
+		Generation:       metadata.Generation,
+		CreatedAt:        metadata.CreationTimestamp,
+		Conditions:       inventoryConditions("", status.Conditions),
+		ControllerName:   spec.ControllerName,
+		GatewayClassName: spec.GatewayClassName,
+		Addresses:        status.Addresses,
+		Hostnames:        spec.Hostnames,
+	}
+
+	// Listener status is reported separately from the spec, matched up by name
+	listenerStatus := make(map[string]int, len(status.Listeners))
+	for i, listener := range status.Listeners {
+		listenerStatus[listener.Name] = i
+	}
+	for _, listener := range spec.Listeners {
+		entry := InventoryListener{Name: listener.Name, Port: listener.Port, Protocol: listener.Protocol, Hostname: listener.Hostname}
+		if i, ok := listenerStatus[listener.Name]; ok {
+			reported := status.Listeners[i]
+			entry.AttachedRoutes = reported.AttachedRoutes
+			for _, supported := range reported.SupportedKinds {
+				entry.SupportedKinds = append(entry.SupportedKinds, supported.Kind)
+			}
+			entry.Conditions = inventoryConditions("", reported.Conditions)
+			entry.Programmed = summarizeCondition(entry.Conditions, "Programmed")
+		}
+		item.Listeners = append(item.Listeners, entry)
+	}
+
+	for _, ref := range spec.ParentRefs {
+		item.ParentRefs = append(item.ParentRefs, ref.toRef("Gateway", metadata.Namespace))
+	}
+	for _, rule := range spec.Rules {
+		for _, ref := range rule.BackendRefs {
+			item.BackendRefs = append(item.BackendRefs, ref.toRef("Service", metadata.Namespace))
+		}
+	}
+	targets := spec.TargetRefs
+	if spec.TargetRef != nil {
+		targets = append([]inventoryRefJSON{*spec.TargetRef}, targets...)
+	}
+	for _, ref := range targets {
+		// Policy targets are always local to the policy's namespace
+		item.TargetRefs = append(item.TargetRefs, ref.toRef("", metadata.Namespace))
+	}
+
+	for _, parent := range status.Parents {
+		ref := parent.ParentRef.toRef("Gateway", metadata.Namespace)
+		item.Conditions = append(item.Conditions, inventoryConditions(ref.String(), parent.Conditions)...)
+	}
+	for _, ancestor := range status.Ancestors {
+		ref := ancestor.AncestorRef.toRef("Gateway", metadata.Namespace)
+		item.Conditions = append(item.Conditions, inventoryConditions(ref.String(), ancestor.Conditions)...)
+	}
+
+	item.Accepted = summarizeCondition(item.Conditions, "Accepted")
+	item.Programmed = summarizeCondition(item.Conditions, "Programmed")
+	item.ResolvedRefs = summarizeCondition(item.Conditions, "ResolvedRefs")
+	return item, nil
+}
+
+// inventoryListOptions reads the namespace, labelSelector and name filters shared by the
+// inventory endpoints. name matches any resource whose name contains it.
+func inventoryListOptions(r *http.Request) (namespace string, opts metav1.ListOptions, name string, err error) {
+	query := r.URL.Query()
+	if selector := query.Get("labelSelector"); selector != "" {
+		if _, err := labels.Parse(selector); err != nil {
+			return "", opts, "", fmt.Errorf("invalid labelSelector: %v", err)
+		}
+		opts.LabelSelector = selector
+	}
+	return query.Get("namespace"), opts, query.Get("name"), nil
+}
+
+func listInventory(ctx context.Context, kube KubeClient, kind inventoryKind, namespace string, opts metav1.ListOptions, name string) ([]InventoryItem, error) {
+	if !kind.Namespaced {
+		namespace = ""
+	}
+	objects, err := kube.List(ctx, kind.Resource, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]InventoryItem, 0, len(objects))
+	for i := range objects {
+		if name != "" && !strings.Contains(objects[i].GetName(), name) {
+			continue
+		}
+		item, err := normalizeInventoryItem(kind, &objects[i])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Namespace != items[j].Namespace {
+			return items[i].Namespace < items[j].Namespace
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items, nil
+}
+
+// handleInventory lists every inventory kind at once, keyed by kind. Kinds whose CRDs are
+// not installed are left out with a warning. Query parameters: namespace, labelSelector
+// and name.
+func (s *Server) handleInventory(w http.ResponseWriter, r *http.Request) {
+	namespace, opts, name, err := inventoryListOptions(r)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	inventory := make(map[string][]InventoryItem, len(inventoryKinds))
+	var warnings []string
+	for _, kind := range inventoryKinds {
+		items, err := listInventory(r.Context(), kube, kind, namespace, opts, name)
+		if kubeErrorReason(err) == KubeErrorUnknownResource {
+			warnings = append(warnings, fmt.Sprintf("%s is not installed in the cluster", kind.Kind))
+			continue
+		}
+		if err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to list %s: %v", kind.Name, err), kubeErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		inventory[kind.Name] = items
+	}
+
+	response := APIResponse{Success: true, Data: inventory, Warnings: warnings}
+	s.sendResponse(w, response)
+}
+
+// handleListInventory lists one kind, e.g. /inventory/gateways. Query parameters:
+// namespace (all namespaces when empty), labelSelector and name.
+func (s *Server) handleListInventory(w http.ResponseWriter, r *http.Request) {
+	kind, ok := lookupInventoryKind(mux.Vars(r)["kind"])
+	if !ok {
+		s.sendError(w, fmt.Sprintf("Unknown inventory kind %q", mux.Vars(r)["kind"]), http.StatusNotFound)
+		return
+	}
+	namespace, opts, name, err := inventoryListOptions(r)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	items, err := listInventory(r.Context(), kube, kind, namespace, opts, name)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to list %s: %v", kind.Name, err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response := APIResponse{Success: true, Data: items}
+	s.sendResponse(w, response)
+}
+
+// handleGetInventory returns one resource, e.g. /inventory/gateways/eg?namespace=default.
+// namespace defaults to the context's namespace.
+func (s *Server) handleGetInventory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kind, ok := lookupInventoryKind(vars["kind"])
+	if !ok {
+		s.sendError(w, fmt.Sprintf("Unknown inventory kind %q", vars["kind"]), http.StatusNotFound)
+		return
+	}
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	namespace := ""
+	if kind.Namespaced {
+		namespace = r.URL.Query().Get("namespace")
+		if namespace == "" {
+			namespace = kube.Target().namespaceOrDefault()
+		}
+	}
+
+	object, err := kube.Get(r.Context(), kind.Resource, namespace, vars["name"])
+	if err != nil {
+		s.sendError(w, err.Error(), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	item, err := normalizeInventoryItem(kind, object)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := APIResponse{Success: true, Data: item}
+	s.sendResponse(w, response)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func testGateway(namespace, name string, labels map[string]string, accepted string) *unstructured.Unstructured {
+	gateway := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "Gateway",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"gatewayClassName": "eg",
+			"listeners": []interface{}{
+				map[string]interface{}{"name": "http", "port": int64(80), "protocol": "HTTP"},
+			},
+		},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Accepted", "status": accepted},
+			},
+		},
+	}}
+	gateway.SetLabels(labels)
+	return gateway
+}
+
+func inventoryItems(t *testing.T, data interface{}) []InventoryItem {
+	t.Helper()
+	encoded, _ := json.Marshal(data)
+	var items []InventoryItem
+	if err := json.Unmarshal(encoded, &items); err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestListInventory(t *testing.T) {
+	kube := newFakeKubeClient(
+		testGateway("default", "eg", map[string]string{"app": "web"}, "True"),
+		testGateway("default", "internal", nil, "False"),
+		testGateway("staging", "eg", map[string]string{"app": "web"}, "True"),
+	)
+	s := newTestServer(t, kube)
+
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{"/inventory/gateways", []string{"default/eg", "default/internal", "staging/eg"}},
+		{"/inventory/Gateway?namespace=default", []string{"default/eg", "default/internal"}},
+		{"/inventory/gateway?labelSelector=app%3Dweb", []string{"default/eg", "staging/eg"}},
+		{"/inventory/gateways?name=intern", []string{"default/internal"}},
+	}
+	for _, test := range tests {
+		status, response := serve(t, s, http.MethodGet, test.target, "")
+		if status != http.StatusOK || !response.Success {
+			t.Errorf("%s: status = %d, response = %+v", test.target, status, response)
+			continue
+		}
+		var got []string
+		for _, item := range inventoryItems(t, response.Data) {
+			got = append(got, item.Namespace+"/"+item.Name)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.target, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got %v, want %v", test.target, got, test.want)
+				break
+			}
+		}
+	}
+
+	items := inventoryItems(t, mustServe(t, s, "/inventory/gateways?namespace=default&name=internal").Data)
+	if len(items) != 1 || items[0].Accepted == nil || *items[0].Accepted {
+		t.Errorf("internal Gateway accepted = %v, want false", items)
+	}
+}
+
+func TestListInventoryErrors(t *testing.T) {
+	s := newTestServer(t, newFakeKubeClient())
+
+	status, _ := serve(t, s, http.MethodGet, "/inventory/widgets", "")
+	if status != http.StatusNotFound {
+		t.Errorf("unknown kind: status = %d, want %d", status, http.StatusNotFound)
+	}
+	status, _ = serve(t, s, http.MethodGet, "/inventory/gateways?labelSelector=%3D%3D", "")
+	if status != http.StatusBadRequest {
+		t.Errorf("bad selector: status = %d, want %d", status, http.StatusBadRequest)
+	}
+
+	kube := newFakeKubeClient()
+	kube.errs["list"] = &meta.NoKindMatchError{GroupKind: schema.GroupKind{Group: "gateway.networking.k8s.io", Kind: "TLSRoute"}}
+	s = newTestServer(t, kube)
+	status, _ = serve(t, s, http.MethodGet, "/inventory/tlsroutes", "")
+	if status != http.StatusNotFound {
+		t.Errorf("CRD not installed: status = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestGetInventory(t *testing.T) {
+	s := newTestServer(t, newFakeKubeClient(testGateway("default", "eg", nil, "True")))
+
+	// The namespace defaults to the context's, which is "default" when unset
+	response := mustServe(t, s, "/inventory/gateways/eg")
+	encoded, _ := json.Marshal(response.Data)
+	var item InventoryItem
+	if err := json.Unmarshal(encoded, &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Name != "eg" || item.Kind != "Gateway" || len(item.Listeners) != 1 || item.Accepted == nil || !*item.Accepted {
+		t.Errorf("item = %+v", item)
+	}
+
+	status, _ := serve(t, s, http.MethodGet, "/inventory/gateways/eg?namespace=staging", "")
+	if status != http.StatusNotFound {
+		t.Errorf("missing Gateway: status = %d, want %d", status, http.StatusNotFound)
+	}
+}
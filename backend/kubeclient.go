@@ -0,0 +1,577 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// fieldManager identifies this backend in managedFields for server-side apply
+const fieldManager = "envoy-gateway-extension"
+
+// kubeRequestTimeout bounds every API request that is not a log stream or watch
+const kubeRequestTimeout = 30 * time.Second
+
+// KubeClient is everything the handlers need from the cluster. Resources are named the
+// way kubectl names them: "httproute", "svc" or "gateways.gateway.networking.k8s.io".
+// Errors are returned as *KubeError.
+type KubeClient interface {
+	// Apply server-side applies every object in a multi-document YAML or JSON stream and
+	// returns the objects as the API server stored them (or would store them, on dry run).
+	// Fields owned by another manager are a Conflict unless ctx was made withForceApply.
+	Apply(ctx context.Context, manifest string, dryRun bool) ([]*unstructured.Unstructured, error)
+	Get(ctx context.Context, resource, namespace, name string) (*unstructured.Unstructured, error)
+	// List returns the objects in namespace, or in all namespaces when namespace is ""
+	List(ctx context.Context, resource, namespace string, opts metav1.ListOptions) ([]unstructured.Unstructured, error)
+	// ListWithVersion is List that also returns the list's resourceVersion, to Watch from
+	ListWithVersion(ctx context.Context, resource, namespace string, opts metav1.ListOptions) ([]unstructured.Unstructured, string, error)
+	// Watch streams changes after opts.ResourceVersion. It has no request timeout; it ends
+	// when ctx is cancelled or the API server closes it.
+	Watch(ctx context.Context, resource, namespace string, opts metav1.ListOptions) (watch.Interface, error)
+	Delete(ctx context.Context, resource, namespace, name string) error
+	Patch(ctx context.Context, resource, namespace, name string, patchType types.PatchType, patch []byte) (*unstructured.Unstructured, error)
+	PodLogs(ctx context.Context, namespace, pod string, opts *corev1.PodLogOptions) (io.ReadCloser, error)
+	ServerVersion() (string, error)
+	// APIProxy returns a handler that forwards requests to the API server with the
+	// client's credentials, which is what `kubectl proxy` does, with the same default
+	// host and path filters
+	APIProxy() (http.Handler, error)
+	// Kubectl runs the kubectl CLI against the same kubeconfig and context, for the
+	// free-form /kubectl endpoint that has no API equivalent
+	Kubectl(ctx context.Context, args ...string) ([]byte, error)
+	// KubectlCommand prepares the same kubectl invocation for long-running commands such
+	// as port-forward, which the caller starts and stops itself
+	KubectlCommand(ctx context.Context, args ...string) *exec.Cmd
+	// ResourceName resolves a resource name to its canonical "plural.group" form, e.g.
+	// "svc" to "services" and "httproute" to "httproutes.gateway.networking.k8s.io"
+	ResourceName(resource string) (string, error)
+	// Target names the kubeconfig context and cluster the client talks to
+	Target() KubeTarget
+}
+
+type KubeErrorReason string
+
+const (
+	KubeErrorNotFound        KubeErrorReason = "NotFound"
+	KubeErrorAlreadyExists   KubeErrorReason = "AlreadyExists"
+	KubeErrorConflict        KubeErrorReason = "Conflict"
+	KubeErrorInvalid         KubeErrorReason = "Invalid"
+	KubeErrorForbidden       KubeErrorReason = "Forbidden"
+	KubeErrorUnauthorized    KubeErrorReason = "Unauthorized"
+	KubeErrorUnknownResource KubeErrorReason = "UnknownResource"
+	KubeErrorUnreachable     KubeErrorReason = "Unreachable"
+	KubeErrorTimeout         KubeErrorReason = "Timeout"
+	KubeErrorOther           KubeErrorReason = "Other"
+)
+
+// KubeError is a classified failure from the API server or from reaching it
+type KubeError struct {
+	Reason    KubeErrorReason
+	Op        string // "get", "apply", ...
+	Resource  string
+	Namespace string
+	Name      string
+	Err       error
+}
+
+func (e *KubeError) Error() string {
+	target := e.Resource
+	if e.Name != "" {
+		target += " " + e.Name
+		if e.Namespace != "" {
+			target = fmt.Sprintf("%s %s/%s", e.Resource, e.Namespace, e.Name)
+		}
+	}
+	if e.Reason == KubeErrorUnreachable {
+		return "cannot connect to Kubernetes cluster - please ensure Kubernetes is enabled in Docker Desktop and the cluster is running"
+	}
+	return fmt.Sprintf("%s %s: %v", e.Op, strings.TrimSpace(target), e.Err)
+}
+
+func (e *KubeError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus maps the reason to the status code a handler should answer with
+func (e *KubeError) HTTPStatus() int {
+	switch e.Reason {
+	case KubeErrorNotFound, KubeErrorUnknownResource:
+		return http.StatusNotFound
+	case KubeErrorAlreadyExists, KubeErrorConflict:
+		return http.StatusConflict
+	case KubeErrorInvalid:
+		return http.StatusUnprocessableEntity
+	case KubeErrorForbidden:
+		return http.StatusForbidden
+	case KubeErrorUnauthorized:
+		return http.StatusUnauthorized
+	case KubeErrorUnreachable:
+		return http.StatusServiceUnavailable
+	case KubeErrorTimeout:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// kubeErrorReason returns the reason of a *KubeError anywhere in err's chain, or "" if
+// err did not come from the KubeClient
+func kubeErrorReason(err error) KubeErrorReason {
+	var kubeErr *KubeError
+	if errors.As(err, &kubeErr) {
+		return kubeErr.Reason
+	}
+	return ""
+}
+
+func isKubeNotFound(err error) bool {
+	return kubeErrorReason(err) == KubeErrorNotFound
+}
+
+// kubeErrorStatus picks the status code for err, falling back when it is not a KubeError
+func kubeErrorStatus(err error, fallback int) int {
+	var kubeErr *KubeError
+	if errors.As(err, &kubeErr) {
+		return kubeErr.HTTPStatus()
+	}
+	return fallback
+}
+
+func wrapKubeError(err error, op, resource, namespace, name string) error {
+	if err == nil {
+		return nil
+	}
+	kubeErr := &KubeError{Reason: KubeErrorOther, Op: op, Resource: resource, Namespace: namespace, Name: name, Err: err}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	switch {
+	case apierrors.IsNotFound(err):
+		kubeErr.Reason = KubeErrorNotFound
+	case apierrors.IsAlreadyExists(err):
+		kubeErr.Reason = KubeErrorAlreadyExists
+	case apierrors.IsConflict(err):
+		kubeErr.Reason = KubeErrorConflict
+	case apierrors.IsInvalid(err), apierrors.IsBadRequest(err):
+		kubeErr.Reason = KubeErrorInvalid
+	case apierrors.IsForbidden(err):
+		kubeErr.Reason = KubeErrorForbidden
+	case apierrors.IsUnauthorized(err):
+		kubeErr.Reason = KubeErrorUnauthorized
+	case meta.IsNoMatchError(err):
+		kubeErr.Reason = KubeErrorUnknownResource
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err), errors.Is(err, context.DeadlineExceeded):
+		kubeErr.Reason = KubeErrorTimeout
+	case errors.As(err, &netErr), errors.As(err, &urlErr):
+		kubeErr.Reason = KubeErrorUnreachable
+	}
+	return kubeErr
+}
+
+// kubeClient implements KubeClient with client-go's dynamic client. Resource names are
+// resolved through discovery, which is cached and refreshed when a name is unknown so
+// that CRDs installed after startup are picked up.
+type kubeClient struct {
+	kubeconfigPath string
+	target         KubeTarget
+	config         *rest.Config
+	dynamic        dynamic.Interface
+	clientset      kubernetes.Interface
+	mapper         *restmapper.DeferredDiscoveryRESTMapper
+	resources      meta.RESTMapper
+}
+
+// newKubeClient builds a client for target from the parsed kubeconfig. kubeconfigPath is
+// the matching single-context file that kubectl is pointed at.
+func newKubeClient(kubeconfig *clientcmdapi.Config, kubeconfigPath string, target KubeTarget) (*kubeClient, error) {
+	config, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, target.Context, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load context %s from kubeconfig: %v", target.Context, err)
+	}
+	config.Timeout = kubeRequestTimeout
+	config.UserAgent = fieldManager
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	cachedDiscovery := memory.NewMemCacheClient(clientset.Discovery())
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(cachedDiscovery)
+
+	return &kubeClient{
+		kubeconfigPath: kubeconfigPath,
+		target:         target,
+		config:         config,
+		dynamic:        dynamicClient,
+		clientset:      clientset,
+		mapper:         mapper,
+		resources:      restmapper.NewShortcutExpander(mapper, cachedDiscovery, nil),
+	}, nil
+}
+
+// resolve turns a kubectl-style resource name into its REST mapping
+func (c *kubeClient) resolve(resource string) (*meta.RESTMapping, error) {
+	mapping, err := c.resolveOnce(resource)
+	if meta.IsNoMatchError(err) {
+		c.mapper.Reset()
+		mapping, err = c.resolveOnce(resource)
+	}
+	return mapping, err
+}
+
+func (c *kubeClient) resolveOnce(resource string) (*meta.RESTMapping, error) {
+	fullySpecified, groupResource := schema.ParseResourceArg(strings.ToLower(resource))
+	gvr := schema.GroupVersionResource{}
+	var err error
+	if fullySpecified != nil {
+		gvr, err = c.resources.ResourceFor(*fullySpecified)
+	}
+	if fullySpecified == nil || err != nil {
+		gvr, err = c.resources.ResourceFor(groupResource.WithVersion(""))
+		if err != nil {
+			return nil, err
+		}
+	}
+	gvk, err := c.resources.KindFor(gvr)
+	if err != nil {
+		return nil, err
+	}
+	return c.resources.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+func (c *kubeClient) mappingForKind(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		c.mapper.Reset()
+		mapping, err = c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	return mapping, err
+}
+
+func (c *kubeClient) resourceInterface(mapping *meta.RESTMapping, namespace string) dynamic.ResourceInterface {
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return c.dynamic.Resource(mapping.Resource).Namespace(namespace)
+	}
+	return c.dynamic.Resource(mapping.Resource)
+}
+
+type forceApplyKey struct{}
+
+// withForceApply makes applies under ctx take over fields owned by other managers, such
+// as kubectl or a controller, instead of failing with a Conflict
+func withForceApply(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceApplyKey{}, true)
+}
+
+func forceApplyFrom(ctx context.Context) bool {
+	force, _ := ctx.Value(forceApplyKey{}).(bool)
+	return force
+}
+
+// forceApplyMiddleware lets a request opt in to forced applies with force=true
+func forceApplyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if force, _ := strconv.ParseBool(r.URL.Query().Get("force")); force {
+			r = r.WithContext(withForceApply(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *kubeClient) Apply(ctx context.Context, manifest string, dryRun bool) ([]*unstructured.Unstructured, error) {
+	objects, err := decodeManifest(manifest)
+	if err != nil {
+		return nil, &KubeError{Reason: KubeErrorInvalid, Op: "apply", Resource: "manifest", Err: err}
+	}
+
+	options := metav1.PatchOptions{FieldManager: fieldManager}
+	if forceApplyFrom(ctx) {
+		options.Force = boolPtr(true)
+	}
+	if dryRun {
+		options.DryRun = []string{metav1.DryRunAll}
+	}
+
+	applied := make([]*unstructured.Unstructured, 0, len(objects))
+	for _, object := range objects {
+		gvk := object.GroupVersionKind()
+		kind := strings.ToLower(gvk.Kind)
+		mapping, err := c.mappingForKind(gvk)
+		if err != nil {
+			return applied, wrapKubeError(err, "apply", kind, object.GetNamespace(), object.GetName())
+		}
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace && object.GetNamespace() == "" {
+			object.SetNamespace(c.target.namespaceOrDefault())
+		}
+
+		data, err := json.Marshal(object.Object)
+		if err != nil {
+			return applied, err
+		}
+		result, err := c.resourceInterface(mapping, object.GetNamespace()).
+			Patch(ctx, object.GetName(), types.ApplyPatchType, data, options)
+		if apierrors.IsConflict(err) {
+			err = fmt.Errorf("%w; repeat the request with force=true to take these fields over", err)
+		}
+		if err != nil {
+			return applied, wrapKubeError(err, "apply", kind, object.GetNamespace(), object.GetName())
+		}
+		applied = append(applied, result)
+	}
+	return applied, nil
+}
+
+func (c *kubeClient) Get(ctx context.Context, resource, namespace, name string) (*unstructured.Unstructured, error) {
+	mapping, err := c.resolve(resource)
+	if err != nil {
+		return nil, wrapKubeError(err, "get", resource, namespace, name)
+	}
+	object, err := c.resourceInterface(mapping, namespace).Get(ctx, name, metav1.GetOptions{})
+	return object, wrapKubeError(err, "get", resource, namespace, name)
+}
+
+func (c *kubeClient) List(ctx context.Context, resource, namespace string, opts metav1.ListOptions) ([]unstructured.Unstructured, error) {
+	items, _, err := c.ListWithVersion(ctx, resource, namespace, opts)
+	return items, err
+}
+
+func (c *kubeClient) ListWithVersion(ctx context.Context, resource, namespace string, opts metav1.ListOptions) ([]unstructured.Unstructured, string, error) {
+	mapping, err := c.resolve(resource)
+	if err != nil {
+		return nil, "", wrapKubeError(err, "list", resource, namespace, "")
+	}
+	list, err := c.resourceInterface(mapping, namespace).List(ctx, opts)
+	if err != nil {
+		return nil, "", wrapKubeError(err, "list", resource, namespace, "")
+	}
+	return list.Items, list.GetResourceVersion(), nil
+}
+
+func (c *kubeClient) Watch(ctx context.Context, resource, namespace string, opts metav1.ListOptions) (watch.Interface, error) {
+	mapping, err := c.resolve(resource)
+	if err != nil {
+		return nil, wrapKubeError(err, "watch", resource, namespace, "")
+	}
+	// Watches outlive the client's request timeout, so they go through a client without one
+	config := rest.CopyConfig(c.config)
+	config.Timeout = 0
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	var resourceClient dynamic.ResourceInterface = dynamicClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		resourceClient = dynamicClient.Resource(mapping.Resource).Namespace(namespace)
+	}
+	watcher, err := resourceClient.Watch(ctx, opts)
+	return watcher, wrapKubeError(err, "watch", resource, namespace, "")
+}
+
+func (c *kubeClient) Delete(ctx context.Context, resource, namespace, name string) error {
+	mapping, err := c.resolve(resource)
+	if err != nil {
+		return wrapKubeError(err, "delete", resource, namespace, name)
+	}
+	err = c.resourceInterface(mapping, namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	return wrapKubeError(err, "delete", resource, namespace, name)
+}
+
+func (c *kubeClient) Patch(ctx context.Context, resource, namespace, name string, patchType types.PatchType, patch []byte) (*unstructured.Unstructured, error) {
+	mapping, err := c.resolve(resource)
+	if err != nil {
+		return nil, wrapKubeError(err, "patch", resource, namespace, name)
+	}
+	object, err := c.resourceInterface(mapping, namespace).
+		Patch(ctx, name, patchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
+	return object, wrapKubeError(err, "patch", resource, namespace, name)
+}
+
+func (c *kubeClient) PodLogs(ctx context.Context, namespace, pod string, opts *corev1.PodLogOptions) (io.ReadCloser, error) {
+	// Log streams outlive the client's request timeout, so they get a client without one
+	config := rest.CopyConfig(c.config)
+	config.Timeout = 0
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(pod, opts).Stream(ctx)
+	return stream, wrapKubeError(err, "logs", "pod", namespace, pod)
+}
+
+func (c *kubeClient) ServerVersion() (string, error) {
+	version, err := c.clientset.Discovery().ServerVersion()
+	if err != nil {
+		return "", wrapKubeError(err, "connect", "cluster", "", "")
+	}
+	return version.GitVersion, nil
+}
+
+func (c *kubeClient) APIProxy() (http.Handler, error) {
+	target, err := url.Parse(c.config.Host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API server address %q: %v", c.config.Host, err)
+	}
+	transport, err := rest.TransportFor(c.config)
+	if err != nil {
+		return nil, err
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = transport
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = target.Host
+	}
+	return &proxyFilter{next: proxy}, nil
+}
+
+// The defaults of `kubectl proxy`: only loopback Host headers are accepted, so a web page
+// cannot reach the proxy through DNS rebinding, and exec and attach into pods are refused
+var (
+	proxyAcceptHosts = []*regexp.Regexp{
+		regexp.MustCompile(`^localhost$`),
+		regexp.MustCompile(`^127\.0\.0\.1$`),
+		regexp.MustCompile(`^\[?::1\]?$`),
+	}
+	proxyRejectPaths = []*regexp.Regexp{
+		regexp.MustCompile(`^/api/.*/pods/.*/exec`),
+		regexp.MustCompile(`^/api/.*/pods/.*/attach`),
+	}
+)
+
+type proxyFilter struct {
+	next http.Handler
+}
+
+func (f *proxyFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if !matchesAny(proxyAcceptHosts, host) || matchesAny(proxyRejectPaths, r.URL.Path) {
+		log.Printf("API proxy rejecting %s %s from host %q", r.Method, r.URL.Path, r.Host)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	f.next.ServeHTTP(w, r)
+}
+
+func matchesAny(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *kubeClient) ResourceName(resource string) (string, error) {
+	mapping, err := c.resolve(resource)
+	if err != nil {
+		return "", wrapKubeError(err, "resolve", resource, "", "")
+	}
+	return mapping.Resource.GroupResource().String(), nil
+}
+
+func (c *kubeClient) Target() KubeTarget {
+	return c.target
+}
+
+func (c *kubeClient) Kubectl(ctx context.Context, args ...string) ([]byte, error) {
+	return c.KubectlCommand(ctx, args...).CombinedOutput()
+}
+
+func (c *kubeClient) KubectlCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "kubectl", append([]string{"--context", c.target.Context}, args...)...)
+	cmd.Env = append(os.Environ(), "KUBECONFIG="+c.kubeconfigPath)
+	return cmd
+}
+
+// decodeManifest splits a YAML or JSON stream into objects, expanding List kinds and
+// skipping empty documents
+func decodeManifest(manifest string) ([]*unstructured.Unstructured, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewBufferString(manifest), 4096)
+	var objects []*unstructured.Unstructured
+	for {
+		var document map[string]interface{}
+		if err := decoder.Decode(&document); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse manifest: %v", err)
+		}
+		if len(document) == 0 {
+			continue
+		}
+
+		object := &unstructured.Unstructured{Object: document}
+		if object.IsList() {
+			list, err := object.ToList()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %v", object.GetKind(), err)
+			}
+			for i := range list.Items {
+				objects = append(objects, &list.Items[i])
+			}
+			continue
+		}
+		if object.GetKind() == "" || object.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("every document needs apiVersion and kind")
+		}
+		if object.GetName() == "" {
+			return nil, fmt.Errorf("%s has no metadata.name", object.GetKind())
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// decodeInto converts an object returned by the KubeClient into a typed struct with JSON tags
+func decodeInto(object interface{}, into interface{}) error {
+	if u, ok := object.(*unstructured.Unstructured); ok {
+		object = u.Object
+	}
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, into)
+}
+
+func boolPtr(value bool) *bool {
+	return &value
+}
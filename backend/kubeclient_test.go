@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestWrapKubeErrorStatus(t *testing.T) {
+	gatewayResource := schema.GroupResource{Group: "gateway.networking.k8s.io", Resource: "gateways"}
+	gatewayKind := schema.GroupKind{Group: "gateway.networking.k8s.io", Kind: "Gateway"}
+
+	tests := []struct {
+		name   string
+		err    error
+		reason KubeErrorReason
+		status int
+	}{
+		{"not found", apierrors.NewNotFound(gatewayResource, "eg"), KubeErrorNotFound, http.StatusNotFound},
+		{"already exists", apierrors.NewAlreadyExists(gatewayResource, "eg"), KubeErrorAlreadyExists, http.StatusConflict},
+		{"conflict", apierrors.NewConflict(gatewayResource, "eg", errors.New("changed")), KubeErrorConflict, http.StatusConflict},
+		{"invalid", apierrors.NewInvalid(gatewayKind, "eg", field.ErrorList{field.Required(field.NewPath("spec"), "")}), KubeErrorInvalid, http.StatusUnprocessableEntity},
+		{"bad request", apierrors.NewBadRequest("bad"), KubeErrorInvalid, http.StatusUnprocessableEntity},
+		{"forbidden", apierrors.NewForbidden(gatewayResource, "eg", errors.New("no")), KubeErrorForbidden, http.StatusForbidden},
+		{"unauthorized", apierrors.NewUnauthorized("expired"), KubeErrorUnauthorized, http.StatusUnauthorized},
+		{"no match", &meta.NoKindMatchError{GroupKind: gatewayKind}, KubeErrorUnknownResource, http.StatusNotFound},
+		{"server timeout", apierrors.NewServerTimeout(gatewayResource, "get", 1), KubeErrorTimeout, http.StatusGatewayTimeout},
+		{"deadline", fmt.Errorf("request: %w", context.DeadlineExceeded), KubeErrorTimeout, http.StatusGatewayTimeout},
+		{"unreachable", &url.Error{Op: "Get", URL: "https://cluster.test", Err: errors.New("connection refused")}, KubeErrorUnreachable, http.StatusServiceUnavailable},
+		{"other", errors.New("boom"), KubeErrorOther, http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := wrapKubeError(test.err, "get", "gateways", "default", "eg")
+			if reason := kubeErrorReason(err); reason != test.reason {
+				t.Errorf("reason = %s, want %s", reason, test.reason)
+			}
+			if status := kubeErrorStatus(err, http.StatusTeapot); status != test.status {
+				t.Errorf("status = %d, want %d", status, test.status)
+			}
+			if !errors.Is(err, test.err) {
+				t.Errorf("wrapped error does not unwrap to %v", test.err)
+			}
+		})
+	}
+
+	if err := wrapKubeError(nil, "get", "gateways", "default", "eg"); err != nil {
+		t.Errorf("wrapKubeError(nil) = %v, want nil", err)
+	}
+	if status := kubeErrorStatus(errors.New("not from the client"), http.StatusTeapot); status != http.StatusTeapot {
+		t.Errorf("kubeErrorStatus of a plain error = %d, want the fallback", status)
+	}
+}
+
+func TestKubeErrorMessage(t *testing.T) {
+	err := wrapKubeError(errors.New("boom"), "delete", "certificates.cert-manager.io", "default", "web")
+	if got, want := err.Error(), "delete certificates.cert-manager.io default/web: boom"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestProxyFilter(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	proxy := &proxyFilter{next: next}
+
+	tests := []struct {
+		host   string
+		path   string
+		status int
+	}{
+		{"localhost:8001", "/api/v1/namespaces/default/pods", http.StatusOK},
+		{"127.0.0.1:8001", "/apis/gateway.networking.k8s.io/v1/gateways", http.StatusOK},
+		{"[::1]:8001", "/version", http.StatusOK},
+		{"evil.example:8001", "/api/v1/pods", http.StatusForbidden},
+		{"localhost:8001", "/api/v1/namespaces/default/pods/web/exec", http.StatusForbidden},
+		{"localhost:8001", "/api/v1/namespaces/default/pods/web/attach", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "http://"+test.host+test.path, nil)
+		recorder := httptest.NewRecorder()
+		proxy.ServeHTTP(recorder, request)
+		if recorder.Code != test.status {
+			t.Errorf("%s%s: status = %d, want %d", test.host, test.path, recorder.Code, test.status)
+		}
+	}
+}
+
+func TestForceApplyMiddleware(t *testing.T) {
+	for target, want := range map[string]bool{"/apply-yaml": false, "/apply-yaml?force=true": true, "/apply-yaml?force=no": false} {
+		var forced bool
+		handler := forceApplyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forced = forceApplyFrom(r.Context())
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, target, nil))
+		if forced != want {
+			t.Errorf("%s: forced = %v, want %v", target, forced, want)
+		}
+	}
+
+	// The hint added to apply conflicts keeps them classified as conflicts
+	conflict := apierrors.NewConflict(schema.GroupResource{Resource: "gateways"}, "eg", errors.New("conflict with \"kubectl\""))
+	err := wrapKubeError(fmt.Errorf("%w; repeat the request with force=true", conflict), "apply", "gateway", "default", "eg")
+	if status := kubeErrorStatus(err, http.StatusTeapot); status != http.StatusConflict {
+		t.Errorf("status = %d, want %d", status, http.StatusConflict)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// defaultLoopbackHost is how the extension's VM reaches API servers that the host's
+// kubeconfig addresses as localhost. KUBECONFIG_LOOPBACK_HOST overrides it.
+const defaultLoopbackHost = "kubernetes.docker.internal"
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// kubeconfigStore reads the mounted kubeconfig and adapts it for use from inside the
+// extension's VM. The source file and the process environment are never modified:
+// clients are built from the parsed config, and kubectl gets a private per-context copy.
+type kubeconfigStore struct {
+	sourcePath   string
+	loopbackHost string
+
+	mutex   sync.Mutex
+	dir     string            // private directory for the per-context files, created on first use
+	written map[string]string // file path -> digest of the content last written there
+}
+
+func newKubeconfigStore() *kubeconfigStore {
+	loopbackHost := os.Getenv("KUBECONFIG_LOOPBACK_HOST")
+	if loopbackHost == "" {
+		loopbackHost = defaultLoopbackHost
+	}
+	return &kubeconfigStore{
+		sourcePath:   os.Getenv("KUBECONFIG"),
+		loopbackHost: loopbackHost,
+		written:      make(map[string]string),
+	}
+}
+
+// load parses the kubeconfig, makes its file references absolute so they survive being
+// copied elsewhere, and points every loopback server at the host
+func (k *kubeconfigStore) load() (*clientcmdapi.Config, error) {
+	if k.sourcePath == "" {
+		return nil, fmt.Errorf("KUBECONFIG environment variable is not set. Please ensure it's configured for the backend service.")
+	}
+	config, err := clientcmd.LoadFromFile(k.sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig %s: %v", k.sourcePath, err)
+	}
+	if err := clientcmd.ResolveLocalPaths(config); err != nil {
+		return nil, fmt.Errorf("failed to resolve paths in kubeconfig %s: %v", k.sourcePath, err)
+	}
+	for name, cluster := range config.Clusters {
+		if err := rewriteLoopbackServer(cluster, k.loopbackHost); err != nil {
+			return nil, fmt.Errorf("cluster %s: %v", name, err)
+		}
+	}
+	return config, nil
+}
+
+// rewriteLoopbackServer replaces a localhost, 127.0.0.0/8 or [::1] server address with
+// host, keeping the port. The API server certificate is issued for the original name, so
+// that name becomes tls-server-name unless the kubeconfig already sets one.
+func rewriteLoopbackServer(cluster *clientcmdapi.Cluster, host string) error {
+	if cluster.Server == "" {
+		return nil
+	}
+	server, err := url.Parse(cluster.Server)
+	if err != nil {
+		return fmt.Errorf("invalid server %q: %v", cluster.Server, err)
+	}
+	hostname := server.Hostname()
+	ip := net.ParseIP(hostname)
+	if hostname != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil
+	}
+
+	if cluster.TLSServerName == "" && !cluster.InsecureSkipTLSVerify {
+		cluster.TLSServerName = hostname
+	}
+	if port := server.Port(); port != "" {
+		server.Host = net.JoinHostPort(host, port)
+	} else {
+		server.Host = host
+	}
+	cluster.Server = server.String()
+	return nil
+}
+
+// contextConfig extracts a self-contained kubeconfig holding only the named context, its
+// cluster and its user
+func contextConfig(config *clientcmdapi.Config, name string) (*clientcmdapi.Config, error) {
+	kubeContext, ok := config.Contexts[name]
+	if !ok {
+		return nil, fmt.Errorf("context %q not found in kubeconfig", name)
+	}
+	result := clientcmdapi.NewConfig()
+	result.CurrentContext = name
+	result.Contexts[name] = kubeContext
+	if cluster, ok := config.Clusters[kubeContext.Cluster]; ok {
+		result.Clusters[kubeContext.Cluster] = cluster
+	}
+	if user, ok := config.AuthInfos[kubeContext.AuthInfo]; ok {
+		result.AuthInfos[kubeContext.AuthInfo] = user
+	}
+	return result, nil
+}
+
+// contextFile writes the named context's kubeconfig for kubectl and returns its path and
+// a digest of its content, which changes whenever the context's server or credentials do.
+// The file is replaced atomically, so a concurrent kubectl never reads a partial config.
+func (k *kubeconfigStore) contextFile(config *clientcmdapi.Config, name string) (string, string, error) {
+	single, err := contextConfig(config, name)
+	if err != nil {
+		return "", "", err
+	}
+	content, err := clientcmd.Write(*single)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to serialise context %s: %v", name, err)
+	}
+	contentSum := sha256.Sum256(content)
+	digest := hex.EncodeToString(contentSum[:])
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.dir == "" {
+		dir, err := os.MkdirTemp("", "envoy-gateway-kubeconfig-")
+		if err != nil {
+			return "", "", fmt.Errorf("failed to create kubeconfig directory: %v", err)
+		}
+		k.dir = dir
+	}
+
+	// Context names may contain "/" or ":", e.g. EKS ARNs, so the hash keeps names unique
+	nameSum := sha256.Sum256([]byte(name))
+	path := filepath.Join(k.dir, fmt.Sprintf("%s-%s.kubeconfig", unsafeFileNameChars.ReplaceAllString(name, "_"), hex.EncodeToString(nameSum[:4])))
+	if k.written[path] == digest {
+		return path, digest, nil
+	}
+
+	if err := writeFileAtomic(path, content); err != nil {
+		return "", "", err
+	}
+	k.written[path] = digest
+	return path, digest, nil
+}
+
+// writeFileAtomic writes content to a temporary file next to path and renames it into
+// place. The file is only readable by this user since it may carry credentials.
+func writeFileAtomic(path string, content []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to write kubeconfig: %v", err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(content); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write kubeconfig: %v", err)
+	}
+	if err := temp.Chmod(0600); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write kubeconfig: %v", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write kubeconfig: %v", err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write kubeconfig: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestRewriteLoopbackServer(t *testing.T) {
+	tests := []struct {
+		name          string
+		cluster       clientcmdapi.Cluster
+		server        string
+		tlsServerName string
+	}{
+		{
+			name:          "localhost",
+			cluster:       clientcmdapi.Cluster{Server: "https://localhost:6443"},
+			server:        "https://kubernetes.docker.internal:6443",
+			tlsServerName: "localhost",
+		},
+		{
+			name:          "loopback range",
+			cluster:       clientcmdapi.Cluster{Server: "https://127.0.0.2:6443"},
+			server:        "https://kubernetes.docker.internal:6443",
+			tlsServerName: "127.0.0.2",
+		},
+		{
+			name:          "ipv6 loopback",
+			cluster:       clientcmdapi.Cluster{Server: "https://[::1]:6443"},
+			server:        "https://kubernetes.docker.internal:6443",
+			tlsServerName: "::1",
+		},
+		{
+			name:          "no port",
+			cluster:       clientcmdapi.Cluster{Server: "https://localhost"},
+			server:        "https://kubernetes.docker.internal",
+			tlsServerName: "localhost",
+		},
+		{
+			name:          "existing tls-server-name",
+			cluster:       clientcmdapi.Cluster{Server: "https://127.0.0.1:6443", TLSServerName: "kind-control-plane"},
+			server:        "https://kubernetes.docker.internal:6443",
+			tlsServerName: "kind-control-plane",
+		},
+		{
+			name:    "insecure",
+			cluster: clientcmdapi.Cluster{Server: "https://127.0.0.1:6443", InsecureSkipTLSVerify: true},
+			server:  "https://kubernetes.docker.internal:6443",
+		},
+		{
+			name:    "remote",
+			cluster: clientcmdapi.Cluster{Server: "https://cluster.example.com:6443"},
+			server:  "https://cluster.example.com:6443",
+		},
+		{
+			name:    "no server",
+			cluster: clientcmdapi.Cluster{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cluster := test.cluster
+			if err := rewriteLoopbackServer(&cluster, defaultLoopbackHost); err != nil {
+				t.Fatal(err)
+			}
+			if cluster.Server != test.server {
+				t.Errorf("server = %q, want %q", cluster.Server, test.server)
+			}
+			if cluster.TLSServerName != test.tlsServerName {
+				t.Errorf("tls-server-name = %q, want %q", cluster.TLSServerName, test.tlsServerName)
+			}
+		})
+	}
+
+	cluster := clientcmdapi.Cluster{Server: "https://%zz"}
+	if err := rewriteLoopbackServer(&cluster, defaultLoopbackHost); err == nil {
+		t.Error("expected an error for an unparseable server")
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// kubeContextHeader makes a single request target another kubeconfig context than the
+// active one. The "context" query parameter does the same for GET links.
+const kubeContextHeader = "X-Kube-Context"
+
+// kubeClusterHeader is set on every response to the cluster the request was sent to
+const kubeClusterHeader = "X-Kube-Cluster"
+
+// KubeTarget identifies the kubeconfig context a request operates on
+type KubeTarget struct {
+	Context   string `json:"context"`
+	Cluster   string `json:"cluster"`
+	Server    string `json:"server,omitempty"`
+	Namespace string `json:"namespace,omitempty"` // the context's default namespace
+	User      string `json:"user,omitempty"`
+}
+
+func (t KubeTarget) namespaceOrDefault() string {
+	if t.Namespace == "" {
+		return "default"
+	}
+	return t.Namespace
+}
+
+type KubeContextInfo struct {
+	KubeTarget
+	Current bool `json:"current"` // the kubeconfig's current-context
+	Active  bool `json:"active"`  // the context this backend uses when a request names none
+}
+
+type kubeContextKey struct{}
+
+func withKubeContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, kubeContextKey{}, name)
+}
+
+func kubeContextFrom(ctx context.Context) string {
+	name, _ := ctx.Value(kubeContextKey{}).(string)
+	return name
+}
+
+// kubeContextMiddleware applies the per-request context override and reports the target
+// context and cluster in the response headers, which sendResponse and sendError copy into
+// the body. An unknown override is rejected before any handler runs.
+func (s *Server) kubeContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(kubeContextHeader)
+		if name == "" {
+			name = r.URL.Query().Get("context")
+		}
+		if name != "" {
+			r = r.WithContext(withKubeContext(r.Context(), name))
+		}
+
+		target, err := s.kubeTarget(r.Context())
+		if err == nil {
+			w.Header().Set(kubeContextHeader, target.Context)
+			w.Header().Set(kubeClusterHeader, target.Cluster)
+		} else if name != "" {
+			s.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleListKubeContexts(w http.ResponseWriter, r *http.Request) {
+	config, err := s.loadKubeconfig()
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	active := s.activeKubeContext(config)
+	names := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	contexts := make([]KubeContextInfo, 0, len(names))
+	for _, name := range names {
+		target, _ := kubeTargetFor(config, name)
+		contexts = append(contexts, KubeContextInfo{
+			KubeTarget: target,
+			Current:    name == config.CurrentContext,
+			Active:     name == active,
+		})
+	}
+
+	response := APIResponse{Success: true, Data: contexts}
+	s.sendResponse(w, response)
+}
+
+// handleSelectKubeContext sets the context used by requests that do not name one. An
+// empty name goes back to the kubeconfig's current-context. The kubeconfig file itself is
+// not modified.
+func (s *Server) handleSelectKubeContext(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Context string `json:"context"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	config, err := s.loadKubeconfig()
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	name := req.Context
+	if name == "" {
+		name = config.CurrentContext
+	}
+	target, err := kubeTargetFor(config, name)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.kubeMutex.Lock()
+	s.kubeContext = req.Context
+	s.kubeMutex.Unlock()
+
+	// Report the newly selected target rather than the one the middleware resolved
+	w.Header().Set(kubeContextHeader, target.Context)
+	w.Header().Set(kubeClusterHeader, target.Cluster)
+	response := APIResponse{Success: true, Data: target}
+	s.sendResponse(w, response)
+}
+
+// loadKubeconfig parses the mounted kubeconfig, adapted for access from the VM
+func (s *Server) loadKubeconfig() (*clientcmdapi.Config, error) {
+	return s.kubeconfigs.load()
+}
+
+func (s *Server) activeKubeContext(config *clientcmdapi.Config) string {
+	s.kubeMutex.Lock()
+	defer s.kubeMutex.Unlock()
+	if s.kubeContext != "" {
+		return s.kubeContext
+	}
+	return config.CurrentContext
+}
+
+// kubeTarget resolves the context for ctx: the request's override, else the context
+// selected through /kube-context, else the kubeconfig's current-context
+func (s *Server) kubeTarget(ctx context.Context) (KubeTarget, error) {
+	_, target, err := s.resolveKubeContext(ctx)
+	return target, err
+}
+
+func (s *Server) resolveKubeContext(ctx context.Context) (*clientcmdapi.Config, KubeTarget, error) {
+	config, err := s.loadKubeconfig()
+	if err != nil {
+		return nil, KubeTarget{}, err
+	}
+	name := kubeContextFrom(ctx)
+	if name == "" {
+		name = s.activeKubeContext(config)
+	}
+	if name == "" {
+		return nil, KubeTarget{}, fmt.Errorf("kubeconfig has no current-context; select one with POST /kube-context")
+	}
+	target, err := kubeTargetFor(config, name)
+	return config, target, err
+}
+
+func kubeTargetFor(config *clientcmdapi.Config, name string) (KubeTarget, error) {
+	kubeContext, ok := config.Contexts[name]
+	if !ok {
+		return KubeTarget{}, fmt.Errorf("context %q not found in kubeconfig", name)
+	}
+	target := KubeTarget{
+		Context:   name,
+		Cluster:   kubeContext.Cluster,
+		Namespace: kubeContext.Namespace,
+		User:      kubeContext.AuthInfo,
+	}
+	if cluster, ok := config.Clusters[kubeContext.Cluster]; ok {
+		target.Server = cluster.Server
+	}
+	return target, nil
+}
+
+type cachedKubeClient struct {
+	client KubeClient
+	digest string // of the context's kubeconfig the client was built from
+}
+
+// kubeClient returns the client for the context ctx resolves to. Clients are reused until
+// the context's entry in the kubeconfig changes.
+func (s *Server) kubeClient(ctx context.Context) (KubeClient, error) {
+	config, target, err := s.resolveKubeContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	kubeconfigPath, digest, err := s.kubeconfigs.contextFile(config, target.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	s.kubeMutex.Lock()
+	defer s.kubeMutex.Unlock()
+	if cached, ok := s.kubeClients[target.Context]; ok && cached.digest == digest {
+		return cached.client, nil
+	}
+	client, err := newKubeClient(config, kubeconfigPath, target)
+	if err != nil {
+		return nil, err
+	}
+	audited := &auditedKubeClient{KubeClient: client, audit: s.audit}
+	s.kubeClients[target.Context] = &cachedKubeClient{client: audited, digest: digest}
+	return audited, nil
+}
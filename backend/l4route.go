@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type L4RouteFormData struct {
+	Name       string              `json:"name"`
+	Namespace  string              `json:"namespace"`
+	ParentRefs []ParentRefFormData `json:"parentRefs"`
+	Rules      []L4RuleFormData    `json:"rules"`
+}
+
+type ParentRefFormData struct {
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace,omitempty"`
+	SectionName string `json:"sectionName,omitempty"`
+	Port        int    `json:"port,omitempty"`
+}
+
+type L4RuleFormData struct {
+	BackendRefs []HTTPBackendRefFormData `json:"backendRefs"`
+}
+
+// l4RouteProtocols maps each L4 route kind, including TLSRoute, to the listener protocol it can attach to
+var l4RouteProtocols = map[string]string{
+	"TCPRoute": "TCP",
+	"UDPRoute": "UDP",
+	"TLSRoute": "TLS",
+}
+
+func (s *Server) handleCreateTCPRoute(w http.ResponseWriter, r *http.Request) {
+	s.handleCreateL4Route(w, r, "TCPRoute")
+}
+
+func (s *Server) handleCreateUDPRoute(w http.ResponseWriter, r *http.Request) {
+	s.handleCreateL4Route(w, r, "UDPRoute")
+}
+
+func (s *Server) handleCreateL4Route(w http.ResponseWriter, r *http.Request, kind string) {
+	var routeData L4RouteFormData
+	if err := json.NewDecoder(r.Body).Decode(&routeData); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if errs := validateL4RouteFormData(routeData); len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+
+	if err := s.validateRouteParentRefs(r.Context(), kind, routeData.Namespace, routeData.ParentRefs); err != nil {
+		s.sendError(w, err.Error(), kubeErrorStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	yamlContent, err := s.generateL4RouteYAML(kind, routeData)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to generate %s YAML: %v", kind, err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, strings.ToLower(kind)); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply %s: %v", kind, err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Data:    fmt.Sprintf("%s %s created successfully in namespace %s", kind, routeData.Name, routeData.Namespace),
+	}
+	s.sendResponse(w, response)
+}
+
+// validateRouteParentRefs checks that every parent Gateway exposes a listener whose
+// protocol matches the route kind, so a TCPRoute is never attached to a UDP listener.
+// Failures to read a Gateway are wrapped, so that callers can report them with
+// kubeErrorStatus; any other error is a listener mismatch.
+func (s *Server) validateRouteParentRefs(ctx context.Context, kind, routeNamespace string, parentRefs []ParentRefFormData) error {
+	protocol := l4RouteProtocols[kind]
+
+	for i, parentRef := range parentRefs {
+		namespace := parentRef.Namespace
+		if namespace == "" {
+			namespace = routeNamespace
+		}
+
+		listeners, err := s.getGatewayListeners(ctx, namespace, parentRef.Name)
+		if err != nil {
+			return fmt.Errorf("parentRefs[%d]: %w", i, err)
+		}
+
+		matched := false
+		for _, listener := range listeners {
+			if parentRef.SectionName != "" && listener.Name != parentRef.SectionName {
+				continue
+			}
+			if parentRef.Port != 0 && listener.Port != parentRef.Port {
+				continue
+			}
+			if parentRef.SectionName != "" && listener.Protocol != protocol {
+				return fmt.Errorf("parentRefs[%d]: listener %s on Gateway %s/%s uses protocol %s, but %s requires %s",
+					i, listener.Name, namespace, parentRef.Name, listener.Protocol, kind, protocol)
+			}
+			if listener.Protocol == protocol {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			if parentRef.SectionName != "" {
+				return fmt.Errorf("parentRefs[%d]: Gateway %s/%s has no listener named %s", i, namespace, parentRef.Name, parentRef.SectionName)
+			}
+			return fmt.Errorf("parentRefs[%d]: Gateway %s/%s has no %s listener for %s", i, namespace, parentRef.Name, protocol, kind)
+		}
+	}
+	return nil
+}
+
+// getGatewayListeners reads the listeners of an existing Gateway from the cluster
+func (s *Server) getGatewayListeners(ctx context.Context, namespace, name string) ([]Listener, error) {
+	kube, err := s.kubeClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig setup failed: %v", err)
+	}
+
+	object, err := kube.Get(ctx, "gateways.gateway.networking.k8s.io", namespace, name)
+	if err != nil {
+		log.Printf("Failed to get Gateway %s/%s: %v", namespace, name, err)
+		return nil, err
+	}
+
+	var gateway struct {
+		Spec struct {
+			Listeners []Listener `json:"listeners"`
+		} `json:"spec"`
+	}
+	if err := decodeInto(object, &gateway); err != nil {
+		return nil, fmt.Errorf("failed to parse Gateway %s/%s: %v", namespace, name, err)
+	}
+	return gateway.Spec.Listeners, nil
+}
+
+func (s *Server) generateL4RouteYAML(kind string, data L4RouteFormData) (string, error) {
+	route := L4RouteResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.networking.k8s.io/v1alpha2", Kind: kind},
+		Metadata: ObjectMeta{Name: data.Name, Namespace: data.Namespace},
+		Spec: L4RouteSpec{
+			ParentRefs: s.convertParentRefs(data.ParentRefs),
+			Rules:      s.convertL4RulesFromFormData(data.Rules),
+		},
+	}
+	return marshalResource(route)
+}
+
+func (s *Server) convertParentRefs(parentRefs []ParentRefFormData) []ParentReference {
+	result := make([]ParentReference, len(parentRefs))
+	for i, ref := range parentRefs {
+		result[i] = ParentReference{
+			Name:        ref.Name,
+			Namespace:   ref.Namespace,
+			SectionName: ref.SectionName,
+			Port:        ref.Port,
+		}
+	}
+	return result
+}
+
+func (s *Server) convertL4RulesFromFormData(rules []L4RuleFormData) []L4RouteRule {
+	result := make([]L4RouteRule, len(rules))
+	for i, rule := range rules {
+		backendRefs := make([]L4BackendRef, len(rule.BackendRefs))
+		for j, ref := range rule.BackendRefs {
+			backendRefs[j] = L4BackendRef{
+				BackendObjectReference: BackendObjectReference{Name: ref.Name, Namespace: ref.Namespace, Port: ref.Port},
+				Weight:                 ref.Weight,
+			}
+		}
+		result[i] = L4RouteRule{BackendRefs: backendRefs}
+	}
+	return result
+}
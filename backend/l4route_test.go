@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestCreateL4RouteStatus(t *testing.T) {
+	gateway := testGateway("default", "eg", nil, "True")
+	gateway.Object["spec"].(map[string]interface{})["listeners"] = []interface{}{
+		map[string]interface{}{"name": "postgres", "port": int64(5432), "protocol": "TCP"},
+		map[string]interface{}{"name": "tls", "port": int64(443), "protocol": "TLS"},
+	}
+	conflict := apierrors.NewConflict(schema.GroupResource{Resource: "tcproutes"}, "db", errors.New("changed"))
+
+	tests := []struct {
+		name     string
+		target   string
+		body     string
+		applyErr error
+		status   int
+	}{
+		{"created", "/create-tcproute", `{"name": "db", "namespace": "default", "parentRefs": [{"name": "eg"}], "rules": [{"backendRefs": [{"name": "db", "port": 5432}]}]}`, nil, http.StatusOK},
+		{"missing gateway", "/create-tcproute", `{"name": "db", "namespace": "default", "parentRefs": [{"name": "other"}], "rules": [{"backendRefs": [{"name": "db", "port": 5432}]}]}`, nil, http.StatusNotFound},
+		{"no UDP listener", "/create-udproute", `{"name": "dns", "namespace": "default", "parentRefs": [{"name": "eg"}], "rules": [{"backendRefs": [{"name": "dns", "port": 53}]}]}`, nil, http.StatusBadRequest},
+		{"protocol mismatch", "/create-tcproute", `{"name": "db", "namespace": "default", "parentRefs": [{"name": "eg", "sectionName": "tls"}], "rules": [{"backendRefs": [{"name": "db", "port": 5432}]}]}`, nil, http.StatusBadRequest},
+		{"apply conflict", "/create-tcproute", `{"name": "db", "namespace": "default", "parentRefs": [{"name": "eg"}], "rules": [{"backendRefs": [{"name": "db", "port": 5432}]}]}`, conflict, http.StatusConflict},
+		{"TLSRoute missing gateway", "/create-tlsroute", `{"name": "db", "namespace": "default", "parentRefs": [{"name": "other"}], "rules": [{"backendRefs": [{"name": "db", "port": 5432}]}]}`, nil, http.StatusNotFound},
+		{"TLSRoute on TCP listener", "/create-tlsroute", `{"name": "db", "namespace": "default", "parentRefs": [{"name": "eg", "sectionName": "postgres"}], "rules": [{"backendRefs": [{"name": "db", "port": 5432}]}]}`, nil, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kube := newFakeKubeClient(gateway)
+			kube.errs["apply"] = test.applyErr
+			s := newTestServer(t, kube)
+
+			status, response := serve(t, s, http.MethodPost, test.target, test.body)
+			if status != test.status {
+				t.Errorf("status = %d, want %d (%+v)", status, test.status, response)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -16,29 +18,52 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
-	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 type Server struct {
 	router       *mux.Router
 	trafficTest  *TrafficTestState
 	portForwards map[string]*PortForwardStatus
+	proxies      map[int]*apiProxy // in-process API proxies by local port
+	canary       *CanaryRollout
+	kubeconfigs  *kubeconfigStore
+	kubeClients  map[string]*cachedKubeClient // by kubeconfig context
+	kubeContext  string                       // selected through /kube-context; "" uses current-context
+	kubeMutex    sync.Mutex
+	policy       *AccessPolicy
+	audit        *auditLog
+	confirms     *confirmationStore // pending /kubectl confirmation tokens
 	mutex        sync.RWMutex
 }
 
 type GatewayFormData struct {
-	Name             string     `json:"name"`
-	Namespace        string     `json:"namespace"`
-	GatewayClassName string     `json:"gatewayClassName"`
-	Listeners        []Listener `json:"listeners"`
+	Name             string                 `json:"name"`
+	Namespace        string                 `json:"namespace"`
+	GatewayClassName string                 `json:"gatewayClassName"`
+	Listeners        []Listener             `json:"listeners"`
+	Addresses        []GatewayAddress       `json:"addresses,omitempty"`
+	Infrastructure   *GatewayInfrastructure `json:"infrastructure,omitempty"`
+}
+
+type GatewayAddress struct {
+	Type  string `json:"type,omitempty" yaml:"type,omitempty"` // "IPAddress" or "Hostname"
+	Value string `json:"value" yaml:"value"`
+}
+
+type GatewayInfrastructure struct {
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
 }
 
 type Listener struct {
-	Name     string `json:"name"`
-	Port     int    `json:"port"`
-	Protocol string `json:"protocol"`
-	Hostname string `json:"hostname,omitempty"`
-	TLS      *TLS   `json:"tls,omitempty"`
+	Name          string         `json:"name"`
+	Port          int            `json:"port"`
+	Protocol      string         `json:"protocol"`
+	Hostname      string         `json:"hostname,omitempty"`
+	TLS           *TLS           `json:"tls,omitempty"`
+	AllowedRoutes *AllowedRoutes `json:"allowedRoutes,omitempty"`
 }
 
 type TLS struct {
@@ -55,16 +80,20 @@ type HTTPRouteFormData struct {
 	Namespace              string             `json:"namespace"`
 	ParentGateway          string             `json:"parentGateway"`
 	ParentGatewayNamespace string             `json:"parentGatewayNamespace"`
+	ParentSectionName      string             `json:"parentSectionName,omitempty"`
+	ParentPort             int                `json:"parentPort,omitempty"`
 	Hostnames              []string           `json:"hostnames"`
 	Rules                  []HTTPRuleFormData `json:"rules"`
+	CreateReferenceGrants  bool               `json:"createReferenceGrants,omitempty"`
 }
 
 type HTTPRuleFormData struct {
-	Name                  string                   `json:"name,omitempty"`
-	Matches               []HTTPRouteMatchFormData `json:"matches"`
-	BackendRefs           []HTTPBackendRefFormData `json:"backendRefs"`
-	RequestTimeout        string                   `json:"requestTimeout,omitempty"`
-	BackendRequestTimeout string                   `json:"backendRequestTimeout,omitempty"`
+	Name                  string                    `json:"name,omitempty"`
+	Matches               []HTTPRouteMatchFormData  `json:"matches"`
+	Filters               []HTTPRouteFilterFormData `json:"filters,omitempty"`
+	BackendRefs           []HTTPBackendRefFormData  `json:"backendRefs"`
+	RequestTimeout        string                    `json:"requestTimeout,omitempty"`
+	BackendRequestTimeout string                    `json:"backendRequestTimeout,omitempty"`
 }
 
 type HTTPRouteMatchFormData struct {
@@ -88,9 +117,49 @@ type HTTPRouteQueryParamFormData struct {
 }
 
 type HTTPBackendRefFormData struct {
-	Name   string `json:"name"`
-	Port   int    `json:"port"`
-	Weight int    `json:"weight"`
+	Name      string                    `json:"name"`
+	Namespace string                    `json:"namespace,omitempty"`
+	Port      int                       `json:"port"`
+	Weight    *int                      `json:"weight,omitempty"` // nil leaves the API default; 0 drains the backend
+	Filters   []HTTPRouteFilterFormData `json:"filters,omitempty"`
+}
+
+type HTTPRouteFilterFormData struct {
+	Type                   string                     `json:"type"` // "RequestHeaderModifier", "ResponseHeaderModifier", "RequestRedirect", "URLRewrite" or "RequestMirror"
+	RequestHeaderModifier  *HeaderModifierFormData    `json:"requestHeaderModifier,omitempty"`
+	ResponseHeaderModifier *HeaderModifierFormData    `json:"responseHeaderModifier,omitempty"`
+	RequestRedirect        *HTTPRedirectFormData      `json:"requestRedirect,omitempty"`
+	URLRewrite             *HTTPURLRewriteFormData    `json:"urlRewrite,omitempty"`
+	RequestMirror          *HTTPRequestMirrorFormData `json:"requestMirror,omitempty"`
+}
+
+type HTTPRedirectFormData struct {
+	Scheme     string                    `json:"scheme,omitempty"`
+	Hostname   string                    `json:"hostname,omitempty"`
+	Port       int                       `json:"port,omitempty"`
+	Path       *HTTPPathModifierFormData `json:"path,omitempty"`
+	StatusCode int                       `json:"statusCode,omitempty"` // 301 or 302
+}
+
+type HTTPURLRewriteFormData struct {
+	Hostname string                    `json:"hostname,omitempty"`
+	Path     *HTTPPathModifierFormData `json:"path,omitempty"`
+}
+
+type HTTPRequestMirrorFormData struct {
+	BackendRef HTTPBackendRefFormData  `json:"backendRef"`
+	Percent    int                     `json:"percent,omitempty"`  // share of requests to mirror, 0-100
+	Fraction   *MirrorFractionFormData `json:"fraction,omitempty"` // used instead of percent for finer ratios
+}
+
+type MirrorFractionFormData struct {
+	Numerator   int `json:"numerator"`
+	Denominator int `json:"denominator,omitempty"`
+}
+
+type HTTPPathModifierFormData struct {
+	Type  string `json:"type"` // "ReplaceFullPath" or "ReplacePrefixMatch"
+	Value string `json:"value"`
 }
 
 // Legacy structures for backward compatibility
@@ -116,9 +185,16 @@ type BackendRef struct {
 type ProxyStatus struct {
 	IsRunning bool   `json:"isRunning"`
 	Port      int    `json:"port"`
+	Context   string `json:"context,omitempty"` // the kubeconfig context the proxy runs against; empty when started elsewhere
 	PID       string `json:"pid,omitempty"`
 }
 
+// apiProxy is an API proxy started by /start-proxy
+type apiProxy struct {
+	server  *http.Server
+	context string
+}
+
 type PortForwardRequest struct {
 	ServiceName string `json:"serviceName"`
 	Namespace   string `json:"namespace"`
@@ -134,14 +210,20 @@ type PortForwardStatus struct {
 	ServicePort  int    `json:"servicePort"`
 	LocalPort    int    `json:"localPort"`
 	ResourceType string `json:"resourceType"`
+	Context      string `json:"context,omitempty"` // the kubeconfig context the forward runs against
 	PID          string `json:"pid,omitempty"`
 	URL          string `json:"url,omitempty"`
 }
 
 type APIResponse struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Success  bool         `json:"success"`
+	Data     interface{}  `json:"data,omitempty"`
+	Error    string       `json:"error,omitempty"`
+	Warnings []string     `json:"warnings,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+	// KubeContext and KubeCluster name the kubeconfig context and cluster the request used
+	KubeContext string `json:"kubeContext,omitempty"`
+	KubeCluster string `json:"kubeCluster,omitempty"`
 }
 
 type CertificateFormData struct {
@@ -164,14 +246,15 @@ type Certificate struct {
 }
 
 type TrafficTestConfig struct {
-	TargetURL   string            `json:"targetUrl"`
-	RPS         int               `json:"rps"`
-	Duration    int               `json:"duration"`
-	Headers     map[string]string `json:"headers,omitempty"`
-	Method      string            `json:"method"`
-	Body        string            `json:"body,omitempty"`
-	Timeout     int               `json:"timeout"`
-	Connections int               `json:"connections"`
+	TargetURL   string               `json:"targetUrl"`
+	RPS         int                  `json:"rps"`
+	Duration    int                  `json:"duration"`
+	Headers     map[string]string    `json:"headers,omitempty"`
+	Method      string               `json:"method"`
+	Body        string               `json:"body,omitempty"`
+	Timeout     int                  `json:"timeout"`
+	Connections int                  `json:"connections"`
+	Mirror      *TrafficMirrorConfig `json:"mirror,omitempty"`
 }
 
 type TrafficMetrics struct {
@@ -189,33 +272,66 @@ type TrafficMetrics struct {
 	Errors          []string       `json:"errors"`
 	RPS             float64        `json:"rps"`
 	IsRunning       bool           `json:"isRunning"`
+	Mirror          *MirrorMetrics `json:"mirror,omitempty"`
 }
 
 type TrafficTestState struct {
 	config      TrafficTestConfig
 	startTime   time.Time
 	stopChan    chan bool
+	done        chan struct{}
 	metrics     TrafficMetrics
 	mutex       sync.RWMutex
 	isRunning   bool
 	responses   []time.Duration
 	statusCodes map[string]int
 	errors      []string
+	mirror      *MirrorMetrics
+	// mirrorKube reads the mirror pods' logs in the cluster the test was started against
+	mirrorKube KubeClient
 }
 
 func NewServer() *Server {
 	s := &Server{
 		router:       mux.NewRouter(),
 		portForwards: make(map[string]*PortForwardStatus),
+		proxies:      make(map[int]*apiProxy),
+		kubeconfigs:  newKubeconfigStore(),
+		kubeClients:  make(map[string]*cachedKubeClient),
+		policy:       loadAccessPolicy(),
+		audit:        newAuditLog(),
+		confirms:     newConfirmationStore(),
 	}
 	s.setupRoutes()
 	return s
 }
 
 func (s *Server) setupRoutes() {
+	s.router.Use(s.kubeContextMiddleware, s.auditMiddleware, forceApplyMiddleware)
 	s.router.HandleFunc("/health", s.handleHealth).Methods("GET")
-	s.router.HandleFunc("/create-gateway", s.handleCreateGateway).Methods("POST")
-	s.router.HandleFunc("/create-httproute", s.handleCreateHTTPRoute).Methods("POST")
+	s.router.HandleFunc("/policy", s.handleGetPolicy).Methods("GET")
+	s.router.HandleFunc("/audit", s.handleAudit).Methods("GET")
+	s.router.HandleFunc("/kube-contexts", s.handleListKubeContexts).Methods("GET")
+	s.router.HandleFunc("/kube-context", s.handleSelectKubeContext).Methods("POST")
+	s.router.HandleFunc("/create-gateway", s.mutatingWithPreview(s.handleCreateGateway)).Methods("POST")
+	s.router.HandleFunc("/create-httproute", s.mutatingWithPreview(s.handleCreateHTTPRoute)).Methods("POST")
+	s.router.HandleFunc("/create-grpcroute", s.mutating(s.handleCreateGRPCRoute)).Methods("POST")
+	s.router.HandleFunc("/create-tcproute", s.mutating(s.handleCreateTCPRoute)).Methods("POST")
+	s.router.HandleFunc("/create-udproute", s.mutating(s.handleCreateUDPRoute)).Methods("POST")
+	s.router.HandleFunc("/create-tlsroute", s.mutating(s.handleCreateTLSRoute)).Methods("POST")
+	s.router.HandleFunc("/list-gatewayclasses", s.handleListGatewayClasses).Methods("GET")
+	s.router.HandleFunc("/inventory", s.handleInventory).Methods("GET")
+	s.router.HandleFunc("/inventory/{kind}", s.handleListInventory).Methods("GET")
+	s.router.HandleFunc("/inventory/{kind}/{name}", s.handleGetInventory).Methods("GET")
+	s.router.HandleFunc("/watch", s.handleWatch).Methods("GET")
+	s.router.HandleFunc("/create-gatewayclass", s.mutating(s.handleCreateGatewayClass)).Methods("POST")
+	s.router.HandleFunc("/create-envoyproxy", s.mutating(s.handleCreateEnvoyProxy)).Methods("POST")
+	s.router.HandleFunc("/create-security-policy", s.mutating(s.handleCreateSecurityPolicy)).Methods("POST")
+	s.router.HandleFunc("/create-backend-traffic-policy", s.mutating(s.handleCreateBackendTrafficPolicy)).Methods("POST")
+	s.router.HandleFunc("/create-client-traffic-policy", s.mutating(s.handleCreateClientTrafficPolicy)).Methods("POST")
+	s.router.HandleFunc("/create-backend-tls-policy", s.mutating(s.handleCreateBackendTLSPolicy)).Methods("POST")
+	s.router.HandleFunc("/create-envoy-patch-policy", s.mutating(s.handleCreateEnvoyPatchPolicy)).Methods("POST")
+	s.router.HandleFunc("/create-envoy-extension-policy", s.mutating(s.handleCreateEnvoyExtensionPolicy)).Methods("POST")
 	s.router.HandleFunc("/start-proxy", s.handleStartProxy).Methods("POST")
 	s.router.HandleFunc("/stop-proxy", s.handleStopProxy).Methods("POST")
 	s.router.HandleFunc("/proxy-status", s.handleProxyStatus).Methods("GET")
@@ -224,21 +340,29 @@ func (s *Server) setupRoutes() {
 	s.router.HandleFunc("/stop-port-forward", s.handleStopPortForward).Methods("POST")
 	s.router.HandleFunc("/port-forward-status", s.handlePortForwardStatus).Methods("GET")
 	s.router.HandleFunc("/list-port-forwards", s.handleListPortForwards).Methods("GET")
-	s.router.HandleFunc("/apply-template", s.handleApplyTemplate).Methods("POST")
-	s.router.HandleFunc("/apply-yaml", s.handleApplyYAML).Methods("POST")
+	s.router.HandleFunc("/apply-template", s.mutatingWithPreview(s.handleApplyTemplate)).Methods("POST")
+	s.router.HandleFunc("/apply-yaml", s.mutatingWithPreview(s.handleApplyYAML)).Methods("POST")
 	s.router.HandleFunc("/kubectl", s.handleKubectl).Methods("POST")
-	s.router.HandleFunc("/create-certificate", s.handleCreateCertificate).Methods("POST")
+	s.router.HandleFunc("/kubectl-stream", s.handleKubectlStream).Methods("GET", "POST")
+	s.router.HandleFunc("/pod-logs", s.handleStreamPodLogs).Methods("GET")
+	s.router.HandleFunc("/gateway-logs", s.handleStreamGatewayLogs).Methods("GET")
+	s.router.HandleFunc("/create-certificate", s.mutatingWithPreview(s.handleCreateCertificate)).Methods("POST")
 	s.router.HandleFunc("/list-certificates", s.handleListCertificates).Methods("GET")
-	s.router.HandleFunc("/delete-certificate", s.handleDeleteCertificate).Methods("DELETE")
+	s.router.HandleFunc("/delete-certificate", s.mutating(s.handleDeleteCertificate)).Methods("DELETE")
 	s.router.HandleFunc("/start-traffic-test", s.handleStartTrafficTest).Methods("POST")
 	s.router.HandleFunc("/stop-traffic-test", s.handleStopTrafficTest).Methods("POST")
 	s.router.HandleFunc("/traffic-metrics", s.handleTrafficMetrics).Methods("GET")
+	s.router.HandleFunc("/start-canary", s.mutating(s.handleStartCanary)).Methods("POST")
+	s.router.HandleFunc("/canary-status", s.handleCanaryStatus).Methods("GET")
+	s.router.HandleFunc("/abort-canary", s.mutating(s.handleAbortCanary)).Methods("POST")
+	s.router.HandleFunc("/route-rollout", s.mutating(s.handleRouteRollout)).Methods("POST")
+	s.router.HandleFunc("/revert-route-rollout", s.mutating(s.handleRevertRouteRollout)).Methods("POST")
 	s.router.HandleFunc("/http-request", s.handleHTTPRequest).Methods("POST")
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	response := APIResponse{Success: true, Data: "Backend service is running"}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) handleCreateGateway(w http.ResponseWriter, r *http.Request) {
@@ -248,15 +372,25 @@ func (s *Server) handleCreateGateway(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if errs := validateGatewayFormData(gatewayData); len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+
 	yamlContent, err := s.generateGatewayYAML(gatewayData)
 	if err != nil {
 		s.sendError(w, fmt.Sprintf("Failed to generate Gateway YAML: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	if err := s.applyYAML(yamlContent, "gateway"); err != nil {
+	if isDryRun(r) {
+		s.sendPreview(w, r, yamlContent, nil)
+		return
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, "gateway"); err != nil {
 		log.Printf("handleCreateGateway: Error from s.applyYAML for Gateway '%s': %v", gatewayData.Name, err)
-		s.sendError(w, fmt.Sprintf("Failed to apply Gateway: %v", err), http.StatusInternalServerError)
+		s.sendError(w, fmt.Sprintf("Failed to apply Gateway: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
 		return
 	}
 	log.Printf("handleCreateGateway: Successfully applied YAML for Gateway '%s'. Sending success response.", gatewayData.Name)
@@ -265,7 +399,7 @@ func (s *Server) handleCreateGateway(w http.ResponseWriter, r *http.Request) {
 		Success: true,
 		Data:    fmt.Sprintf("Gateway %s created successfully in namespace %s", gatewayData.Name, gatewayData.Namespace),
 	}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) handleCreateHTTPRoute(w http.ResponseWriter, r *http.Request) {
@@ -275,22 +409,60 @@ func (s *Server) handleCreateHTTPRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if errs := validateHTTPRouteFormData(routeData); len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+
 	yamlContent, err := s.generateHTTPRouteYAML(routeData)
 	if err != nil {
 		s.sendError(w, fmt.Sprintf("Failed to generate HTTPRoute YAML: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	if err := s.applyYAML(yamlContent, "httproute"); err != nil {
-		s.sendError(w, fmt.Sprintf("Failed to apply HTTPRoute: %v", err), http.StatusInternalServerError)
+	// Warn, but do not block, when the parent listener would not accept this route
+	warnings := s.checkAllowedRoutes(r.Context(), "HTTPRoute", routeData.Namespace, httpRouteParentRef(routeData))
+
+	// Cross-namespace backendRefs only resolve once a ReferenceGrant exists in the target namespace
+	var grantYAMLs []string
+	for _, target := range crossNamespaceBackendRefs(routeData) {
+		if !routeData.CreateReferenceGrants {
+			warnings = append(warnings, fmt.Sprintf("Services %s in namespace %s need a ReferenceGrant; set createReferenceGrants to create it",
+				strings.Join(target.Services, ", "), target.Namespace))
+			continue
+		}
+
+		grantYAML, err := s.generateReferenceGrantYAML(r.Context(), "HTTPRoute", routeData.Namespace, target)
+		if err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to generate ReferenceGrant YAML: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+		grantYAMLs = append(grantYAMLs, grantYAML)
+	}
+
+	if isDryRun(r) {
+		s.sendPreview(w, r, joinYAMLDocuments(append(grantYAMLs, yamlContent)...), warnings)
+		return
+	}
+
+	for _, grantYAML := range grantYAMLs {
+		if err := s.applyYAML(r.Context(), grantYAML, "referencegrant"); err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to apply ReferenceGrant: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, "httproute"); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply HTTPRoute: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
 		return
 	}
 
 	response := APIResponse{
-		Success: true,
-		Data:    fmt.Sprintf("HTTPRoute %s created successfully in namespace %s", routeData.Name, routeData.Namespace),
+		Success:  true,
+		Data:     fmt.Sprintf("HTTPRoute %s created successfully in namespace %s", routeData.Name, routeData.Namespace),
+		Warnings: warnings,
 	}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) handleStartProxy(w http.ResponseWriter, r *http.Request) {
@@ -301,71 +473,68 @@ func (s *Server) handleStartProxy(w http.ResponseWriter, r *http.Request) {
 		req.Port = 8001
 	}
 
-	log.Printf("Starting kubectl proxy on port %d", req.Port)
+	log.Printf("Starting API proxy on port %d", req.Port)
 
-	// Check if proxy is already running
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		log.Printf("Kubeconfig setup failed: %v", err)
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	kubeContext := kube.Target().Context
+
+	// Check if proxy is already running. The port can only serve one context, so a proxy
+	// for another one is reported as a conflict rather than reused.
 	if status := s.getProxyStatus(req.Port); status.IsRunning {
+		if status.Context != kubeContext {
+			owner := "a process outside the backend"
+			if status.Context != "" {
+				owner = "context " + status.Context
+			}
+			s.sendError(w, fmt.Sprintf("Port %d already serves an API proxy for %s; stop it or pick another port", req.Port, owner), http.StatusConflict)
+			return
+		}
 		log.Printf("Proxy already running on port %d", req.Port)
 		response := APIResponse{Success: true, Data: status}
-		json.NewEncoder(w).Encode(response)
+		s.sendResponse(w, response)
 		return
 	}
 
-	// Ensure kubeconfig is properly configured
-	if err := s.ensureKubeconfig(); err != nil {
-		log.Printf("Kubeconfig setup failed: %v", err)
-		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+	// Test connectivity first
+	if _, err := kube.ServerVersion(); err != nil {
+		log.Printf("Cluster connectivity check failed: %v", err)
+		s.sendError(w, fmt.Sprintf("Cannot connect to Kubernetes cluster: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
 		return
 	}
 
-	// Test kubectl connectivity first
-	testCmd := exec.Command("kubectl", "cluster-info")
-	// Set the same environment as proxy command
-	kubeconfigPath := os.Getenv("KUBECONFIG")
-	if kubeconfigPath == "" {
-		kubeconfigPath = "/host/.kube/config"
-	}
-	testCmd.Env = append(os.Environ(), "KUBECONFIG="+kubeconfigPath)
-	
-	if output, err := testCmd.CombinedOutput(); err != nil {
-		log.Printf("kubectl cluster-info failed: %v, output: %s", err, string(output))
-		s.sendError(w, fmt.Sprintf("Cannot connect to Kubernetes cluster: %v. Output: %s", err, string(output)), http.StatusInternalServerError)
+	proxy, err := kube.APIProxy()
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to start API proxy: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Start kubectl proxy
-	cmd := exec.Command("kubectl", "proxy", "--port="+strconv.Itoa(req.Port))
-	// Set the same kubeconfig environment
-	cmd.Env = append(os.Environ(), "KUBECONFIG="+kubeconfigPath)
-	
-	log.Printf("Starting kubectl proxy with command: %v", cmd.Args)
-	if err := cmd.Start(); err != nil {
-		log.Printf("Failed to start kubectl proxy process: %v", err)
-		s.sendError(w, fmt.Sprintf("Failed to start kubectl proxy: %v", err), http.StatusInternalServerError)
+	// Bind before answering so that a port in use is reported to the caller
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", req.Port))
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to start API proxy: %v", err), http.StatusConflict)
 		return
 	}
+	server := &http.Server{Handler: s.auditedAPIProxy(proxy, kube, req.Port)}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("API proxy on port %d stopped: %v", req.Port, err)
+		}
+	}()
 
-	log.Printf("kubectl proxy started with PID: %d", cmd.Process.Pid)
-
-	// Save PID for later termination
-	pidFile := fmt.Sprintf("/tmp/kubectl-proxy-%d.pid", req.Port)
-	if err := ioutil.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)), 0644); err != nil {
-		log.Printf("Warning: Could not save PID file: %v", err)
-	}
-
-	// Wait a moment to ensure proxy starts
-	time.Sleep(2 * time.Second)
+	s.mutex.Lock()
+	s.proxies[req.Port] = &apiProxy{server: server, context: kubeContext}
+	s.mutex.Unlock()
 
 	status := s.getProxyStatus(req.Port)
 	log.Printf("Proxy status after start: running=%v, port=%d", status.IsRunning, status.Port)
-	
-	if !status.IsRunning {
-		s.sendError(w, "Kubectl proxy started but is not responding on the expected port", http.StatusInternalServerError)
-		return
-	}
 
 	response := APIResponse{Success: true, Data: status}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) handleStopProxy(w http.ResponseWriter, r *http.Request) {
@@ -376,19 +545,33 @@ func (s *Server) handleStopProxy(w http.ResponseWriter, r *http.Request) {
 		req.Port = 8001
 	}
 
-	pidFile := fmt.Sprintf("/tmp/kubectl-proxy-%d.pid", req.Port)
-	pidBytes, err := ioutil.ReadFile(pidFile)
+	target, err := s.kubeTarget(r.Context())
 	if err != nil {
-		// Try to kill any kubectl proxy process
-		exec.Command("pkill", "-f", "kubectl proxy").Run()
-	} else {
-		pid := strings.TrimSpace(string(pidBytes))
-		exec.Command("kill", pid).Run()
-		os.Remove(pidFile)
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
 	}
 
+	// Only the proxy serving the request's context is stopped, like handleStartProxy
+	// only reuses one
+	s.mutex.Lock()
+	proxy, exists := s.proxies[req.Port]
+	if exists && proxy.context == target.Context {
+		delete(s.proxies, req.Port)
+	}
+	s.mutex.Unlock()
+
+	if !exists {
+		s.sendError(w, fmt.Sprintf("No API proxy started by the backend is running on port %d", req.Port), http.StatusNotFound)
+		return
+	}
+	if proxy.context != target.Context {
+		s.sendError(w, fmt.Sprintf("The API proxy on port %d serves context %s, not %s", req.Port, proxy.context, target.Context), http.StatusConflict)
+		return
+	}
+	proxy.server.Close()
+
 	response := APIResponse{Success: true, Data: "Proxy stopped"}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) handleProxyStatus(w http.ResponseWriter, r *http.Request) {
@@ -401,7 +584,7 @@ func (s *Server) handleProxyStatus(w http.ResponseWriter, r *http.Request) {
 
 	status := s.getProxyStatus(port)
 	response := APIResponse{Success: true, Data: status}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) handleTestProxy(w http.ResponseWriter, r *http.Request) {
@@ -417,15 +600,14 @@ func (s *Server) handleTestProxy(w http.ResponseWriter, r *http.Request) {
 	if !status.IsRunning {
 		response := APIResponse{
 			Success: false,
-			Error:   "Kubectl proxy is not running",
+			Error:   "API proxy is not running",
 		}
-		json.NewEncoder(w).Encode(response)
+		s.sendResponse(w, response)
 		return
 	}
 
-	// Test connectivity by making a request to the proxy
-	cmd := exec.Command("curl", "-s", "-m", "5", fmt.Sprintf("http://localhost:%d/api/v1", port))
-	output, err := cmd.CombinedOutput()
+	// Test connectivity by making a request through the proxy
+	output, err := proxyGet(port)
 
 	testResult := map[string]interface{}{
 		"proxyRunning": true,
@@ -438,7 +620,7 @@ func (s *Server) handleTestProxy(w http.ResponseWriter, r *http.Request) {
 		testResult["error"] = err.Error()
 	} else {
 		testResult["connectivity"] = true
-		testResult["message"] = "Kubectl proxy is working correctly"
+		testResult["message"] = "API proxy is working correctly"
 		if len(output) > 100 {
 			testResult["response"] = string(output)[:100] + "..."
 		} else {
@@ -447,7 +629,7 @@ func (s *Server) handleTestProxy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := APIResponse{Success: true, Data: testResult}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) handleApplyTemplate(w http.ResponseWriter, r *http.Request) {
@@ -459,16 +641,30 @@ func (s *Server) handleApplyTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Use --validate=false and --insecure-skip-tls-verify to bypass validation issues in containerized environment
-	cmd := exec.Command("kubectl", "apply", "-f", req.URL, "--validate=false", "--insecure-skip-tls-verify")
-	output, err := cmd.CombinedOutput()
+	templateYAML, err := fetchTemplate(req.URL)
 	if err != nil {
-		s.sendError(w, fmt.Sprintf("Failed to apply template: %v\nOutput: %s", err, string(output)), http.StatusInternalServerError)
+		s.sendError(w, err.Error(), http.StatusBadGateway)
 		return
 	}
 
-	response := APIResponse{Success: true, Data: string(output)}
-	json.NewEncoder(w).Encode(response)
+	if isDryRun(r) {
+		s.sendPreview(w, r, templateYAML, nil)
+		return
+	}
+
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	applied, err := kube.Apply(r.Context(), templateYAML, false)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply template: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response := APIResponse{Success: true, Data: describeApplied(applied)}
+	s.sendResponse(w, response)
 }
 
 func (s *Server) handleApplyYAML(w http.ResponseWriter, r *http.Request) {
@@ -485,69 +681,68 @@ func (s *Server) handleApplyYAML(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if isDryRun(r) {
+		s.sendPreview(w, r, req.YAML, nil)
+		return
+	}
+
 	// Apply YAML content using the existing applyYAML function
-	if err := s.applyYAMLContent(req.YAML); err != nil {
-		s.sendError(w, fmt.Sprintf("Failed to apply YAML: %v", err), http.StatusInternalServerError)
+	if err := s.applyYAMLContent(r.Context(), req.YAML); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply YAML: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
 		return
 	}
 
 	response := APIResponse{Success: true, Data: "YAML applied successfully"}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
-func (s *Server) applyYAMLContent(yamlContent string) error {
-	// Ensure we have a working kubeconfig
-	if err := s.ensureKubeconfig(); err != nil {
-		// CRITICAL CHANGE: Return error immediately if kubeconfig setup fails
-		log.Printf("Error during ensureKubeconfig: %v. Aborting applyYAMLContent.", err)
-		return fmt.Errorf("kubeconfig setup failed: %v", err)
-	}
-
-	tempFile := filepath.Join("/tmp", fmt.Sprintf("apply-yaml-%d.yaml", time.Now().Unix()))
-
-	if err := ioutil.WriteFile(tempFile, []byte(yamlContent), 0644); err != nil {
-		return fmt.Errorf("failed to write temporary file: %v", err)
-	}
-	defer os.Remove(tempFile)
-
-	// Use --validate=false and --insecure-skip-tls-verify to bypass validation issues in containerized environment
-	cmd := exec.Command("kubectl", "apply", "-f", tempFile, "--validate=false", "--insecure-skip-tls-verify")
-	output, err := cmd.CombinedOutput()
+func (s *Server) applyYAMLContent(ctx context.Context, yamlContent string) error {
+	kube, err := s.kubeClient(ctx)
 	if err != nil {
-		return fmt.Errorf("kubectl apply failed: %v\nOutput: %s", err, string(output))
+		log.Printf("Error during kubeconfig setup: %v. Aborting applyYAMLContent.", err)
+		return fmt.Errorf("kubeconfig setup failed: %v", err)
 	}
 
-	return nil
+	_, err = kube.Apply(ctx, yamlContent, false)
+	return err
 }
 
+// handleKubectl runs a kubectl command against the request's context, subject to the
+// access policy. A command whose verb needs confirming is answered with 428 and a token;
+// repeating the request with that token in confirmToken runs it. Commands that follow
+// their output must go through /kubectl-stream instead.
 func (s *Server) handleKubectl(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Args []string `json:"args"`
-	}
+	var req KubectlRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
-	// For Docker Desktop extension, use kubectl without server override
-	// Let kubectl use the mounted kubeconfig as-is
-	cmd := exec.Command("kubectl", req.Args...)
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
 
-	// Set environment to use the mounted kubeconfig
-	// Use KUBECONFIG environment variable if set, otherwise use default Docker Desktop path
-	kubeconfigPath := os.Getenv("KUBECONFIG")
-	if kubeconfigPath == "" {
-		// Default Docker Desktop kubeconfig path in container
-		kubeconfigPath = "/host/.kube/config"
+	command, entry, ok := s.authorizeKubectl(w, r, kube, req)
+	if !ok {
+		return
+	}
+	if command.Follow {
+		s.sendError(w, fmt.Sprintf("kubectl %s follows its output until cancelled; use /kubectl-stream", command), http.StatusBadRequest)
+		return
 	}
-	cmd.Env = append(os.Environ(), "KUBECONFIG="+kubeconfigPath)
 
-	output, err := cmd.CombinedOutput()
+	output, err := kube.Kubectl(r.Context(), req.Args...)
 
 	// If kubectl fails, try to provide more helpful error context
 	if err != nil {
 		log.Printf("kubectl command failed: %v, output: %s", err, string(output))
 	}
+	if command.mutating() {
+		entry.Result, entry.Error = auditResult(err)
+		s.audit.record(r.Context(), entry)
+	}
 
 	response := APIResponse{
 		Success: err == nil,
@@ -557,166 +752,197 @@ func (s *Server) handleKubectl(w http.ResponseWriter, r *http.Request) {
 		response.Error = err.Error()
 	}
 
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) generateGatewayYAML(data GatewayFormData) (string, error) {
-	gateway := map[string]interface{}{
-		"apiVersion": "gateway.networking.k8s.io/v1",
-		"kind":       "Gateway",
-		"metadata": map[string]interface{}{
-			"name":      data.Name,
-			"namespace": data.Namespace,
-		},
-		"spec": map[string]interface{}{
-			"gatewayClassName": data.GatewayClassName,
-			"listeners":        s.convertListeners(data.Listeners),
-		},
+	gateway := GatewayResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.networking.k8s.io/v1", Kind: "Gateway"},
+		Metadata: ObjectMeta{Name: data.Name, Namespace: data.Namespace},
+		Spec:     s.convertGatewaySpec(data),
 	}
-
-	yamlBytes, err := yaml.Marshal(gateway)
-	if err != nil {
-		return "", err
-	}
-	return string(yamlBytes), nil
+	return marshalResource(gateway)
 }
 
 func (s *Server) generateHTTPRouteYAML(data HTTPRouteFormData) (string, error) {
-	route := map[string]interface{}{
-		"apiVersion": "gateway.networking.k8s.io/v1",
-		"kind":       "HTTPRoute",
-		"metadata": map[string]interface{}{
-			"name":      data.Name,
-			"namespace": data.Namespace,
-		},
-		"spec": map[string]interface{}{
-			"parentRefs": []map[string]interface{}{
-				{
-					"name": data.ParentGateway,
-				},
-			},
-			"hostnames": data.Hostnames,
-			"rules":     s.convertHTTPRulesFromFormData(data.Rules),
+	route := HTTPRouteResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.networking.k8s.io/v1", Kind: "HTTPRoute"},
+		Metadata: ObjectMeta{Name: data.Name, Namespace: data.Namespace},
+		Spec: HTTPRouteSpec{
+			ParentRefs: s.convertParentRefs([]ParentRefFormData{httpRouteParentRef(data)}),
+			Hostnames:  data.Hostnames,
+			Rules:      s.convertHTTPRulesFromFormData(data.Rules),
 		},
 	}
+	return marshalResource(route)
+}
 
-	yamlBytes, err := yaml.Marshal(route)
-	if err != nil {
-		return "", err
+func (s *Server) convertGatewaySpec(data GatewayFormData) GatewaySpec {
+	spec := GatewaySpec{
+		GatewayClassName: data.GatewayClassName,
+		Listeners:        s.convertListeners(data.Listeners),
+		Addresses:        data.Addresses,
+	}
+
+	if data.Infrastructure != nil && (len(data.Infrastructure.Labels) > 0 || len(data.Infrastructure.Annotations) > 0) {
+		spec.Infrastructure = data.Infrastructure
 	}
-	return string(yamlBytes), nil
+
+	return spec
 }
 
-func (s *Server) convertListeners(listeners []Listener) []map[string]interface{} {
-	result := make([]map[string]interface{}, len(listeners))
+func (s *Server) convertListeners(listeners []Listener) []GatewayListener {
+	result := make([]GatewayListener, len(listeners))
 	for i, listener := range listeners {
-		result[i] = map[string]interface{}{
-			"name":     listener.Name,
-			"port":     listener.Port,
-			"protocol": listener.Protocol,
-		}
-		if listener.Hostname != "" {
-			result[i]["hostname"] = listener.Hostname
+		result[i] = GatewayListener{
+			Name:     listener.Name,
+			Hostname: listener.Hostname,
+			Port:     listener.Port,
+			Protocol: listener.Protocol,
 		}
 		if listener.TLS != nil {
-			tls := map[string]interface{}{
-				"mode": listener.TLS.Mode,
-			}
-			if len(listener.TLS.CertificateRefs) > 0 {
-				refs := make([]map[string]interface{}, len(listener.TLS.CertificateRefs))
-				for j, ref := range listener.TLS.CertificateRefs {
-					refs[j] = map[string]interface{}{"name": ref.Name}
-				}
-				tls["certificateRefs"] = refs
+			tls := &GatewayTLSConfig{Mode: listener.TLS.Mode}
+			for _, ref := range listener.TLS.CertificateRefs {
+				tls.CertificateRefs = append(tls.CertificateRefs, SecretObjectReference{Name: ref.Name})
 			}
-			result[i]["tls"] = tls
+			result[i].TLS = tls
+		}
+		if listener.AllowedRoutes != nil {
+			result[i].AllowedRoutes = convertAllowedRoutes(*listener.AllowedRoutes)
 		}
 	}
 	return result
 }
 
-func (s *Server) convertHTTPRulesFromFormData(rules []HTTPRuleFormData) []map[string]interface{} {
-	result := make([]map[string]interface{}, len(rules))
+// convertAllowedRoutes drops the parts of the form the API would ignore or reject:
+// an empty "from", and a selector on anything other than from: Selector
+func convertAllowedRoutes(allowed AllowedRoutes) *AllowedRoutes {
+	result := &AllowedRoutes{Kinds: allowed.Kinds}
+
+	if allowed.Namespaces != nil && allowed.Namespaces.From != "" {
+		result.Namespaces = &RouteNamespaces{From: allowed.Namespaces.From}
+		if allowed.Namespaces.From == "Selector" {
+			result.Namespaces.Selector = allowed.Namespaces.Selector
+		}
+	}
+
+	return result
+}
+
+func (s *Server) convertHTTPRulesFromFormData(rules []HTTPRuleFormData) []HTTPRouteRule {
+	result := make([]HTTPRouteRule, len(rules))
 	for i, rule := range rules {
-		matches := make([]map[string]interface{}, len(rule.Matches))
-		for j, match := range rule.Matches {
-			matchMap := map[string]interface{}{
-				"path": map[string]interface{}{
-					"type":  match.PathType,
-					"value": match.PathValue,
-				},
-			}
+		routeRule := HTTPRouteRule{
+			Name:    rule.Name,
+			Filters: s.convertHTTPFilters(rule.Filters),
+		}
 
-			// Add method if specified
-			if match.Method != "" {
-				matchMap["method"] = match.Method
+		for _, match := range rule.Matches {
+			routeMatch := HTTPRouteMatch{Method: match.Method}
+			if match.PathType != "" || match.PathValue != "" {
+				routeMatch.Path = &HTTPPathMatch{Type: match.PathType, Value: match.PathValue}
 			}
-
-			// Add headers if any
-			if len(match.Headers) > 0 {
-				headers := make([]map[string]interface{}, len(match.Headers))
-				for k, header := range match.Headers {
-					headers[k] = map[string]interface{}{
-						"type":  header.Type,
-						"name":  header.Name,
-						"value": header.Value,
-					}
-				}
-				matchMap["headers"] = headers
+			for _, header := range match.Headers {
+				routeMatch.Headers = append(routeMatch.Headers, HTTPHeaderMatch{
+					Type:  header.Type,
+					Name:  header.Name,
+					Value: header.Value,
+				})
 			}
-
-			// Add query params if any
-			if len(match.QueryParams) > 0 {
-				queryParams := make([]map[string]interface{}, len(match.QueryParams))
-				for k, param := range match.QueryParams {
-					queryParams[k] = map[string]interface{}{
-						"type":  param.Type,
-						"name":  param.Name,
-						"value": param.Value,
-					}
-				}
-				matchMap["queryParams"] = queryParams
+			for _, param := range match.QueryParams {
+				routeMatch.QueryParams = append(routeMatch.QueryParams, HTTPQueryParamMatch{
+					Type:  param.Type,
+					Name:  param.Name,
+					Value: param.Value,
+				})
 			}
-
-			matches[j] = matchMap
+			routeRule.Matches = append(routeRule.Matches, routeMatch)
 		}
 
-		backendRefs := make([]map[string]interface{}, len(rule.BackendRefs))
+		routeRule.BackendRefs = make([]HTTPBackendRef, len(rule.BackendRefs))
 		for j, ref := range rule.BackendRefs {
-			backendRef := map[string]interface{}{
-				"name": ref.Name,
-				"port": ref.Port,
+			routeRule.BackendRefs[j] = HTTPBackendRef{
+				// Cross-namespace backends need a ReferenceGrant in the target namespace
+				BackendObjectReference: BackendObjectReference{Name: ref.Name, Namespace: ref.Namespace, Port: ref.Port},
+				Weight:                 ref.Weight,
+				Filters:                s.convertHTTPFilters(ref.Filters),
 			}
+		}
 
-			// Add weight if specified and not default
-			if ref.Weight > 0 && ref.Weight != 100 {
-				backendRef["weight"] = ref.Weight
+		if rule.RequestTimeout != "" || rule.BackendRequestTimeout != "" {
+			routeRule.Timeouts = &HTTPRouteTimeouts{
+				Request:        rule.RequestTimeout,
+				BackendRequest: rule.BackendRequestTimeout,
 			}
-
-			backendRefs[j] = backendRef
 		}
 
-		ruleMap := map[string]interface{}{
-			"matches":     matches,
-			"backendRefs": backendRefs,
-		}
+		result[i] = routeRule
+	}
+	return result
+}
 
-		// Add timeouts if specified
-		if rule.RequestTimeout != "" {
-			if ruleMap["timeouts"] == nil {
-				ruleMap["timeouts"] = map[string]interface{}{}
+func (s *Server) convertHTTPFilters(filters []HTTPRouteFilterFormData) []HTTPRouteFilter {
+	var result []HTTPRouteFilter
+	for _, filter := range filters {
+		routeFilter := HTTPRouteFilter{Type: filter.Type}
+		switch filter.Type {
+		case "RequestHeaderModifier":
+			routeFilter.RequestHeaderModifier = convertHeaderModifier(filter.RequestHeaderModifier)
+		case "ResponseHeaderModifier":
+			routeFilter.ResponseHeaderModifier = convertHeaderModifier(filter.ResponseHeaderModifier)
+		case "RequestRedirect":
+			if redirect := filter.RequestRedirect; redirect != nil {
+				routeFilter.RequestRedirect = &HTTPRequestRedirectFilter{
+					Scheme:     redirect.Scheme,
+					Hostname:   redirect.Hostname,
+					Path:       convertPathModifier(redirect.Path),
+					Port:       redirect.Port,
+					StatusCode: redirect.StatusCode,
+				}
 			}
-			ruleMap["timeouts"].(map[string]interface{})["request"] = rule.RequestTimeout
-		}
-
-		if rule.BackendRequestTimeout != "" {
-			if ruleMap["timeouts"] == nil {
-				ruleMap["timeouts"] = map[string]interface{}{}
+		case "URLRewrite":
+			if rewrite := filter.URLRewrite; rewrite != nil {
+				routeFilter.URLRewrite = &HTTPURLRewriteFilter{
+					Hostname: rewrite.Hostname,
+					Path:     convertPathModifier(rewrite.Path),
+				}
+			}
+		case "RequestMirror":
+			if mirror := filter.RequestMirror; mirror != nil {
+				requestMirror := &HTTPRequestMirrorFilter{
+					BackendRef: BackendObjectReference{
+						Name:      mirror.BackendRef.Name,
+						Namespace: mirror.BackendRef.Namespace,
+						Port:      mirror.BackendRef.Port,
+					},
+				}
+				// Omitting both percent and fraction mirrors every request
+				if mirror.Percent > 0 {
+					requestMirror.Percent = mirror.Percent
+				} else if mirror.Fraction != nil {
+					requestMirror.Fraction = &MirrorFraction{
+						Numerator:   mirror.Fraction.Numerator,
+						Denominator: mirror.Fraction.Denominator,
+					}
+				}
+				routeFilter.RequestMirror = requestMirror
 			}
-			ruleMap["timeouts"].(map[string]interface{})["backendRequest"] = rule.BackendRequestTimeout
 		}
+		result = append(result, routeFilter)
+	}
+	return result
+}
 
-		result[i] = ruleMap
+func convertPathModifier(path *HTTPPathModifierFormData) *HTTPPathModifier {
+	if path == nil {
+		return nil
+	}
+	result := &HTTPPathModifier{Type: path.Type}
+	switch path.Type {
+	case "ReplaceFullPath":
+		result.ReplaceFullPath = path.Value
+	case "ReplacePrefixMatch":
+		result.ReplacePrefixMatch = path.Value
 	}
 	return result
 }
@@ -751,132 +977,63 @@ func (s *Server) convertHTTPRules(rules []HTTPRule) []map[string]interface{} {
 	return result
 }
 
-func (s *Server) ensureKubeconfig() error {
-	// For Docker Desktop extensions running in containers, we need to update
-	// the kubeconfig to use the accessible server endpoint
-
-	// Read the current kubeconfig
-	kubeconfigPath := os.Getenv("KUBECONFIG")
-	if kubeconfigPath == "" {
-		return fmt.Errorf("KUBECONFIG environment variable is not set. Please ensure it's configured for the backend service.")
-	}
-	//
-	configBytes, err := ioutil.ReadFile(kubeconfigPath)
+func (s *Server) applyYAML(ctx context.Context, yamlContent, resourceType string) error {
+	kube, err := s.kubeClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to read kubeconfig: %v", err)
+		log.Printf("Error during kubeconfig setup: %v. Aborting applyYAML.", err)
+		return fmt.Errorf("kubeconfig setup failed: %v", err)
 	}
 
-	// Replace localhost/127.0.0.1 with kubernetes.docker.internal for container access
-	configStr := string(configBytes)
-
-	// Find the current server URL and replace it with accessible endpoint
-	if strings.Contains(configStr, "127.0.0.1:") {
-		// Extract port from the server URL
-		lines := strings.Split(configStr, "\n")
-		for i, line := range lines {
-			if strings.Contains(line, "server:") && strings.Contains(line, "127.0.0.1:") {
-				// Replace with kubernetes.docker.internal and same port
-				lines[i] = strings.Replace(line, "127.0.0.1:", "kubernetes.docker.internal:", 1)
-				break
-			}
-		}
-		configStr = strings.Join(lines, "\n")
-
-		// Write the modified config to a temporary location for container use
-		tempConfigPath := "/tmp/kubeconfig"
-		if err := ioutil.WriteFile(tempConfigPath, []byte(configStr), 0644); err != nil {
-			return fmt.Errorf("failed to write temporary kubeconfig: %v", err)
-		}
-
-		// Set the environment variable for kubectl to use the modified config
-		os.Setenv("KUBECONFIG", tempConfigPath)
-		log.Printf("Updated kubeconfig to use kubernetes.docker.internal for container access")
+	if _, err := kube.Apply(ctx, yamlContent, false); err != nil {
+		log.Printf("Server-side apply of %s failed: %v", resourceType, err)
+		return err
 	}
-
 	return nil
 }
 
-func (s *Server) applyYAML(yamlContent, resourceType string) error {
-	// Ensure we have a working kubeconfig
-	if err := s.ensureKubeconfig(); err != nil {
-		// CRITICAL CHANGE: Return error immediately if kubeconfig setup fails
-		log.Printf("Error during ensureKubeconfig: %v. Aborting applyYAML.", err)
-		return fmt.Errorf("kubeconfig setup failed: %v", err)
-	}
-
-	tempFile := filepath.Join("/tmp", fmt.Sprintf("%s-%d.yaml", resourceType, time.Now().Unix()))
-
-	if err := ioutil.WriteFile(tempFile, []byte(yamlContent), 0644); err != nil {
-		return fmt.Errorf("failed to write temporary file: %v", err)
-	}
-	defer os.Remove(tempFile)
-
-	// Try server-side apply first, then fall back to client-side apply
-	cmd := exec.Command("kubectl", "apply", "-f", tempFile, "--server-side", "--validate=false", "--force-conflicts", "--insecure-skip-tls-verify")
-	output, err := cmd.CombinedOutput()
-
-	if err != nil {
-		log.Printf("Server-side apply failed, trying client-side: %v", err)
-		// Fallback to client-side apply with validation disabled
-		cmd = exec.Command("kubectl", "apply", "-f", tempFile, "--validate=false", "--force", "--insecure-skip-tls-verify")
-		output, err = cmd.CombinedOutput()
-
-		if err != nil {
-			// Client-side apply also resulted in a non-zero exit code.
-			// BUT, check if the output indicates a success-like state.
-			outputStr := strings.ToLower(string(output))
-			successKeywords := []string{"unchanged", "configured", "created", "applied"}
-			isSuccessLike := false
-			for _, keyword := range successKeywords {
-				if strings.Contains(outputStr, keyword) {
-					isSuccessLike = true
-					log.Printf("kubectl apply for %s reported error but output indicates success ('%s'): %s", resourceType, keyword, string(output))
-					break
-				}
-			}
-
-			if isSuccessLike {
-				return nil // Treat as success despite non-zero exit code
-			}
-
-			// If truly a failure (non-zero exit AND no success-like keywords in output):
-			errorMsg := string(output) // Use 'output' which is cmd.CombinedOutput()
-			if strings.Contains(errorMsg, "connection refused") {
-				return fmt.Errorf("cannot connect to Kubernetes cluster - please ensure Kubernetes is enabled in Docker Desktop and the cluster is running")
-			}
-			return fmt.Errorf("kubectl apply failed: %v\nOutput: %s", err, errorMsg)
+// describeApplied lists the applied objects the way kubectl reports them
+func describeApplied(objects []*unstructured.Unstructured) string {
+	lines := make([]string, 0, len(objects))
+	for _, object := range objects {
+		name := object.GetName()
+		if object.GetNamespace() != "" {
+			name = object.GetNamespace() + "/" + name
 		}
+		lines = append(lines, fmt.Sprintf("%s %s applied", object.GetKind(), name))
 	}
-
-	return nil
+	return strings.Join(lines, "\n")
 }
 
+// getProxyStatus reports the proxy on port and, when the backend started it, the context
+// it serves
 func (s *Server) getProxyStatus(port int) ProxyStatus {
-	// Check if port is responding (kubectl proxy returns various codes but we just need connectivity)
-	cmd := exec.Command("curl", "-s", "-o", "/dev/null", "-w", "%{http_code}",
-		fmt.Sprintf("http://localhost:%d/api/v1", port))
-	output, err := cmd.Output()
-
-	// Accept any HTTP response code as "running" - even errors mean the proxy is responding
-	responseCode := strings.TrimSpace(string(output))
-	isRunning := err == nil && responseCode != "" && responseCode != "000"
-
-	status := ProxyStatus{
-		IsRunning: isRunning,
-		Port:      port,
-	}
+	s.mutex.RLock()
+	proxy, isRunning := s.proxies[port]
+	s.mutex.RUnlock()
 
-	// Try to get PID if running
+	status := ProxyStatus{IsRunning: isRunning, Port: port}
 	if isRunning {
-		pidFile := fmt.Sprintf("/tmp/kubectl-proxy-%d.pid", port)
-		if pidBytes, err := ioutil.ReadFile(pidFile); err == nil {
-			status.PID = strings.TrimSpace(string(pidBytes))
-		}
+		status.Context = proxy.context
+		return status
 	}
 
+	// A proxy started elsewhere on the port counts as well; any HTTP response means it is up
+	_, err := proxyGet(port)
+	status.IsRunning = err == nil
 	return status
 }
 
+// proxyGet requests the core API group through the proxy on port
+func proxyGet(port int) ([]byte, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://localhost:%d/api/v1", port))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
 func (s *Server) handleStartPortForward(w http.ResponseWriter, r *http.Request) {
 	var req PortForwardRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -897,8 +1054,16 @@ func (s *Server) handleStartPortForward(w http.ResponseWriter, r *http.Request)
 
 	log.Printf("Starting port forward: %s/%s:%d -> localhost:%d", req.Namespace, req.ServiceName, req.ServicePort, req.LocalPort)
 
+	// Ensure kubeconfig is properly configured for the requested context
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		log.Printf("Kubeconfig setup failed: %v", err)
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	// Generate unique key for this port forward
-	key := fmt.Sprintf("%s-%s-%d-%d", req.Namespace, req.ServiceName, req.ServicePort, req.LocalPort)
+	key := portForwardKey(kube.Target().Context, req.Namespace, req.ServiceName, req.ServicePort, req.LocalPort)
 
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -907,14 +1072,13 @@ func (s *Server) handleStartPortForward(w http.ResponseWriter, r *http.Request)
 	if existing, exists := s.portForwards[key]; exists && existing.IsRunning {
 		log.Printf("Port forward already running: %s", key)
 		response := APIResponse{Success: true, Data: existing}
-		json.NewEncoder(w).Encode(response)
+		s.sendResponse(w, response)
 		return
 	}
 
-	// Ensure kubeconfig is properly configured
-	if err := s.ensureKubeconfig(); err != nil {
-		log.Printf("Kubeconfig setup failed: %v", err)
-		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+	// The local port may already forward something else, possibly in another context
+	if other := s.portForwardOnLocalPort(req.LocalPort); other != nil && other.IsRunning && !s.isPortAvailable(req.LocalPort) {
+		s.sendError(w, fmt.Sprintf("Local port %d already forwards %s/%s in context %s", req.LocalPort, other.Namespace, other.ServiceName, other.Context), http.StatusConflict)
 		return
 	}
 
@@ -924,26 +1088,21 @@ func (s *Server) handleStartPortForward(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Start kubectl port-forward
-	kubeconfigPath := os.Getenv("KUBECONFIG")
-	if kubeconfigPath == "" {
-		kubeconfigPath = "/host/.kube/config"
-	}
-
+	// Start kubectl port-forward; it outlives the request, so it is not tied to its context
 	var cmd *exec.Cmd
 	switch req.ResourceType {
 	case "service":
-		cmd = exec.Command("kubectl", "port-forward", 
+		cmd = kube.KubectlCommand(context.Background(), "port-forward", 
 			fmt.Sprintf("service/%s", req.ServiceName),
 			fmt.Sprintf("%d:%d", req.LocalPort, req.ServicePort),
 			"-n", req.Namespace)
 	case "pod":
-		cmd = exec.Command("kubectl", "port-forward",
+		cmd = kube.KubectlCommand(context.Background(), "port-forward",
 			fmt.Sprintf("pod/%s", req.ServiceName),
 			fmt.Sprintf("%d:%d", req.LocalPort, req.ServicePort),
 			"-n", req.Namespace)
 	case "deployment":
-		cmd = exec.Command("kubectl", "port-forward",
+		cmd = kube.KubectlCommand(context.Background(), "port-forward",
 			fmt.Sprintf("deployment/%s", req.ServiceName),
 			fmt.Sprintf("%d:%d", req.LocalPort, req.ServicePort),
 			"-n", req.Namespace)
@@ -952,7 +1111,6 @@ func (s *Server) handleStartPortForward(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	cmd.Env = append(os.Environ(), "KUBECONFIG="+kubeconfigPath)
 	
 	log.Printf("Starting port-forward with command: %v", cmd.Args)
 	if err := cmd.Start(); err != nil {
@@ -964,7 +1122,7 @@ func (s *Server) handleStartPortForward(w http.ResponseWriter, r *http.Request)
 	log.Printf("Port-forward started with PID: %d", cmd.Process.Pid)
 
 	// Save PID for later termination
-	pidFile := fmt.Sprintf("/tmp/port-forward-%s.pid", key)
+	pidFile := portForwardPIDFile(key)
 	if err := ioutil.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)), 0644); err != nil {
 		log.Printf("Warning: Could not save PID file: %v", err)
 	}
@@ -977,6 +1135,7 @@ func (s *Server) handleStartPortForward(w http.ResponseWriter, r *http.Request)
 		ServicePort:  req.ServicePort,
 		LocalPort:    req.LocalPort,
 		ResourceType: req.ResourceType,
+		Context:      kube.Target().Context,
 		PID:          strconv.Itoa(cmd.Process.Pid),
 		URL:          fmt.Sprintf("http://localhost:%d", req.LocalPort),
 	}
@@ -996,7 +1155,30 @@ func (s *Server) handleStartPortForward(w http.ResponseWriter, r *http.Request)
 	}
 
 	response := APIResponse{Success: true, Data: status}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
+}
+
+// portForwardKey identifies a port forward. The context is part of it since the same
+// namespace and service usually exist in several clusters.
+func portForwardKey(kubeContext, namespace, name string, servicePort, localPort int) string {
+	return fmt.Sprintf("%s-%s-%s-%d-%d", kubeContext, namespace, name, servicePort, localPort)
+}
+
+// portForwardPIDFile is where the kubectl process of a port forward records its PID.
+// Context names may contain "/" or ":", e.g. EKS ARNs, so the key is made file-safe.
+func portForwardPIDFile(key string) string {
+	return fmt.Sprintf("/tmp/port-forward-%s.pid", unsafeFileNameChars.ReplaceAllString(key, "_"))
+}
+
+// portForwardOnLocalPort returns the tracked port forward listening on localPort, if any.
+// The caller holds s.mutex.
+func (s *Server) portForwardOnLocalPort(localPort int) *PortForwardStatus {
+	for _, status := range s.portForwards {
+		if status.LocalPort == localPort {
+			return status
+		}
+	}
+	return nil
 }
 
 func (s *Server) handleStopPortForward(w http.ResponseWriter, r *http.Request) {
@@ -1011,8 +1193,13 @@ func (s *Server) handleStopPortForward(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	key := fmt.Sprintf("%s-%s-%d-%d", req.Namespace, req.ServiceName, req.ServicePort, req.LocalPort)
-	pidFile := fmt.Sprintf("/tmp/port-forward-%s.pid", key)
+	target, err := s.kubeTarget(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	key := portForwardKey(target.Context, req.Namespace, req.ServiceName, req.ServicePort, req.LocalPort)
+	pidFile := portForwardPIDFile(key)
 
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -1034,7 +1221,7 @@ func (s *Server) handleStopPortForward(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := APIResponse{Success: true, Data: "Port forward stopped"}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) handlePortForwardStatus(w http.ResponseWriter, r *http.Request) {
@@ -1060,15 +1247,22 @@ func (s *Server) handlePortForwardStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	key := fmt.Sprintf("%s-%s-%d-%d", namespace, serviceName, servicePort, localPort)
+	target, err := s.kubeTarget(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	key := portForwardKey(target.Context, namespace, serviceName, servicePort, localPort)
 
 	s.mutex.RLock()
 	status, exists := s.portForwards[key]
+	other := s.portForwardOnLocalPort(localPort)
 	s.mutex.RUnlock()
 
 	if !exists {
-		// Check if there's actually a process running on this port
-		if !s.isPortAvailable(localPort) {
+		// Check if there's actually a process running on this port. A forward the backend
+		// started for another service or context is not this one.
+		if other == nil && !s.isPortAvailable(localPort) {
 			// Port is occupied but we don't have it tracked
 			status = &PortForwardStatus{
 				IsRunning:   true,
@@ -1099,7 +1293,7 @@ func (s *Server) handlePortForwardStatus(w http.ResponseWriter, r *http.Request)
 	}
 
 	response := APIResponse{Success: true, Data: status}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) handleListPortForwards(w http.ResponseWriter, r *http.Request) {
@@ -1115,7 +1309,7 @@ func (s *Server) handleListPortForwards(w http.ResponseWriter, r *http.Request)
 	s.mutex.RUnlock()
 
 	response := APIResponse{Success: true, Data: forwards}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) isPortAvailable(port int) bool {
@@ -1134,18 +1328,9 @@ func (s *Server) handleCreateCertificate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Create self-signed issuer if needed
-	if certData.IssuerType == "self-signed" {
-		issuerYAML := `apiVersion: cert-manager.io/v1
-kind: ClusterIssuer
-metadata:
-  name: selfsigned-issuer
-spec:
-  selfSigned: {}
-`
-		if err := s.applyYAML(issuerYAML, "cluster-issuer"); err != nil {
-			log.Printf("Warning: Failed to create self-signed issuer (might already exist): %v", err)
-		}
+	if errs := validateCertificateFormData(certData); len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
 	}
 
 	// Generate certificate YAML
@@ -1155,8 +1340,29 @@ spec:
 		return
 	}
 
-	if err := s.applyYAML(yamlContent, "certificate"); err != nil {
-		s.sendError(w, fmt.Sprintf("Failed to apply Certificate: %v", err), http.StatusInternalServerError)
+	// Create self-signed issuer if needed
+	if certData.IssuerType == "self-signed" {
+		issuerYAML, err := s.generateSelfSignedIssuerYAML()
+		if err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to generate ClusterIssuer YAML: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if isDryRun(r) {
+			s.sendPreview(w, r, joinYAMLDocuments(issuerYAML, yamlContent), nil)
+			return
+		}
+		if err := s.applyYAML(r.Context(), issuerYAML, "cluster-issuer"); err != nil {
+			log.Printf("Warning: Failed to create self-signed issuer (might already exist): %v", err)
+		}
+	}
+
+	if isDryRun(r) {
+		s.sendPreview(w, r, yamlContent, nil)
+		return
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, "certificate"); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply Certificate: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
 		return
 	}
 
@@ -1164,48 +1370,51 @@ spec:
 		Success: true,
 		Data:    fmt.Sprintf("Certificate %s created successfully in namespace %s", certData.Name, certData.Namespace),
 	}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) handleListCertificates(w http.ResponseWriter, r *http.Request) {
-	cmd := exec.Command("kubectl", "get", "certificates", "--all-namespaces", "-o", "json")
-	output, err := cmd.Output()
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	items, err := kube.List(r.Context(), "certificates.cert-manager.io", "", metav1.ListOptions{})
 	if err != nil {
-		s.sendError(w, fmt.Sprintf("Failed to list certificates: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	var kubeList struct {
-		Items []struct {
-			Metadata struct {
-				Name              string `json:"name"`
-				Namespace         string `json:"namespace"`
-				CreationTimestamp string `json:"creationTimestamp"`
-			} `json:"metadata"`
-			Spec struct {
-				DNSNames   []string `json:"dnsNames"`
-				SecretName string   `json:"secretName"`
-				IssuerRef  struct {
-					Name string `json:"name"`
-				} `json:"issuerRef"`
-			} `json:"spec"`
-			Status struct {
-				Conditions []struct {
-					Type   string `json:"type"`
-					Status string `json:"status"`
-				} `json:"conditions"`
-				ExpirationTime string `json:"expirationTime,omitempty"`
-			} `json:"status"`
-		} `json:"items"`
-	}
-
-	if err := json.Unmarshal(output, &kubeList); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to list certificates: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	var kubeList []struct {
+		Metadata struct {
+			Name              string `json:"name"`
+			Namespace         string `json:"namespace"`
+			CreationTimestamp string `json:"creationTimestamp"`
+		} `json:"metadata"`
+		Spec struct {
+			DNSNames   []string `json:"dnsNames"`
+			SecretName string   `json:"secretName"`
+			IssuerRef  struct {
+				Name string `json:"name"`
+			} `json:"issuerRef"`
+		} `json:"spec"`
+		Status struct {
+			Conditions []struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+			} `json:"conditions"`
+			ExpirationTime string `json:"expirationTime,omitempty"`
+		} `json:"status"`
+	}
+
+	if err := decodeInto(items, &kubeList); err != nil {
 		s.sendError(w, fmt.Sprintf("Failed to parse certificate list: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	var certificates []Certificate
-	for _, item := range kubeList.Items {
+	for _, item := range kubeList {
 		status := "pending"
 		for _, condition := range item.Status.Conditions {
 			if condition.Type == "Ready" && condition.Status == "True" {
@@ -1228,7 +1437,7 @@ func (s *Server) handleListCertificates(w http.ResponseWriter, r *http.Request)
 	}
 
 	response := APIResponse{Success: true, Data: certificates}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) handleDeleteCertificate(w http.ResponseWriter, r *http.Request) {
@@ -1240,10 +1449,15 @@ func (s *Server) handleDeleteCertificate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	// Delete certificate
-	cmd := exec.Command("kubectl", "delete", "certificate", name, "-n", namespace)
-	if err := cmd.Run(); err != nil {
-		s.sendError(w, fmt.Sprintf("Failed to delete certificate: %v", err), http.StatusInternalServerError)
+	if err := kube.Delete(r.Context(), "certificates.cert-manager.io", namespace, name); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to delete certificate: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
 		return
 	}
 
@@ -1251,44 +1465,34 @@ func (s *Server) handleDeleteCertificate(w http.ResponseWriter, r *http.Request)
 		Success: true,
 		Data:    fmt.Sprintf("Certificate %s deleted successfully from namespace %s", name, namespace),
 	}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) generateCertificateYAML(certData CertificateFormData) (string, error) {
-	issuerKind := "ClusterIssuer"
-	issuerName := "selfsigned-issuer"
-
+	issuerRef := IssuerReference{Name: "selfsigned-issuer", Kind: "ClusterIssuer"}
 	if certData.IssuerType == "ca-issuer" {
-		issuerKind = "Issuer"
-		issuerName = certData.IssuerName
-	}
-
-	dnsNamesYAML := ""
-	for _, dns := range certData.DNSNames {
-		dnsNamesYAML += fmt.Sprintf("  - %s\n", dns)
-	}
-
-	yamlTemplate := `apiVersion: cert-manager.io/v1
-kind: Certificate
-metadata:
-  name: %s
-  namespace: %s
-spec:
-  dnsNames:
-%s  secretName: %s-tls
-  issuerRef:
-    name: %s
-    kind: %s
-`
-
-	return fmt.Sprintf(yamlTemplate,
-		certData.Name,
-		certData.Namespace,
-		dnsNamesYAML,
-		certData.Name,
-		issuerName,
-		issuerKind,
-	), nil
+		issuerRef = IssuerReference{Name: certData.IssuerName, Kind: "Issuer"}
+	}
+
+	certificate := CertificateResource{
+		TypeMeta: TypeMeta{APIVersion: "cert-manager.io/v1", Kind: "Certificate"},
+		Metadata: ObjectMeta{Name: certData.Name, Namespace: certData.Namespace},
+		Spec: CertificateSpec{
+			DNSNames:   certData.DNSNames,
+			SecretName: certData.Name + "-tls",
+			IssuerRef:  issuerRef,
+		},
+	}
+	return marshalResource(certificate)
+}
+
+func (s *Server) generateSelfSignedIssuerYAML() (string, error) {
+	issuer := ClusterIssuerResource{
+		TypeMeta: TypeMeta{APIVersion: "cert-manager.io/v1", Kind: "ClusterIssuer"},
+		Metadata: ObjectMeta{Name: "selfsigned-issuer"},
+		Spec:     ClusterIssuerSpec{SelfSigned: &struct{}{}},
+	}
+	return marshalResource(issuer)
 }
 
 func (s *Server) handleStartTrafficTest(w http.ResponseWriter, r *http.Request) {
@@ -1304,6 +1508,42 @@ func (s *Server) handleStartTrafficTest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// The mirror is counted after the request has returned, so pin its cluster now
+	var mirrorKube KubeClient
+	if config.Mirror != nil {
+		kube, err := s.kubeClient(r.Context())
+		if err != nil {
+			s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		mirrorKube = kube
+	}
+
+	if _, err := s.startTrafficTest(config, mirrorKube, nil); err != nil {
+		s.sendError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Data:    "Traffic test started successfully",
+	}
+	s.sendResponse(w, response)
+}
+
+// errCanaryOwnsTrafficTest refuses changes to the traffic test a canary rollout gates on
+var errCanaryOwnsTrafficTest = errors.New("a canary rollout is running and owns the traffic test; abort it with /abort-canary first")
+
+// canaryRunning reports whether a rollout other than rollout is running. Callers hold s.mutex.
+func (s *Server) canaryRunning(rollout *CanaryRollout) bool {
+	return s.canary != nil && s.canary != rollout && s.canary.phase() == "Running"
+}
+
+// startTrafficTest fills in defaults, replaces any running test and starts generating
+// traffic in the background. The returned state's done channel closes when it finishes.
+// mirrorKube counts a configured mirror's requests. While a canary rollout is running
+// only that rollout, passed as rollout, may start tests.
+func (s *Server) startTrafficTest(config TrafficTestConfig, mirrorKube KubeClient, rollout *CanaryRollout) (*TrafficTestState, error) {
 	// Transform localhost URLs for container access
 	originalURL := config.TargetURL
 	config.TargetURL = s.transformURLForContainer(config.TargetURL)
@@ -1326,20 +1566,28 @@ func (s *Server) handleStartTrafficTest(w http.ResponseWriter, r *http.Request)
 		config.Connections = 10 // Default concurrent connections
 	}
 
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.canaryRunning(rollout) {
+		return nil, errCanaryOwnsTrafficTest
+	}
+
 	// Stop any existing traffic test
-	if s.trafficTest != nil && s.trafficTest.isRunning {
-		s.stopTrafficTest()
+	if s.trafficTest != nil {
+		s.trafficTest.stop()
 	}
 
 	// Initialize new traffic test
-	s.trafficTest = &TrafficTestState{
+	test := &TrafficTestState{
 		config:      config,
 		startTime:   time.Now(),
 		stopChan:    make(chan bool, 1),
+		done:        make(chan struct{}),
 		isRunning:   true,
 		responses:   make([]time.Duration, 0),
 		statusCodes: make(map[string]int),
 		errors:      make([]string, 0),
+		mirrorKube:  mirrorKube,
 		metrics: TrafficMetrics{
 			StartTime:   time.Now(),
 			StatusCodes: make(map[string]int),
@@ -1347,51 +1595,65 @@ func (s *Server) handleStartTrafficTest(w http.ResponseWriter, r *http.Request)
 			IsRunning:   true,
 		},
 	}
+	s.trafficTest = test
 
 	// Start traffic generation in background
-	go s.runTrafficTest()
+	go s.runTrafficTest(test)
 
-	response := APIResponse{
-		Success: true,
-		Data:    "Traffic test started successfully",
-	}
-	json.NewEncoder(w).Encode(response)
+	return test, nil
+}
+
+func (s *Server) currentTrafficTest() *TrafficTestState {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.trafficTest
 }
 
 func (s *Server) handleStopTrafficTest(w http.ResponseWriter, r *http.Request) {
-	if s.trafficTest == nil || !s.trafficTest.isRunning {
+	s.mutex.RLock()
+	test := s.trafficTest
+	canaryRunning := s.canaryRunning(nil)
+	s.mutex.RUnlock()
+
+	if canaryRunning {
+		s.sendError(w, errCanaryOwnsTrafficTest.Error(), http.StatusConflict)
+		return
+	}
+	if test == nil || !test.running() {
 		s.sendError(w, "No traffic test is currently running", http.StatusBadRequest)
 		return
 	}
 
-	s.stopTrafficTest()
+	test.stop()
 
 	response := APIResponse{
 		Success: true,
 		Data:    "Traffic test stopped successfully",
 	}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) handleTrafficMetrics(w http.ResponseWriter, r *http.Request) {
-	if s.trafficTest == nil {
+	test := s.currentTrafficTest()
+	if test == nil {
 		s.sendError(w, "No traffic test has been started", http.StatusNotFound)
 		return
 	}
 
-	s.trafficTest.mutex.RLock()
-	metrics := s.calculateMetrics()
-	s.trafficTest.mutex.RUnlock()
+	test.mutex.RLock()
+	metrics := test.calculateMetrics()
+	test.mutex.RUnlock()
 
 	response := APIResponse{
 		Success: true,
 		Data:    metrics,
 	}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
-func (s *Server) runTrafficTest() {
-	config := s.trafficTest.config
+func (s *Server) runTrafficTest(test *TrafficTestState) {
+	config := test.config
+	defer close(test.done)
 	interval := time.Duration(1000/config.RPS) * time.Millisecond
 	timeout := time.Duration(config.Duration) * time.Second
 
@@ -1412,25 +1674,21 @@ func (s *Server) runTrafficTest() {
 
 	for {
 		select {
-		case <-s.trafficTest.stopChan:
+		case <-test.stopChan:
 			log.Printf("Traffic test stopped by user")
-			s.trafficTest.mutex.Lock()
-			s.trafficTest.isRunning = false
-			s.trafficTest.mutex.Unlock()
+			s.finishTrafficTest(test)
 			return
 
 		case <-testTimer.C:
 			log.Printf("Traffic test completed after %d seconds", config.Duration)
-			s.trafficTest.mutex.Lock()
-			s.trafficTest.isRunning = false
-			s.trafficTest.mutex.Unlock()
+			s.finishTrafficTest(test)
 			return
 
 		case <-ticker.C:
 			// Acquire semaphore
 			select {
 			case semaphore <- struct{}{}:
-				go s.makeRequest(client, semaphore)
+				go test.makeRequest(client, semaphore)
 			default:
 				// Skip this request if we've hit connection limit
 				continue
@@ -1439,10 +1697,20 @@ func (s *Server) runTrafficTest() {
 	}
 }
 
-func (s *Server) makeRequest(client *http.Client, semaphore chan struct{}) {
+// finishTrafficTest marks the test as finished together with its mirror report, so a
+// finished test is never seen without one
+func (s *Server) finishTrafficTest(test *TrafficTestState) {
+	report := s.reportMirrorTraffic(test)
+	test.mutex.Lock()
+	defer test.mutex.Unlock()
+	test.mirror = report
+	test.isRunning = false
+}
+
+func (t *TrafficTestState) makeRequest(client *http.Client, semaphore chan struct{}) {
 	defer func() { <-semaphore }() // Release semaphore
 
-	config := s.trafficTest.config
+	config := t.config
 	startTime := time.Now()
 
 	// Prepare request
@@ -1456,7 +1724,7 @@ func (s *Server) makeRequest(client *http.Client, semaphore chan struct{}) {
 	}
 
 	if err != nil {
-		s.recordError(fmt.Sprintf("Failed to create request: %v", err))
+		t.recordError(fmt.Sprintf("Failed to create request: %v", err))
 		return
 	}
 
@@ -1469,62 +1737,69 @@ func (s *Server) makeRequest(client *http.Client, semaphore chan struct{}) {
 	resp, err := client.Do(req)
 	duration := time.Since(startTime)
 
-	s.trafficTest.mutex.Lock()
-	defer s.trafficTest.mutex.Unlock()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 
 	// Record response time
-	s.trafficTest.responses = append(s.trafficTest.responses, duration)
+	t.responses = append(t.responses, duration)
 
 	if err != nil {
-		s.trafficTest.errors = append(s.trafficTest.errors, err.Error())
+		t.errors = append(t.errors, err.Error())
 		return
 	}
 	defer resp.Body.Close()
 
 	// Record status code
 	statusCode := fmt.Sprintf("%d", resp.StatusCode)
-	s.trafficTest.statusCodes[statusCode]++
+	t.statusCodes[statusCode]++
 
 	// Count as success if 2xx or 3xx
 	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
 		// Success recorded implicitly
 	} else {
-		s.trafficTest.errors = append(s.trafficTest.errors, fmt.Sprintf("HTTP %d", resp.StatusCode))
+		t.errors = append(t.errors, fmt.Sprintf("HTTP %d", resp.StatusCode))
 	}
 }
 
-func (s *Server) recordError(errMsg string) {
-	s.trafficTest.mutex.Lock()
-	defer s.trafficTest.mutex.Unlock()
-	s.trafficTest.errors = append(s.trafficTest.errors, errMsg)
+func (t *TrafficTestState) recordError(errMsg string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.errors = append(t.errors, errMsg)
+}
+
+func (t *TrafficTestState) running() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.isRunning
 }
 
-func (s *Server) stopTrafficTest() {
-	if s.trafficTest != nil && s.trafficTest.isRunning {
-		s.trafficTest.stopChan <- true
-		s.trafficTest.mutex.Lock()
-		s.trafficTest.isRunning = false
-		s.trafficTest.mutex.Unlock()
+// stop asks the test to finish; it stays running until its report is ready
+func (t *TrafficTestState) stop() {
+	select {
+	case t.stopChan <- true:
+	default: // already asked
 	}
 }
 
-func (s *Server) calculateMetrics() TrafficMetrics {
-	if len(s.trafficTest.responses) == 0 {
+// calculateMetrics summarizes the test so far. Callers hold t.mutex.
+func (t *TrafficTestState) calculateMetrics() TrafficMetrics {
+	if len(t.responses) == 0 {
 		return TrafficMetrics{
-			StartTime:   s.trafficTest.startTime,
-			ElapsedTime: time.Since(s.trafficTest.startTime).String(),
-			IsRunning:   s.trafficTest.isRunning,
-			StatusCodes: s.trafficTest.statusCodes,
-			Errors:      s.trafficTest.errors,
+			StartTime:   t.startTime,
+			ElapsedTime: time.Since(t.startTime).String(),
+			IsRunning:   t.isRunning,
+			StatusCodes: t.statusCodes,
+			Errors:      t.errors,
+			Mirror:      t.mirror,
 		}
 	}
 
 	// Calculate response time statistics
 	var total time.Duration
-	min := s.trafficTest.responses[0]
-	max := s.trafficTest.responses[0]
+	min := t.responses[0]
+	max := t.responses[0]
 
-	for _, duration := range s.trafficTest.responses {
+	for _, duration := range t.responses {
 		total += duration
 		if duration < min {
 			min = duration
@@ -1534,11 +1809,11 @@ func (s *Server) calculateMetrics() TrafficMetrics {
 		}
 	}
 
-	totalRequests := len(s.trafficTest.responses)
-	failedRequests := len(s.trafficTest.errors)
+	totalRequests := len(t.responses)
+	failedRequests := len(t.errors)
 	successRequests := totalRequests - failedRequests
 
-	elapsedTime := time.Since(s.trafficTest.startTime)
+	elapsedTime := time.Since(t.startTime)
 	avgResponseTime := float64(total.Nanoseconds()) / float64(totalRequests) / 1e6 // Convert to milliseconds
 
 	var successRate, errorRate, rps float64
@@ -1549,7 +1824,7 @@ func (s *Server) calculateMetrics() TrafficMetrics {
 	}
 
 	return TrafficMetrics{
-		StartTime:       s.trafficTest.startTime,
+		StartTime:       t.startTime,
 		ElapsedTime:     elapsedTime.String(),
 		TotalRequests:   totalRequests,
 		SuccessRequests: successRequests,
@@ -1559,10 +1834,11 @@ func (s *Server) calculateMetrics() TrafficMetrics {
 		MaxResponseTime: float64(max.Nanoseconds()) / 1e6,
 		SuccessRate:     successRate,
 		ErrorRate:       errorRate,
-		StatusCodes:     s.trafficTest.statusCodes,
-		Errors:          s.trafficTest.errors,
+		StatusCodes:     t.statusCodes,
+		Errors:          t.errors,
 		RPS:             rps,
-		IsRunning:       s.trafficTest.isRunning,
+		IsRunning:       t.isRunning,
+		Mirror:          t.mirror,
 	}
 }
 
@@ -1736,15 +2012,27 @@ Original error: ` + errorMsg
 	}
 
 	response := APIResponse{Success: true, Data: httpResponse}
-	json.NewEncoder(w).Encode(response)
+	s.sendResponse(w, response)
 }
 
 func (s *Server) sendError(w http.ResponseWriter, message string, statusCode int) {
-	w.WriteHeader(statusCode)
 	response := APIResponse{Success: false, Error: message}
+	s.withKubeTarget(w, &response)
+	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(response)
 }
 
+func (s *Server) sendResponse(w http.ResponseWriter, response APIResponse) {
+	s.withKubeTarget(w, &response)
+	json.NewEncoder(w).Encode(response)
+}
+
+// withKubeTarget copies the context and cluster set by kubeContextMiddleware into the body
+func (s *Server) withKubeTarget(w http.ResponseWriter, response *APIResponse) {
+	response.KubeContext = w.Header().Get(kubeContextHeader)
+	response.KubeCluster = w.Header().Get(kubeClusterHeader)
+}
+
 func main() {
 	server := NewServer()
 
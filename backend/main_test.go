@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const testGatewayYAML = `apiVersion: gateway.networking.k8s.io/v1
+kind: Gateway
+metadata:
+  name: eg
+  namespace: default
+spec:
+  gatewayClassName: eg
+  listeners:
+  - name: http
+    port: 80
+    protocol: HTTP
+`
+
+func applyYAMLBody(t *testing.T, manifest string) string {
+	t.Helper()
+	body, err := json.Marshal(map[string]string{"yaml": manifest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestApplyYAML(t *testing.T) {
+	kube := newFakeKubeClient()
+	s := newTestServer(t, kube)
+
+	status, response := serve(t, s, http.MethodPost, "/apply-yaml", applyYAMLBody(t, testGatewayYAML))
+	if status != http.StatusOK || !response.Success {
+		t.Fatalf("status = %d, response = %+v", status, response)
+	}
+	if response.KubeContext != testKubeContext {
+		t.Errorf("kubeContext = %q, want %q", response.KubeContext, testKubeContext)
+	}
+	if len(kube.applied) != 1 {
+		t.Fatalf("applied %d manifests, want 1", len(kube.applied))
+	}
+	if _, err := kube.Get(context.Background(), "gateways.gateway.networking.k8s.io", "default", "eg"); err != nil {
+		t.Errorf("Gateway was not stored: %v", err)
+	}
+}
+
+func TestApplyYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{"invalid json", "{", nil, http.StatusBadRequest},
+		{"empty yaml", `{"yaml": ""}`, nil, http.StatusBadRequest},
+		{"rejected", applyYAMLBody(t, testGatewayYAML), apierrors.NewForbidden(schema.GroupResource{Resource: "gateways"}, "eg", errors.New("no")), http.StatusForbidden},
+		{"invalid", applyYAMLBody(t, testGatewayYAML), apierrors.NewBadRequest("spec.listeners: Required value"), http.StatusUnprocessableEntity},
+		{"field conflict", applyYAMLBody(t, testGatewayYAML), apierrors.NewConflict(schema.GroupResource{Resource: "gateways"}, "eg", errors.New(".spec.listeners: conflict with \"kubectl\"")), http.StatusConflict},
+		{"unreachable", applyYAMLBody(t, testGatewayYAML), &timeoutError{}, http.StatusServiceUnavailable},
+		{"other", applyYAMLBody(t, testGatewayYAML), errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kube := newFakeKubeClient()
+			kube.errs["apply"] = test.err
+			s := newTestServer(t, kube)
+
+			status, response := serve(t, s, http.MethodPost, "/apply-yaml", test.body)
+			if status != test.status || response.Success {
+				t.Errorf("status = %d, response = %+v; want %d", status, response, test.status)
+			}
+		})
+	}
+}
+
+func TestApplyYAMLForce(t *testing.T) {
+	kube := newFakeKubeClient()
+	s := newTestServer(t, kube)
+
+	for _, target := range []string{"/apply-yaml", "/apply-yaml?force=true", "/apply-yaml?force=false"} {
+		if status, response := serve(t, s, http.MethodPost, target, applyYAMLBody(t, testGatewayYAML)); status != http.StatusOK {
+			t.Fatalf("%s: status = %d, response = %+v", target, status, response)
+		}
+	}
+	if want := []bool{false, true, false}; !reflect.DeepEqual(kube.forced, want) {
+		t.Errorf("forced = %v, want %v", kube.forced, want)
+	}
+}
+
+func TestDeleteCertificate(t *testing.T) {
+	certificate := &unstructured.Unstructured{}
+	certificate.SetAPIVersion("cert-manager.io/v1")
+	certificate.SetKind("Certificate")
+	certificate.SetNamespace("default")
+	certificate.SetName("web")
+	kube := newFakeKubeClient(certificate)
+	s := newTestServer(t, kube)
+
+	status, response := serve(t, s, http.MethodDelete, "/delete-certificate?name=web&namespace=default", "")
+	if status != http.StatusOK || !response.Success {
+		t.Fatalf("status = %d, response = %+v", status, response)
+	}
+	if want := []string{"certificates.cert-manager.io default/web"}; len(kube.deleted) != 1 || kube.deleted[0] != want[0] {
+		t.Errorf("deleted = %v, want %v", kube.deleted, want)
+	}
+
+	status, response = serve(t, s, http.MethodDelete, "/delete-certificate?name=web&namespace=default", "")
+	if status != http.StatusNotFound || !strings.Contains(response.Error, "not found") {
+		t.Errorf("deleting again: status = %d, error = %q; want 404", status, response.Error)
+	}
+
+	status, _ = serve(t, s, http.MethodDelete, "/delete-certificate?name=web", "")
+	if status != http.StatusBadRequest {
+		t.Errorf("missing namespace: status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+// timeoutError is a net.Error, which the client reports as an unreachable cluster
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "dial tcp: i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+func TestUnknownKubeContext(t *testing.T) {
+	s := newTestServer(t, newFakeKubeClient())
+
+	status, response := serve(t, s, http.MethodGet, "/inventory/gateways?context=missing", "")
+	if status != http.StatusBadRequest || !strings.Contains(response.Error, `"missing"`) {
+		t.Errorf("status = %d, error = %q; want 400 naming the context", status, response.Error)
+	}
+}
+
+func TestStartProxyOtherContext(t *testing.T) {
+	s := newTestServer(t, newFakeKubeClient())
+	s.proxies[18001] = &apiProxy{server: &http.Server{}, context: "other"}
+
+	status, response := serve(t, s, http.MethodPost, "/start-proxy", `{"port": 18001}`)
+	if status != http.StatusConflict || !strings.Contains(response.Error, "context other") {
+		t.Errorf("status = %d, error = %q; want 409 naming the other context", status, response.Error)
+	}
+
+	s.proxies[18001].context = testKubeContext
+	status, response = serve(t, s, http.MethodPost, "/start-proxy", `{"port": 18001}`)
+	if status != http.StatusOK || !response.Success {
+		t.Errorf("same context: status = %d, response = %+v", status, response)
+	}
+}
+
+func TestStopProxy(t *testing.T) {
+	s := newTestServer(t, newFakeKubeClient())
+	s.proxies[18001] = &apiProxy{server: &http.Server{}, context: "other"}
+
+	status, response := serve(t, s, http.MethodPost, "/stop-proxy", `{"port": 18001}`)
+	if status != http.StatusConflict || !strings.Contains(response.Error, "context other") {
+		t.Errorf("other context: status = %d, error = %q; want 409 naming the other context", status, response.Error)
+	}
+	if s.proxies[18001] == nil {
+		t.Fatal("the other context's proxy was removed")
+	}
+
+	status, _ = serve(t, s, http.MethodPost, "/stop-proxy", `{"port": 18002}`)
+	if status != http.StatusNotFound {
+		t.Errorf("no proxy: status = %d, want %d", status, http.StatusNotFound)
+	}
+
+	s.proxies[18002] = &apiProxy{server: &http.Server{}, context: testKubeContext}
+	status, response = serve(t, s, http.MethodPost, "/stop-proxy", `{"port": 18002}`)
+	if status != http.StatusOK || !response.Success {
+		t.Errorf("same context: status = %d, response = %+v", status, response)
+	}
+	if _, ok := s.proxies[18002]; ok {
+		t.Error("the stopped proxy is still tracked")
+	}
+}
+
+func TestStartPortForwardOtherContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	localPort := listener.Addr().(*net.TCPAddr).Port
+
+	s := newTestServer(t, newFakeKubeClient())
+	key := portForwardKey("other", "default", "web", 80, localPort)
+	s.portForwards[key] = &PortForwardStatus{
+		IsRunning: true, ServiceName: "web", Namespace: "default", ServicePort: 80, LocalPort: localPort, Context: "other",
+	}
+
+	body := fmt.Sprintf(`{"serviceName": "web", "namespace": "default", "servicePort": 80, "localPort": %d}`, localPort)
+	status, response := serve(t, s, http.MethodPost, "/start-port-forward", body)
+	if status != http.StatusConflict || !strings.Contains(response.Error, "context other") {
+		t.Errorf("status = %d, error = %q; want 409 naming the other context", status, response.Error)
+	}
+
+	// The forward in the other context is not reported as this context's
+	target := fmt.Sprintf("/port-forward-status?serviceName=web&namespace=default&servicePort=80&localPort=%d", localPort)
+	data, _ := json.Marshal(mustServe(t, s, target).Data)
+	var forward PortForwardStatus
+	if err := json.Unmarshal(data, &forward); err != nil {
+		t.Fatal(err)
+	}
+	if forward.IsRunning {
+		t.Errorf("status = %+v, want not running in context %s", forward, testKubeContext)
+	}
+}
+
+func TestApplyYAMLReadOnly(t *testing.T) {
+	kube := newFakeKubeClient()
+	s := newTestServer(t, kube)
+	s.policy.ReadOnly = true
+
+	status, _ := serve(t, s, http.MethodPost, "/apply-yaml", applyYAMLBody(t, testGatewayYAML))
+	if status != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", status, http.StatusForbidden)
+	}
+	if len(kube.applied) != 0 {
+		t.Errorf("read-only server applied %d manifests", len(kube.applied))
+	}
+
+	status, response := serve(t, s, http.MethodPost, "/apply-yaml?dryRun=true", applyYAMLBody(t, testGatewayYAML))
+	if status != http.StatusOK || !response.Success {
+		t.Errorf("dry run in read-only mode: status = %d, response = %+v", status, response)
+	}
+}
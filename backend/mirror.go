@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TrafficMirrorConfig identifies the pods behind a RequestMirror backendRef so a
+// traffic test can count how many of its requests were shadowed to them
+type TrafficMirrorConfig struct {
+	Namespace       string  `json:"namespace"`
+	LabelSelector   string  `json:"labelSelector"`             // e.g. "app=echo-v2"
+	LogPattern      string  `json:"logPattern,omitempty"`      // only count log lines containing this text
+	ExpectedPercent float64 `json:"expectedPercent,omitempty"` // the mirror percent configured on the route
+}
+
+// maxMirrorPods caps how many pod logs are read per count, like kubectl's --max-log-requests
+const maxMirrorPods = 20
+
+// mirrorCountTimeout bounds reading the mirror pods' logs, which holds up the end of the
+// traffic test
+const mirrorCountTimeout = 20 * time.Second
+
+type MirrorMetrics struct {
+	PrimaryRequests int     `json:"primaryRequests"`
+	MirrorRequests  int     `json:"mirrorRequests"`
+	MirrorPercent   float64 `json:"mirrorPercent"`
+	ExpectedPercent float64 `json:"expectedPercent,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// reportMirrorTraffic compares the requests served by the primary backend during the
+// test with the requests the mirror pods logged over the same window. It returns nil when
+// the test has no mirror configured.
+func (s *Server) reportMirrorTraffic(test *TrafficTestState) *MirrorMetrics {
+	test.mutex.RLock()
+	mirrorConfig := test.config.Mirror
+	mirrorKube := test.mirrorKube
+	startTime := test.startTime
+	primaryRequests := len(test.responses) - len(test.errors)
+	test.mutex.RUnlock()
+	if mirrorConfig == nil {
+		return nil
+	}
+
+	report := &MirrorMetrics{
+		PrimaryRequests: primaryRequests,
+		ExpectedPercent: mirrorConfig.ExpectedPercent,
+	}
+
+	mirrorRequests, err := countMirrorRequests(mirrorKube, *mirrorConfig, startTime)
+	if err != nil {
+		log.Printf("Failed to count mirrored requests: %v", err)
+		report.Error = err.Error()
+	} else {
+		report.MirrorRequests = mirrorRequests
+		if primaryRequests > 0 {
+			report.MirrorPercent = float64(mirrorRequests) / float64(primaryRequests) * 100
+		}
+	}
+	return report
+}
+
+// countMirrorRequests counts the log lines written by the mirror pods since the test started
+func countMirrorRequests(kube KubeClient, config TrafficMirrorConfig, since time.Time) (int, error) {
+	if config.Namespace == "" || config.LabelSelector == "" {
+		return 0, fmt.Errorf("mirror namespace and labelSelector are required")
+	}
+	if kube == nil {
+		return 0, fmt.Errorf("no cluster to read the mirror pods from")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorCountTimeout)
+	defer cancel()
+	pods, err := kube.List(ctx, "pods", config.Namespace, metav1.ListOptions{LabelSelector: config.LabelSelector})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list mirror pods: %v", err)
+	}
+	if len(pods) > maxMirrorPods {
+		pods = pods[:maxMirrorPods]
+	}
+
+	sinceTime := metav1.NewTime(since)
+	count := 0
+	for _, pod := range pods {
+		stream, err := kube.PodLogs(ctx, config.Namespace, pod.GetName(), &corev1.PodLogOptions{SinceTime: &sinceTime})
+		if err != nil {
+			return 0, fmt.Errorf("failed to read mirror pod logs: %v", err)
+		}
+		scanner := bufio.NewScanner(stream)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if config.LogPattern != "" && !strings.Contains(line, config.LogPattern) {
+				continue
+			}
+			count++
+		}
+		stream.Close()
+		if err := scanner.Err(); err != nil {
+			return 0, fmt.Errorf("failed to read mirror pod logs: %v", err)
+		}
+	}
+	return count, nil
+}
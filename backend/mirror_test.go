@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testPod(namespace, name string, labels map[string]string) *unstructured.Unstructured {
+	pod := &unstructured.Unstructured{}
+	pod.SetAPIVersion("v1")
+	pod.SetKind("Pod")
+	pod.SetNamespace(namespace)
+	pod.SetName(name)
+	pod.SetLabels(labels)
+	return pod
+}
+
+func TestCountMirrorRequests(t *testing.T) {
+	kube := newFakeKubeClient(
+		testPod("demo", "echo-v2-a", map[string]string{"app": "echo-v2"}),
+		testPod("demo", "echo-v2-b", map[string]string{"app": "echo-v2"}),
+		testPod("demo", "echo-v1", map[string]string{"app": "echo-v1"}),
+	)
+	kube.logs["demo/echo-v2-a"] = "GET /api 200\nGET /healthz 200\n\n"
+	kube.logs["demo/echo-v2-b"] = "GET /api 200\n"
+	kube.logs["demo/echo-v1"] = "GET /api 200\nGET /api 200\n"
+
+	config := TrafficMirrorConfig{Namespace: "demo", LabelSelector: "app=echo-v2"}
+	if count, err := countMirrorRequests(kube, config, time.Now()); err != nil || count != 3 {
+		t.Errorf("count = %d, %v; want 3", count, err)
+	}
+	config.LogPattern = "/api"
+	if count, err := countMirrorRequests(kube, config, time.Now()); err != nil || count != 2 {
+		t.Errorf("with logPattern: count = %d, %v; want 2", count, err)
+	}
+
+	if _, err := countMirrorRequests(nil, config, time.Now()); err == nil {
+		t.Error("expected an error without a cluster")
+	}
+	if _, err := countMirrorRequests(kube, TrafficMirrorConfig{Namespace: "demo"}, time.Now()); err == nil {
+		t.Error("expected an error without a labelSelector")
+	}
+	kube.errs["list"] = errors.New("boom")
+	if _, err := countMirrorRequests(kube, config, time.Now()); err == nil {
+		t.Error("expected the list error")
+	}
+}
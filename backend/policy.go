@@ -0,0 +1,549 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultDeniedKubectlVerbs are refused unless KUBECTL_DENIED_VERBS says otherwise. They
+// are interactive, start their own long-running connections, or print credentials.
+var defaultDeniedKubectlVerbs = []string{"attach", "config", "cp", "debug", "edit", "exec", "plugin", "port-forward", "proxy", "run"}
+
+// defaultConfirmKubectlVerbs need a confirmation token unless KUBECTL_CONFIRM_VERBS says
+// otherwise
+var defaultConfirmKubectlVerbs = []string{"delete", "drain", "replace"}
+
+// deniedKubectlFlags would point kubectl at other credentials, users or clusters than the
+// request's context, so they are refused whatever the policy
+var deniedKubectlFlags = map[string]bool{
+	"--as": true, "--as-group": true, "--as-uid": true, "--certificate-authority": true,
+	"--client-certificate": true, "--client-key": true, "--cluster": true, "--context": true,
+	"--insecure-skip-tls-verify": true, "--kubeconfig": true, "--password": true, "-s": true,
+	"--server": true, "--tls-server-name": true, "--token": true, "--user": true, "--username": true,
+}
+
+// kubectlValueFlags take their value from the next argument when it is not given with
+// "=", so that the value is not mistaken for a verb or resource
+var kubectlValueFlags = map[string]bool{
+	"-c": true, "--cache-dir": true, "--chunk-size": true, "--container": true, "--field-manager": true,
+	"--field-selector": true, "-f": true, "--filename": true, "--for": true, "--from-env-file": true,
+	"--from-file": true, "--from-literal": true, "--grace-period": true, "--image": true, "-k": true,
+	"--kustomize": true, "-L": true, "--label-columns": true, "-l": true, "--limit-bytes": true,
+	"--max": true, "--min": true, "-n": true, "--name": true, "--namespace": true, "-o": true,
+	"--output": true, "-p": true, "--patch": true, "--patch-file": true, "--port": true,
+	"--protocol": true, "--raw": true, "--replicas": true, "--request-timeout": true,
+	"--selector": true, "--since": true, "--since-time": true, "--sort-by": true,
+	"--subresource": true, "--tail": true, "--target-port": true, "--template": true,
+	"--timeout": true, "--to-revision": true, "--revision": true, "--type": true, "-v": true, "--v": true,
+	"--docker-password": true, "-e": true, "--env": true, "--overrides": true,
+}
+
+// secretKubectlFlags carry values that may be credentials or payloads, so they are kept
+// out of the audit log
+var secretKubectlFlags = map[string]bool{
+	"--docker-password": true, "-e": true, "--env": true, "--from-env-file": true, "--from-file": true,
+	"--from-literal": true, "--overrides": true, "-p": true, "--patch": true,
+}
+
+// redactedValue replaces secret values in the audit log
+const redactedValue = "[REDACTED]"
+
+// readOnlyKubectlVerbs never change the cluster. A verb with subcommands is listed as
+// "verb subcommand".
+var readOnlyKubectlVerbs = map[string]bool{
+	"api-resources": true, "api-versions": true, "apply view-last-applied": true,
+	"auth can-i": true, "auth whoami": true, "cluster-info": true, "completion": true,
+	"describe": true, "diff": true, "events": true, "explain": true, "get": true, "help": true,
+	"kustomize": true, "logs": true, "options": true, "rollout history": true,
+	"rollout status": true, "top": true, "version": true, "wait": true,
+}
+
+// kubectlSubcommandVerbs name their subcommand before any resource
+var kubectlSubcommandVerbs = map[string]bool{
+	"apply": true, "auth": true, "certificate": true, "rollout": true, "set": true, "top": true,
+}
+
+// AccessPolicy restricts what callers of the socket may do to the cluster. It is read
+// from the environment at startup:
+//
+//	READ_ONLY=true                       refuse every change, except previews where supported
+//	KUBECTL_ALLOWED_VERBS=get,describe   only these verbs, when set
+//	KUBECTL_DENIED_VERBS=exec,...        never these verbs
+//	KUBECTL_ALLOWED_RESOURCES=pods,...   only these resources, when set
+//	KUBECTL_DENIED_RESOURCES=secrets     never these resources
+//	KUBECTL_CONFIRM_VERBS=delete,...     these verbs need a confirmation token
+type AccessPolicy struct {
+	ReadOnly         bool     `json:"readOnly"`
+	AllowedVerbs     []string `json:"allowedVerbs,omitempty"`
+	DeniedVerbs      []string `json:"deniedVerbs,omitempty"`
+	AllowedResources []string `json:"allowedResources,omitempty"`
+	DeniedResources  []string `json:"deniedResources,omitempty"`
+	ConfirmVerbs     []string `json:"confirmVerbs,omitempty"`
+}
+
+func loadAccessPolicy() *AccessPolicy {
+	readOnly, _ := strconv.ParseBool(os.Getenv("READ_ONLY"))
+	return &AccessPolicy{
+		ReadOnly:         readOnly,
+		AllowedVerbs:     envList("KUBECTL_ALLOWED_VERBS", nil),
+		DeniedVerbs:      envList("KUBECTL_DENIED_VERBS", defaultDeniedKubectlVerbs),
+		AllowedResources: envList("KUBECTL_ALLOWED_RESOURCES", nil),
+		DeniedResources:  envList("KUBECTL_DENIED_RESOURCES", nil),
+		ConfirmVerbs:     envList("KUBECTL_CONFIRM_VERBS", defaultConfirmKubectlVerbs),
+	}
+}
+
+// envList splits a comma-separated variable. An empty but set variable clears the
+// default.
+func envList(name string, fallback []string) []string {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// kubectlCommand is what the policy needs to know about a kubectl invocation
+type kubectlCommand struct {
+	Verb       string
+	Subcommand string
+	Resources  []string // resource types named in the args, as written
+	FromFiles  bool     // -f, -k or --raw: the resources are not named in the args
+	Follow     bool     // --watch or logs --follow: runs until cancelled
+	DryRun     bool
+	Help       bool
+}
+
+// parseKubectlArgs finds the verb and resource types of a kubectl invocation and rejects
+// flags that would escape the request's context
+func parseKubectlArgs(args []string) (*kubectlCommand, error) {
+	command := &kubectlCommand{}
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break // the rest is a command for the container
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !strings.HasPrefix(name, "--") && len(name) > 2 {
+			name, value, hasValue = name[:2], name[2:], true // -nfoo
+		}
+		if deniedKubectlFlags[name] {
+			return nil, fmt.Errorf("flag %s is not allowed; use the %s header to choose a context", name, kubeContextHeader)
+		}
+		if name == "-f" && len(positional) > 0 && strings.EqualFold(positional[0], "logs") {
+			name = "--follow" // logs -f follows rather than naming a file
+		}
+		if !hasValue && kubectlValueFlags[name] && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		switch name {
+		case "-f", "--filename", "-k", "--kustomize", "--raw":
+			command.FromFiles = true
+		case "-w", "--watch", "--watch-only", "--follow":
+			command.Follow = value != "false"
+		case "--dry-run":
+			command.DryRun = value != "none"
+		case "-h", "--help":
+			command.Help = true
+		}
+	}
+
+	if len(positional) == 0 {
+		return command, nil
+	}
+	command.Verb = strings.ToLower(positional[0])
+	rest := positional[1:]
+	if kubectlSubcommandVerbs[command.Verb] && len(rest) > 0 {
+		command.Subcommand = strings.ToLower(rest[0])
+		rest = rest[1:]
+	}
+
+	switch command.Verb {
+	case "top":
+		if command.Subcommand != "" {
+			command.Resources = []string{command.Subcommand}
+		}
+	case "create":
+		// The generator is named after the resource it creates, e.g. "create secret generic"
+		if len(rest) > 0 {
+			command.Resources = rest[:1]
+		} else {
+			command.FromFiles = true
+		}
+	case "cordon", "drain", "uncordon":
+		command.Resources = []string{"nodes"}
+	case "attach", "exec", "logs", "port-forward":
+		if len(rest) > 0 && !strings.Contains(rest[0], "/") {
+			command.Resources = []string{"pods"}
+		} else {
+			command.Resources = kubectlResources(rest)
+		}
+	case "run":
+		command.Resources = []string{"pods"}
+	case "events":
+		command.Resources = []string{"events"}
+	case "auth", "explain":
+		// Only describe access and schemas, not objects
+	default:
+		command.Resources = kubectlResources(rest)
+	}
+	return command, nil
+}
+
+// redactKubectlArgs returns a copy of args for the audit log with the values of secret
+// flags, and of "set env" assignments, replaced. Keys are kept: --from-literal=user=x is
+// recorded as --from-literal=user=[REDACTED].
+func redactKubectlArgs(args []string) []string {
+	redacted := append([]string(nil), args...)
+	redact := func(value string, keepKey bool) string {
+		if key, _, ok := strings.Cut(value, "="); ok && keepKey {
+			return key + "=" + redactedValue
+		}
+		return redactedValue
+	}
+
+	var positional []string
+	for i := 0; i < len(redacted); i++ {
+		arg := redacted[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, strings.ToLower(arg))
+			if len(positional) > 3 && positional[0] == "set" && positional[1] == "env" {
+				redacted[i] = redact(arg, true) // set env deploy/x KEY=value
+			}
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !strings.HasPrefix(name, "--") && len(name) > 2 {
+			name, value, hasValue = name[:2], name[2:], true
+		}
+		// logs -p is --previous, not a patch
+		secret := secretKubectlFlags[name] && !(name == "-p" && len(positional) > 0 && positional[0] == "logs")
+		keepKey := name == "--from-literal" || name == "-e" || name == "--env"
+		switch {
+		case secret && hasValue:
+			redacted[i] = name + "=" + redact(value, keepKey)
+		case secret && i+1 < len(redacted):
+			i++
+			redacted[i] = redact(redacted[i], keepKey)
+		case !hasValue && kubectlValueFlags[name]:
+			i++
+		}
+	}
+	return redacted
+}
+
+// kubectlResources extracts the resource types from "pods,svc [name...]" or
+// "pod/a svc/b"
+func kubectlResources(args []string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	if !strings.Contains(args[0], "/") {
+		return strings.Split(args[0], ",")
+	}
+	resources := make([]string, 0, len(args))
+	for _, arg := range args {
+		if resource, _, ok := strings.Cut(arg, "/"); ok {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
+
+// apiProxyVerbs are the kubectl verbs the policy applies to each method sent through the
+// API proxy
+var apiProxyVerbs = map[string]string{
+	http.MethodGet: "get", http.MethodHead: "get", http.MethodOptions: "get",
+	http.MethodPost: "create", http.MethodPut: "replace", http.MethodPatch: "patch", http.MethodDelete: "delete",
+}
+
+// apiProxyCommand describes a request to the API proxy as the kubectl command the policy
+// checks. A subresource such as pods/log or services/proxy counts as its resource, and
+// discovery paths like /version name no resource at all.
+func apiProxyCommand(r *http.Request) *kubectlCommand {
+	command := &kubectlCommand{
+		Verb:   apiProxyVerbs[r.Method],
+		DryRun: r.URL.Query().Get("dryRun") == metav1.DryRunAll,
+	}
+	if command.Verb == "" {
+		command.Verb = strings.ToLower(r.Method) // unknown verbs count as mutating
+	}
+
+	// /api/{version}/... or /apis/{group}/{version}/...
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var group string
+	switch {
+	case len(segments) > 2 && segments[0] == "api":
+		segments = segments[2:]
+	case len(segments) > 3 && segments[0] == "apis":
+		group, segments = segments[1], segments[3:]
+	default:
+		return command
+	}
+	if segments[0] == "namespaces" && len(segments) > 2 {
+		segments = segments[2:]
+	}
+	resource := segments[0]
+	if group != "" {
+		resource += "." + group
+	}
+	command.Resources = []string{resource}
+	return command
+}
+
+func (c *kubectlCommand) String() string {
+	if c.Subcommand != "" {
+		return c.Verb + " " + c.Subcommand
+	}
+	return c.Verb
+}
+
+// mutating reports whether the command may change the cluster. Unknown verbs count as
+// mutating.
+func (c *kubectlCommand) mutating() bool {
+	if c.Verb == "" || c.DryRun || c.Help {
+		return false
+	}
+	return !readOnlyKubectlVerbs[c.Verb] && !readOnlyKubectlVerbs[c.String()]
+}
+
+// checkKubectl applies the policy to a parsed command. Resource names are compared in the
+// API server's canonical form, so denying "secrets" also denies "secret".
+func (p *AccessPolicy) checkKubectl(kube KubeClient, command *kubectlCommand) error {
+	if command.Verb != "" {
+		if len(p.AllowedVerbs) > 0 && !containsString(p.AllowedVerbs, command.Verb) {
+			return fmt.Errorf("kubectl %s is not in the allowed verbs", command.Verb)
+		}
+		if containsString(p.DeniedVerbs, command.Verb) {
+			return fmt.Errorf("kubectl %s is denied by policy", command.Verb)
+		}
+	}
+	if p.ReadOnly && command.mutating() {
+		return fmt.Errorf("kubectl %s is not allowed in read-only mode", command)
+	}
+
+	if len(p.AllowedResources) == 0 && len(p.DeniedResources) == 0 {
+		return nil
+	}
+	if command.FromFiles {
+		return fmt.Errorf("resource rules are configured, so the command must name its resources rather than use -f, -k or --raw")
+	}
+	canonical := func(resource string) string {
+		if name, err := kube.ResourceName(resource); err == nil {
+			return name
+		}
+		return strings.ToLower(resource)
+	}
+	allowed := make([]string, 0, len(p.AllowedResources))
+	for _, resource := range p.AllowedResources {
+		allowed = append(allowed, canonical(resource))
+	}
+	denied := make([]string, 0, len(p.DeniedResources))
+	for _, resource := range p.DeniedResources {
+		denied = append(denied, canonical(resource))
+	}
+
+	for _, resource := range command.Resources {
+		// An unresolved name may be a flag value taken for a resource, which must not slip
+		// past a denylist
+		name, err := kube.ResourceName(resource)
+		if err != nil {
+			return fmt.Errorf("cannot check resource %q against the policy: %v", resource, err)
+		}
+		if len(allowed) > 0 && !containsString(allowed, name) {
+			return fmt.Errorf("resource %s is not in the allowed resources", name)
+		}
+		if containsString(denied, name) {
+			return fmt.Errorf("resource %s is denied by policy", name)
+		}
+	}
+	return nil
+}
+
+// confirmRequired reports whether the command needs a confirmation token
+func (p *AccessPolicy) confirmRequired(command *kubectlCommand) bool {
+	return command.mutating() && containsString(p.ConfirmVerbs, command.Verb)
+}
+
+// KubectlRequest is the body of /kubectl and /kubectl-stream
+type KubectlRequest struct {
+	Args         []string `json:"args"`
+	ConfirmToken string   `json:"confirmToken,omitempty"`
+}
+
+// authorizeKubectl applies the policy and the confirmation step to a kubectl request. When
+// the command may not run yet it answers the request and returns false; otherwise it
+// returns the parsed command and an audit entry for the caller to complete.
+func (s *Server) authorizeKubectl(w http.ResponseWriter, r *http.Request, kube KubeClient, req KubectlRequest) (*kubectlCommand, AuditEntry, bool) {
+	entry := AuditEntry{Context: kube.Target().Context, Action: "kubectl", Args: redactKubectlArgs(req.Args)}
+
+	command, err := parseKubectlArgs(req.Args)
+	if err == nil {
+		err = s.policy.checkKubectl(kube, command)
+	}
+	if err != nil {
+		entry.Result = AuditDenied
+		entry.Error = err.Error()
+		s.audit.record(r.Context(), entry)
+		s.sendError(w, err.Error(), http.StatusForbidden)
+		return nil, entry, false
+	}
+	if !s.policy.confirmRequired(command) {
+		return command, entry, true
+	}
+
+	key := confirmationKey(kube.Target().Context, req.Args)
+	if req.ConfirmToken == "" {
+		token, expires, err := s.confirms.issue(key)
+		if err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to issue confirmation token: %v", err), http.StatusInternalServerError)
+			return nil, entry, false
+		}
+		w.WriteHeader(http.StatusPreconditionRequired)
+		response := APIResponse{
+			Success: false,
+			Error:   fmt.Sprintf("kubectl %s needs confirming: repeat the request with confirmToken within %s", command, kubectlConfirmationTTL),
+			Data: KubectlConfirmation{
+				Token:     token,
+				ExpiresAt: expires,
+				Context:   kube.Target().Context,
+				Command:   "kubectl " + strings.Join(req.Args, " "),
+			},
+		}
+		s.sendResponse(w, response)
+		return nil, entry, false
+	}
+	if !s.confirms.redeem(req.ConfirmToken, key) {
+		s.sendError(w, "Confirmation token is invalid, expired or was issued for another command", http.StatusPreconditionFailed)
+		return nil, entry, false
+	}
+	return command, entry, true
+}
+
+// mutating guards a handler that changes the cluster: in read-only mode it is refused
+func (s *Server) mutating(handler http.HandlerFunc) http.HandlerFunc {
+	return s.readOnlyGuard(handler, false)
+}
+
+// mutatingWithPreview guards a handler that honors dryRun/preview. In read-only mode only
+// its dry runs are let through.
+func (s *Server) mutatingWithPreview(handler http.HandlerFunc) http.HandlerFunc {
+	return s.readOnlyGuard(handler, true)
+}
+
+func (s *Server) readOnlyGuard(handler http.HandlerFunc, allowDryRun bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.policy.ReadOnly && !(allowDryRun && isDryRun(r)) {
+			s.audit.record(r.Context(), AuditEntry{
+				Context: w.Header().Get(kubeContextHeader),
+				Action:  "request",
+				Result:  AuditDenied,
+				Error:   "read-only mode",
+			})
+			message := "The backend is in read-only mode"
+			if allowDryRun {
+				message += "; only dry runs are allowed"
+			}
+			s.sendError(w, message, http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (s *Server) handleGetPolicy(w http.ResponseWriter, r *http.Request) {
+	response := APIResponse{Success: true, Data: s.policy}
+	s.sendResponse(w, response)
+}
+
+// kubectlConfirmationTTL bounds how long a confirmation token can be redeemed
+const kubectlConfirmationTTL = 2 * time.Minute
+
+// KubectlConfirmation is returned, with 428 Precondition Required, for a command that
+// needs confirming. Repeating the request with the token in "confirmToken" runs it.
+type KubectlConfirmation struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Context   string    `json:"context"`
+	Command   string    `json:"command"`
+}
+
+// confirmTokenHeader carries the confirmation token on requests through the API proxy,
+// whose bodies belong to the Kubernetes API
+const confirmTokenHeader = "X-Confirm-Token"
+
+// confirmationStore holds single-use tokens, each bound to one command in one context
+type confirmationStore struct {
+	mutex  sync.Mutex
+	tokens map[string]pendingConfirmation
+}
+
+type pendingConfirmation struct {
+	key     string
+	expires time.Time
+}
+
+func newConfirmationStore() *confirmationStore {
+	return &confirmationStore{tokens: make(map[string]pendingConfirmation)}
+}
+
+func confirmationKey(kubeContext string, args []string) string {
+	return kubeContext + "\x00" + strings.Join(args, "\x00")
+}
+
+func (c *confirmationStore) issue(key string) (string, time.Time, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(random)
+	expires := time.Now().Add(kubectlConfirmationTTL)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for existing, pending := range c.tokens {
+		if time.Now().After(pending.expires) {
+			delete(c.tokens, existing)
+		}
+	}
+	c.tokens[token] = pendingConfirmation{key: key, expires: expires}
+	return token, expires, nil
+}
+
+// redeem consumes token if it was issued for key and has not expired
+func (c *confirmationStore) redeem(token, key string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	pending, ok := c.tokens[token]
+	if !ok || pending.key != key {
+		return false
+	}
+	delete(c.tokens, token)
+	return time.Now().Before(pending.expires)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKubectlArgs(t *testing.T) {
+	tests := []struct {
+		args string
+		want kubectlCommand
+	}{
+		{"get pods", kubectlCommand{Verb: "get", Resources: []string{"pods"}}},
+		{"get -n kube-system svc,deploy", kubectlCommand{Verb: "get", Resources: []string{"svc", "deploy"}}},
+		{"-nkube-system get pods", kubectlCommand{Verb: "get", Resources: []string{"pods"}}},
+		{"get pod/web service/web", kubectlCommand{Verb: "get", Resources: []string{"pod", "service"}}},
+		{"get gateways -w", kubectlCommand{Verb: "get", Resources: []string{"gateways"}, Follow: true}},
+		{"get gateways --watch=false", kubectlCommand{Verb: "get", Resources: []string{"gateways"}}},
+		{"apply -f manifest.yaml", kubectlCommand{Verb: "apply", FromFiles: true}},
+		{"apply view-last-applied gateway eg", kubectlCommand{Verb: "apply", Subcommand: "view-last-applied", Resources: []string{"gateway"}}},
+		{"delete httproute web --dry-run=server", kubectlCommand{Verb: "delete", Resources: []string{"httproute"}, DryRun: true}},
+		{"delete httproute web --dry-run=none", kubectlCommand{Verb: "delete", Resources: []string{"httproute"}}},
+		{"logs -f web", kubectlCommand{Verb: "logs", Resources: []string{"pods"}, Follow: true}},
+		{"logs deploy/envoy -c envoy", kubectlCommand{Verb: "logs", Resources: []string{"deploy"}}},
+		{"exec web -- ls -la", kubectlCommand{Verb: "exec", Resources: []string{"pods"}}},
+		{"create secret generic creds --from-literal=user=admin", kubectlCommand{Verb: "create", Resources: []string{"secret"}}},
+		{"create -f manifest.yaml", kubectlCommand{Verb: "create", FromFiles: true}},
+		{"rollout restart deployment/envoy", kubectlCommand{Verb: "rollout", Subcommand: "restart", Resources: []string{"deployment"}}},
+		{"top pods", kubectlCommand{Verb: "top", Subcommand: "pods", Resources: []string{"pods"}}},
+		{"drain node-1", kubectlCommand{Verb: "drain", Resources: []string{"nodes"}}},
+		{"auth can-i delete pods", kubectlCommand{Verb: "auth", Subcommand: "can-i"}},
+		{"get --raw /healthz", kubectlCommand{Verb: "get", FromFiles: true}},
+		{"get pods --help", kubectlCommand{Verb: "get", Resources: []string{"pods"}, Help: true}},
+		{"", kubectlCommand{}},
+	}
+	for _, test := range tests {
+		t.Run(test.args, func(t *testing.T) {
+			command, err := parseKubectlArgs(strings.Fields(test.args))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*command, test.want) {
+				t.Errorf("got %+v, want %+v", *command, test.want)
+			}
+		})
+	}
+}
+
+func TestParseKubectlArgsDeniedFlags(t *testing.T) {
+	for _, args := range []string{
+		"get pods --context other",
+		"get pods --context=other",
+		"get pods --kubeconfig /etc/kubeconfig",
+		"get pods -s https://other:6443",
+		"get pods --token=abc",
+		"get pods --as admin",
+	} {
+		if _, err := parseKubectlArgs(strings.Fields(args)); err == nil {
+			t.Errorf("%q: expected an error", args)
+		}
+	}
+}
+
+func TestAPIProxyCommand(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		want   kubectlCommand
+	}{
+		{http.MethodGet, "/version", kubectlCommand{Verb: "get"}},
+		{http.MethodGet, "/apis/gateway.networking.k8s.io/v1", kubectlCommand{Verb: "get"}},
+		{http.MethodGet, "/api/v1/namespaces", kubectlCommand{Verb: "get", Resources: []string{"namespaces"}}},
+		{http.MethodGet, "/api/v1/namespaces/default", kubectlCommand{Verb: "get", Resources: []string{"namespaces"}}},
+		{http.MethodGet, "/api/v1/namespaces/default/secrets/creds", kubectlCommand{Verb: "get", Resources: []string{"secrets"}}},
+		{http.MethodGet, "/api/v1/nodes?watch=true", kubectlCommand{Verb: "get", Resources: []string{"nodes"}}},
+		{http.MethodGet, "/api/v1/namespaces/demo/services/echo:80/proxy/", kubectlCommand{Verb: "get", Resources: []string{"services"}}},
+		{http.MethodPost, "/apis/gateway.networking.k8s.io/v1/namespaces/default/httproutes", kubectlCommand{Verb: "create", Resources: []string{"httproutes.gateway.networking.k8s.io"}}},
+		{http.MethodPut, "/api/v1/namespaces/default/configmaps/web", kubectlCommand{Verb: "replace", Resources: []string{"configmaps"}}},
+		{http.MethodPatch, "/apis/apps/v1/namespaces/default/deployments/web/scale", kubectlCommand{Verb: "patch", Resources: []string{"deployments.apps"}}},
+		{http.MethodDelete, "/api/v1/namespaces/default/pods/web?dryRun=All", kubectlCommand{Verb: "delete", Resources: []string{"pods"}, DryRun: true}},
+		{"PURGE", "/api/v1/namespaces/default/pods/web", kubectlCommand{Verb: "purge", Resources: []string{"pods"}}},
+	}
+	for _, test := range tests {
+		command := apiProxyCommand(httptest.NewRequest(test.method, test.target, nil))
+		if !reflect.DeepEqual(*command, test.want) {
+			t.Errorf("%s %s: got %+v, want %+v", test.method, test.target, *command, test.want)
+		}
+	}
+}
+
+func TestAuditedAPIProxy(t *testing.T) {
+	s := newTestServer(t, newFakeKubeClient())
+	s.policy = &AccessPolicy{DeniedVerbs: []string{"patch"}, DeniedResources: []string{"secrets"}, ConfirmVerbs: []string{"delete"}}
+	var proxied []string
+	proxy := s.auditedAPIProxy(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.Method+" "+r.URL.Path)
+	}), newFakeKubeClient(), 18001)
+
+	send := func(method, target, token string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			request.Header.Set(confirmTokenHeader, token)
+		}
+		recorder := httptest.NewRecorder()
+		proxy.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for _, target := range []string{"/api/v1/namespaces/default/pods", "/version"} {
+		if recorder := send(http.MethodGet, target, ""); recorder.Code != http.StatusOK {
+			t.Errorf("GET %s: status = %d", target, recorder.Code)
+		}
+	}
+	for method, target := range map[string]string{
+		http.MethodGet:   "/api/v1/namespaces/default/secrets/creds",
+		http.MethodPatch: "/api/v1/namespaces/default/pods/web",
+	} {
+		if recorder := send(method, target, ""); recorder.Code != http.StatusForbidden {
+			t.Errorf("%s %s: status = %d, want %d", method, target, recorder.Code, http.StatusForbidden)
+		}
+	}
+
+	// A delete goes through only with the token issued for that request
+	const pod = "/api/v1/namespaces/default/pods/web"
+	recorder := send(http.MethodDelete, pod, "")
+	token := recorder.Header().Get(confirmTokenHeader)
+	if recorder.Code != http.StatusPreconditionRequired || token == "" {
+		t.Fatalf("DELETE without token: status = %d, token = %q; want 428 with a token", recorder.Code, token)
+	}
+	if recorder := send(http.MethodDelete, "/api/v1/namespaces/default/pods/other", token); recorder.Code != http.StatusPreconditionFailed {
+		t.Errorf("DELETE of another pod: status = %d, want %d", recorder.Code, http.StatusPreconditionFailed)
+	}
+	recorder = send(http.MethodDelete, pod, "")
+	if recorder := send(http.MethodDelete, pod, recorder.Header().Get(confirmTokenHeader)); recorder.Code != http.StatusOK {
+		t.Errorf("confirmed DELETE: status = %d", recorder.Code)
+	}
+
+	want := []string{"GET /api/v1/namespaces/default/pods", "GET /version", "DELETE " + pod}
+	if !reflect.DeepEqual(proxied, want) {
+		t.Errorf("proxied %v, want %v", proxied, want)
+	}
+	entries, err := s.audit.query(auditFilter{Action: "proxy", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []string
+	for _, entry := range entries {
+		results = append(results, entry.Result)
+	}
+	if want := []string{AuditSuccess, AuditDenied, AuditDenied}; !reflect.DeepEqual(results, want) {
+		t.Errorf("audit results %v, want %v", results, want)
+	}
+}
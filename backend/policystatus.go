@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type PolicyCondition struct {
+	Ancestor string `json:"ancestor,omitempty"` // the Gateway or route the condition was reported for
+	Type     string `json:"type"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// policyStatusPollInterval is how often waitForPolicyCondition reads the policy again
+const policyStatusPollInterval = time.Second
+
+// getPolicyConditions reads the per-ancestor conditions Envoy Gateway reports on a policy.
+// Conditions observed for an earlier generation describe a spec that has since changed,
+// so they are left out.
+func (s *Server) getPolicyConditions(ctx context.Context, resource, namespace, name string) ([]PolicyCondition, error) {
+	kube, err := s.kubeClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig setup failed: %v", err)
+	}
+	object, err := kube.Get(ctx, resource, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy struct {
+		Metadata struct {
+			Generation int64 `json:"generation"`
+		} `json:"metadata"`
+		Status struct {
+			Ancestors []struct {
+				AncestorRef struct {
+					Kind      string `json:"kind"`
+					Name      string `json:"name"`
+					Namespace string `json:"namespace"`
+				} `json:"ancestorRef"`
+				Conditions []struct {
+					Type               string `json:"type"`
+					Status             string `json:"status"`
+					Reason             string `json:"reason"`
+					Message            string `json:"message"`
+					ObservedGeneration int64  `json:"observedGeneration"`
+				} `json:"conditions"`
+			} `json:"ancestors"`
+		} `json:"status"`
+	}
+	if err := decodeInto(object, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse %s %s/%s: %v", resource, namespace, name, err)
+	}
+
+	var conditions []PolicyCondition
+	for _, ancestor := range policy.Status.Ancestors {
+		ref := ancestor.AncestorRef.Name
+		if ancestor.AncestorRef.Kind != "" {
+			ref = ancestor.AncestorRef.Kind + "/" + ref
+		}
+		for _, condition := range ancestor.Conditions {
+			if condition.ObservedGeneration < policy.Metadata.Generation {
+				continue
+			}
+			conditions = append(conditions, PolicyCondition{
+				Ancestor: ref,
+				Type:     condition.Type,
+				Status:   condition.Status,
+				Reason:   condition.Reason,
+				Message:  condition.Message,
+			})
+		}
+	}
+	return conditions, nil
+}
+
+// waitForPolicyCondition polls a freshly applied policy until the controller has reported
+// the given condition type for the applied generation, or until the timeout expires.
+// Whatever current conditions were last seen are returned either way so the caller can
+// surface them.
+func (s *Server) waitForPolicyCondition(ctx context.Context, resource, namespace, name, conditionType string, timeout time.Duration) ([]PolicyCondition, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		conditions, err := s.getPolicyConditions(ctx, resource, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, condition := range conditions {
+			if condition.Type == conditionType {
+				return conditions, nil
+			}
+		}
+
+		select {
+		case <-time.After(policyStatusPollInterval):
+		case <-deadline.C:
+			return conditions, nil
+		case <-ctx.Done():
+			return conditions, ctx.Err()
+		}
+	}
+}
+
+// policyRejection returns the message of the first condition reporting a failure, if any
+func policyRejection(conditions []PolicyCondition) string {
+	for _, condition := range conditions {
+		if (condition.Type == "Accepted" || condition.Type == "Programmed") && condition.Status == "False" {
+			return fmt.Sprintf("%s=False (%s): %s", condition.Type, condition.Reason, condition.Message)
+		}
+	}
+	return ""
+}
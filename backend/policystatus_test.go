@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// testPatchPolicy returns an EnvoyPatchPolicy at generation 2 whose ancestor reports
+// conditions observed at the given generations
+func testPatchPolicy(observed map[string]int64) *unstructured.Unstructured {
+	policy := &unstructured.Unstructured{}
+	policy.SetAPIVersion("gateway.envoyproxy.io/v1alpha1")
+	policy.SetKind("EnvoyPatchPolicy")
+	policy.SetNamespace("default")
+	policy.SetName("patch")
+	policy.SetGeneration(2)
+
+	var conditions []interface{}
+	for _, conditionType := range []string{"Accepted", "Programmed"} {
+		if generation, ok := observed[conditionType]; ok {
+			conditions = append(conditions, map[string]interface{}{
+				"type": conditionType, "status": "True", "reason": conditionType, "observedGeneration": generation,
+			})
+		}
+	}
+	policy.Object["status"] = map[string]interface{}{
+		"ancestors": []interface{}{map[string]interface{}{
+			"ancestorRef": map[string]interface{}{"kind": "Gateway", "name": "eg"},
+			"conditions":  conditions,
+		}},
+	}
+	return policy
+}
+
+const testPatchPolicyResource = "envoypatchpolicies.gateway.envoyproxy.io"
+
+func TestGetPolicyConditionsSkipsStaleGenerations(t *testing.T) {
+	s := newTestServer(t, newFakeKubeClient(testPatchPolicy(map[string]int64{"Accepted": 2, "Programmed": 1})))
+
+	conditions, err := s.getPolicyConditions(context.Background(), testPatchPolicyResource, "default", "patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PolicyCondition{{Ancestor: "Gateway/eg", Type: "Accepted", Status: "True", Reason: "Accepted"}}
+	if !reflect.DeepEqual(conditions, want) {
+		t.Errorf("got %+v, want %+v", conditions, want)
+	}
+}
+
+func TestWaitForPolicyCondition(t *testing.T) {
+	s := newTestServer(t, newFakeKubeClient(testPatchPolicy(map[string]int64{"Accepted": 2, "Programmed": 2})))
+	conditions, err := s.waitForPolicyCondition(context.Background(), testPatchPolicyResource, "default", "patch", "Programmed", time.Minute)
+	if err != nil || len(conditions) != 2 {
+		t.Errorf("current generation: conditions = %+v, err = %v", conditions, err)
+	}
+
+	// A Programmed condition left from the previous generation does not end the wait
+	s = newTestServer(t, newFakeKubeClient(testPatchPolicy(map[string]int64{"Accepted": 2, "Programmed": 1})))
+	start := time.Now()
+	conditions, err = s.waitForPolicyCondition(context.Background(), testPatchPolicyResource, "default", "patch", "Programmed", 10*time.Millisecond)
+	if err != nil || len(conditions) != 1 || conditions[0].Type != "Accepted" {
+		t.Errorf("stale generation: conditions = %+v, err = %v", conditions, err)
+	}
+	if elapsed := time.Since(start); elapsed >= policyStatusPollInterval {
+		t.Errorf("waited %s past a %s timeout", elapsed, 10*time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.waitForPolicyCondition(ctx, testPatchPolicyResource, "default", "patch", "Programmed", time.Minute); err != context.Canceled {
+		t.Errorf("cancelled request: err = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// PreviewResult is returned instead of applying when a create/apply endpoint is called
+// with ?dryRun=true (or ?preview=true). Nothing in the cluster is changed.
+type PreviewResult struct {
+	YAML        string          `json:"yaml"`
+	DryRunError string          `json:"dryRunError,omitempty"` // the API server's rejection, if any
+	Objects     []ObjectPreview `json:"objects"`
+}
+
+type ObjectPreview struct {
+	Kind      string        `json:"kind"`
+	Name      string        `json:"name"`
+	Namespace string        `json:"namespace,omitempty"`
+	Action    string        `json:"action"` // "create", "update" or "unchanged"
+	Changes   []FieldChange `json:"changes,omitempty"`
+}
+
+type FieldChange struct {
+	Path    string      `json:"path"` // e.g. "spec.listeners[0].port"
+	Op      string      `json:"op"`   // "add", "remove" or "change"
+	Live    interface{} `json:"live,omitempty"`
+	Desired interface{} `json:"desired,omitempty"`
+}
+
+// isDryRun reports whether the request asked for a preview instead of an apply
+func isDryRun(r *http.Request) bool {
+	for _, param := range []string{"dryRun", "preview"} {
+		switch strings.ToLower(r.URL.Query().Get(param)) {
+		case "true", "1", "yes":
+			return true
+		}
+	}
+	return false
+}
+
+// previewYAML runs a server-side dry-run apply of yamlContent and diffs every object the
+// API server would store against the live object, if one exists. Admission rejections are
+// reported in DryRunError rather than as an error so the caller still sees the YAML.
+func (s *Server) previewYAML(ctx context.Context, yamlContent string) (*PreviewResult, error) {
+	kube, err := s.kubeClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig setup failed: %v", err)
+	}
+
+	result := &PreviewResult{YAML: yamlContent, Objects: []ObjectPreview{}}
+
+	desired, err := kube.Apply(ctx, yamlContent, true)
+	if err != nil {
+		switch kubeErrorReason(err) {
+		case KubeErrorUnreachable, KubeErrorUnauthorized, KubeErrorTimeout:
+			return nil, err
+		}
+		result.DryRunError = err.Error()
+		return result, nil
+	}
+
+	for _, object := range desired {
+		preview := ObjectPreview{Kind: object.GetKind(), Name: object.GetName(), Namespace: object.GetNamespace()}
+
+		// The Kind is singular; the API server's mapping gives the resource it is served as
+		kind := strings.ToLower(object.GetKind())
+		if group := object.GroupVersionKind().Group; group != "" {
+			kind += "." + group
+		}
+		resource, err := kube.ResourceName(kind)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read live objects: %v", err)
+		}
+		liveObject, err := kube.Get(ctx, resource, object.GetNamespace(), object.GetName())
+		switch {
+		case isKubeNotFound(err):
+			preview.Action = "create"
+		case err != nil:
+			return nil, fmt.Errorf("failed to read live objects: %v", err)
+		default:
+			preview.Changes = diffValues("", normalizeObject(liveObject.Object), normalizeObject(object.Object))
+			preview.Action = "update"
+			if len(preview.Changes) == 0 {
+				preview.Action = "unchanged"
+			}
+		}
+		result.Objects = append(result.Objects, preview)
+	}
+	return result, nil
+}
+
+// normalizeObject drops the fields the server manages itself, which would otherwise show
+// up in every diff: status, managedFields, resourceVersion and the like
+func normalizeObject(object map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for key, value := range object {
+		if key != "status" {
+			result[key] = value
+		}
+	}
+
+	if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+		cleaned := map[string]interface{}{}
+		for key, value := range metadata {
+			switch key {
+			case "managedFields", "resourceVersion", "generation", "uid", "creationTimestamp", "selfLink":
+				continue
+			}
+			cleaned[key] = value
+		}
+		if annotations, ok := cleaned["annotations"].(map[string]interface{}); ok {
+			kept := map[string]interface{}{}
+			for key, value := range annotations {
+				if key != "kubectl.kubernetes.io/last-applied-configuration" {
+					kept[key] = value
+				}
+			}
+			if len(kept) > 0 {
+				cleaned["annotations"] = kept
+			} else {
+				delete(cleaned, "annotations")
+			}
+		}
+		result["metadata"] = cleaned
+	}
+	return result
+}
+
+// diffValues walks two decoded JSON values and reports every leaf that differs
+func diffValues(path string, live, desired interface{}) []FieldChange {
+	liveMap, liveIsMap := live.(map[string]interface{})
+	desiredMap, desiredIsMap := desired.(map[string]interface{})
+	if liveIsMap && desiredIsMap {
+		keys := map[string]bool{}
+		for key := range liveMap {
+			keys[key] = true
+		}
+		for key := range desiredMap {
+			keys[key] = true
+		}
+
+		var changes []FieldChange
+		for _, key := range sortedKeys(keys) {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			liveValue, inLive := liveMap[key]
+			desiredValue, inDesired := desiredMap[key]
+			switch {
+			case !inLive:
+				changes = append(changes, FieldChange{Path: childPath, Op: "add", Desired: desiredValue})
+			case !inDesired:
+				changes = append(changes, FieldChange{Path: childPath, Op: "remove", Live: liveValue})
+			default:
+				changes = append(changes, diffValues(childPath, liveValue, desiredValue)...)
+			}
+		}
+		return changes
+	}
+
+	liveList, liveIsList := live.([]interface{})
+	desiredList, desiredIsList := desired.([]interface{})
+	if liveIsList && desiredIsList {
+		var changes []FieldChange
+		for i := 0; i < len(liveList) || i < len(desiredList); i++ {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(liveList):
+				changes = append(changes, FieldChange{Path: childPath, Op: "add", Desired: desiredList[i]})
+			case i >= len(desiredList):
+				changes = append(changes, FieldChange{Path: childPath, Op: "remove", Live: liveList[i]})
+			default:
+				changes = append(changes, diffValues(childPath, liveList[i], desiredList[i])...)
+			}
+		}
+		return changes
+	}
+
+	if reflect.DeepEqual(live, desired) {
+		return nil
+	}
+	return []FieldChange{{Path: path, Op: "change", Live: live, Desired: desired}}
+}
+
+// fetchTemplate downloads a template so that its content can be previewed
+func fetchTemplate(url string) (string, error) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch template: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch template: %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template: %v", err)
+	}
+	return string(body), nil
+}
+
+func (s *Server) sendPreview(w http.ResponseWriter, r *http.Request, yamlContent string, warnings []string) {
+	preview, err := s.previewYAML(r.Context(), yamlContent)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Dry run failed: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	response := APIResponse{Success: preview.DryRunError == "", Data: preview, Warnings: warnings}
+	if preview.DryRunError != "" {
+		response.Error = "The API server rejected the dry run: " + preview.DryRunError
+	}
+	s.sendResponse(w, response)
+}
+
+// joinYAMLDocuments combines several generated manifests into one multi-document stream
+func joinYAMLDocuments(documents ...string) string {
+	return strings.Join(documents, "---\n")
+}
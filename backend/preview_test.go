@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// liveGateway returns testGatewayYAML as the API server would store it, with the fields
+// it manages itself
+func liveGateway(t *testing.T, port float64) *unstructured.Unstructured {
+	t.Helper()
+	objects, err := decodeManifest(testGatewayYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway := objects[0]
+	listeners, _, _ := unstructured.NestedSlice(gateway.Object, "spec", "listeners")
+	listeners[0].(map[string]interface{})["port"] = port
+	if err := unstructured.SetNestedSlice(gateway.Object, listeners, "spec", "listeners"); err != nil {
+		t.Fatal(err)
+	}
+	gateway.SetResourceVersion("1200")
+	gateway.SetGeneration(3)
+	gateway.SetUID("6a1f")
+	gateway.SetAnnotations(map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"})
+	gateway.Object["status"] = map[string]interface{}{"conditions": []interface{}{}}
+	return gateway
+}
+
+func previewApplyYAML(t *testing.T, kube *fakeKubeClient) PreviewResult {
+	t.Helper()
+	s := newTestServer(t, kube)
+	status, response := serve(t, s, http.MethodPost, "/apply-yaml?dryRun=true", applyYAMLBody(t, testGatewayYAML))
+	if status != http.StatusOK || !response.Success {
+		t.Fatalf("status = %d, response = %+v", status, response)
+	}
+	if len(kube.applied) != 0 {
+		t.Errorf("dry run applied %d manifests", len(kube.applied))
+	}
+
+	var preview PreviewResult
+	data, _ := json.Marshal(response.Data)
+	if err := json.Unmarshal(data, &preview); err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Objects) != 1 {
+		t.Fatalf("preview objects = %+v, want one", preview.Objects)
+	}
+	return preview
+}
+
+func TestApplyYAMLDryRun(t *testing.T) {
+	if preview := previewApplyYAML(t, newFakeKubeClient()); preview.Objects[0].Action != "create" {
+		t.Errorf("without a live object: %+v, want create", preview.Objects[0])
+	}
+
+	preview := previewApplyYAML(t, newFakeKubeClient(liveGateway(t, 8080)))
+	object := preview.Objects[0]
+	want := []FieldChange{{Path: "spec.listeners[0].port", Op: "change", Live: float64(8080), Desired: float64(80)}}
+	if object.Action != "update" || !reflect.DeepEqual(object.Changes, want) {
+		t.Errorf("with a changed live object: %+v, want update with %+v", object, want)
+	}
+
+	preview = previewApplyYAML(t, newFakeKubeClient(liveGateway(t, 80)))
+	if object := preview.Objects[0]; object.Action != "unchanged" || len(object.Changes) != 0 {
+		t.Errorf("with an identical live object: %+v, want unchanged", object)
+	}
+}
+
+func TestNormalizeObject(t *testing.T) {
+	object := map[string]interface{}{
+		"kind": "Gateway",
+		"metadata": map[string]interface{}{
+			"name":              "eg",
+			"resourceVersion":   "1200",
+			"generation":        int64(3),
+			"uid":               "6a1f",
+			"creationTimestamp": "2026-01-01T00:00:00Z",
+			"managedFields":     []interface{}{},
+			"annotations": map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+				"team": "edge",
+			},
+		},
+		"spec":   map[string]interface{}{"gatewayClassName": "eg"},
+		"status": map[string]interface{}{"conditions": []interface{}{}},
+	}
+	want := map[string]interface{}{
+		"kind": "Gateway",
+		"metadata": map[string]interface{}{
+			"name":        "eg",
+			"annotations": map[string]interface{}{"team": "edge"},
+		},
+		"spec": map[string]interface{}{"gatewayClassName": "eg"},
+	}
+	if got := normalizeObject(object); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Annotations that only held last-applied-configuration are dropped entirely
+	object["metadata"].(map[string]interface{})["annotations"] = map[string]interface{}{
+		"kubectl.kubernetes.io/last-applied-configuration": "{}",
+	}
+	metadata := normalizeObject(object)["metadata"].(map[string]interface{})
+	if _, ok := metadata["annotations"]; ok {
+		t.Errorf("annotations kept: %v", metadata)
+	}
+}
+
+func TestDiffValues(t *testing.T) {
+	live := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"hostnames": []interface{}{"a.example.com", "b.example.com"},
+			"rules":     []interface{}{map[string]interface{}{"weight": 1.0}},
+			"timeout":   "10s",
+		},
+	}
+	desired := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"hostnames": []interface{}{"a.example.com"},
+			"rules":     []interface{}{map[string]interface{}{"weight": 2.0}, map[string]interface{}{"weight": 1.0}},
+			"tls":       true,
+		},
+	}
+	want := []FieldChange{
+		{Path: "spec.hostnames[1]", Op: "remove", Live: "b.example.com"},
+		{Path: "spec.rules[0].weight", Op: "change", Live: 1.0, Desired: 2.0},
+		{Path: "spec.rules[1]", Op: "add", Desired: map[string]interface{}{"weight": 1.0}},
+		{Path: "spec.timeout", Op: "remove", Live: "10s"},
+		{Path: "spec.tls", Op: "add", Desired: true},
+	}
+	if got := diffValues("", live, desired); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+
+	if got := diffValues("", live, live); got != nil {
+		t.Errorf("identical values: %+v", got)
+	}
+	if got := diffValues("spec.port", "80", 80.0); len(got) != 1 || got[0].Op != "change" {
+		t.Errorf("type change: %+v", got)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ReferenceGrantTarget lists the Services in one namespace that a route references
+// from another namespace
+type ReferenceGrantTarget struct {
+	Namespace string   `json:"namespace"`
+	Services  []string `json:"services"`
+}
+
+func httpRouteParentRef(data HTTPRouteFormData) ParentRefFormData {
+	return ParentRefFormData{
+		Name:        data.ParentGateway,
+		Namespace:   data.ParentGatewayNamespace,
+		SectionName: data.ParentSectionName,
+		Port:        data.ParentPort,
+	}
+}
+
+// crossNamespaceBackendRefs collects every backendRef, including mirror targets, that
+// lives outside the route's own namespace, grouped by target namespace
+func crossNamespaceBackendRefs(data HTTPRouteFormData) []ReferenceGrantTarget {
+	services := map[string]map[string]bool{}
+	add := func(ref HTTPBackendRefFormData) {
+		if ref.Namespace == "" || ref.Namespace == data.Namespace {
+			return
+		}
+		if services[ref.Namespace] == nil {
+			services[ref.Namespace] = map[string]bool{}
+		}
+		services[ref.Namespace][ref.Name] = true
+	}
+	addMirrors := func(filters []HTTPRouteFilterFormData) {
+		for _, filter := range filters {
+			if filter.RequestMirror != nil {
+				add(filter.RequestMirror.BackendRef)
+			}
+		}
+	}
+
+	for _, rule := range data.Rules {
+		addMirrors(rule.Filters)
+		for _, ref := range rule.BackendRefs {
+			add(ref)
+			addMirrors(ref.Filters)
+		}
+	}
+
+	targets := make([]ReferenceGrantTarget, 0, len(services))
+	for namespace, names := range services {
+		target := ReferenceGrantTarget{Namespace: namespace}
+		for name := range names {
+			target.Services = append(target.Services, name)
+		}
+		sort.Strings(target.Services)
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Namespace < targets[j].Namespace })
+	return targets
+}
+
+// generateReferenceGrantYAML allows routes of the given kind in fromNamespace to
+// reference the target Services. The grant is shared by every route of that kind from
+// fromNamespace, and applying replaces its "to" list, so the Services an existing grant
+// already allows are kept.
+func (s *Server) generateReferenceGrantYAML(ctx context.Context, routeKind, fromNamespace string, target ReferenceGrantTarget) (string, error) {
+	name := fmt.Sprintf("allow-%s-from-%s", strings.ToLower(routeKind), fromNamespace)
+	to, err := s.getReferenceGrantTo(ctx, target.Namespace, name)
+	if err != nil {
+		return "", err
+	}
+	for _, service := range target.Services {
+		ref := ReferenceGrantTo{Group: "", Kind: "Service", Name: service}
+		if !containsReferenceGrantTo(to, ref) {
+			to = append(to, ref)
+		}
+	}
+
+	grant := ReferenceGrantResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.networking.k8s.io/v1beta1", Kind: "ReferenceGrant"},
+		Metadata: ObjectMeta{
+			Name:      name,
+			Namespace: target.Namespace,
+		},
+		Spec: ReferenceGrantSpec{
+			From: []ReferenceGrantFrom{{Group: "gateway.networking.k8s.io", Kind: routeKind, Namespace: fromNamespace}},
+			To:   to,
+		},
+	}
+	return marshalResource(grant)
+}
+
+// getReferenceGrantTo returns the "to" list of an existing grant, or nothing when there
+// is no such grant yet
+func (s *Server) getReferenceGrantTo(ctx context.Context, namespace, name string) ([]ReferenceGrantTo, error) {
+	kube, err := s.kubeClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig setup failed: %v", err)
+	}
+	object, err := kube.Get(ctx, "referencegrants.gateway.networking.k8s.io", namespace, name)
+	if isKubeNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ReferenceGrant %s/%s: %w", namespace, name, err)
+	}
+
+	var grant struct {
+		Spec struct {
+			To []struct {
+				Group string `json:"group"`
+				Kind  string `json:"kind"`
+				Name  string `json:"name"`
+			} `json:"to"`
+		} `json:"spec"`
+	}
+	if err := decodeInto(object, &grant); err != nil {
+		return nil, fmt.Errorf("failed to parse ReferenceGrant %s/%s: %v", namespace, name, err)
+	}
+	to := make([]ReferenceGrantTo, len(grant.Spec.To))
+	for i, ref := range grant.Spec.To {
+		to[i] = ReferenceGrantTo{Group: ref.Group, Kind: ref.Kind, Name: ref.Name}
+	}
+	return to, nil
+}
+
+// containsReferenceGrantTo reports whether refs already allow ref. An entry without a
+// name allows every object of its kind.
+func containsReferenceGrantTo(refs []ReferenceGrantTo, ref ReferenceGrantTo) bool {
+	for _, existing := range refs {
+		if existing.Group == ref.Group && existing.Kind == ref.Kind && (existing.Name == "" || existing.Name == ref.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAllowedRoutes returns a warning for every reason the parent Gateway's listeners
+// would refuse to attach a route of the given kind from routeNamespace. It never fails
+// the request: a Gateway that cannot be read simply produces a warning.
+func (s *Server) checkAllowedRoutes(ctx context.Context, routeKind, routeNamespace string, parentRef ParentRefFormData) []string {
+	gatewayNamespace := parentRef.Namespace
+	if gatewayNamespace == "" {
+		gatewayNamespace = routeNamespace
+	}
+
+	listeners, err := s.getGatewayListeners(ctx, gatewayNamespace, parentRef.Name)
+	if err != nil {
+		return []string{fmt.Sprintf("Could not verify allowedRoutes: %v", err)}
+	}
+
+	var namespaceLabels map[string]string
+	var reasons []string
+	candidates := 0
+	for _, listener := range listeners {
+		if parentRef.SectionName != "" && listener.Name != parentRef.SectionName {
+			continue
+		}
+		if parentRef.Port != 0 && listener.Port != parentRef.Port {
+			continue
+		}
+		candidates++
+
+		if !listenerAllowsKind(listener, routeKind) {
+			reasons = append(reasons, fmt.Sprintf("listener %s does not allow %s routes", listener.Name, routeKind))
+			continue
+		}
+
+		from := "Same"
+		if listener.AllowedRoutes != nil && listener.AllowedRoutes.Namespaces != nil && listener.AllowedRoutes.Namespaces.From != "" {
+			from = listener.AllowedRoutes.Namespaces.From
+		}
+
+		switch from {
+		case "All":
+			return nil
+		case "Same":
+			if routeNamespace == gatewayNamespace {
+				return nil
+			}
+			reasons = append(reasons, fmt.Sprintf("listener %s only allows routes from namespace %s", listener.Name, gatewayNamespace))
+		case "Selector":
+			if namespaceLabels == nil {
+				namespaceLabels, err = s.getNamespaceLabels(ctx, routeNamespace)
+				if err != nil {
+					return []string{fmt.Sprintf("Could not verify allowedRoutes: %v", err)}
+				}
+			}
+			if labelsMatchSelector(namespaceLabels, listener.AllowedRoutes.Namespaces.Selector) {
+				return nil
+			}
+			reasons = append(reasons, fmt.Sprintf("listener %s namespace selector does not match namespace %s", listener.Name, routeNamespace))
+		}
+	}
+
+	if candidates == 0 {
+		return []string{fmt.Sprintf("Gateway %s/%s has no listener matching the parentRef", gatewayNamespace, parentRef.Name)}
+	}
+
+	warnings := make([]string, len(reasons))
+	for i, reason := range reasons {
+		warnings[i] = fmt.Sprintf("Gateway %s/%s may reject %s from namespace %s: %s", gatewayNamespace, parentRef.Name, routeKind, routeNamespace, reason)
+	}
+	return warnings
+}
+
+// listenerAllowsKind applies allowedRoutes.kinds, falling back to the kinds the
+// listener protocol supports when none are listed
+func listenerAllowsKind(listener Listener, routeKind string) bool {
+	if listener.AllowedRoutes != nil && len(listener.AllowedRoutes.Kinds) > 0 {
+		for _, kind := range listener.AllowedRoutes.Kinds {
+			if kind.Kind == routeKind && (kind.Group == "" || kind.Group == "gateway.networking.k8s.io") {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch listener.Protocol {
+	case "HTTP", "HTTPS":
+		return routeKind == "HTTPRoute" || routeKind == "GRPCRoute"
+	default:
+		return l4RouteProtocols[routeKind] == listener.Protocol
+	}
+}
+
+func labelsMatchSelector(labels map[string]string, selector *LabelSelector) bool {
+	if selector == nil {
+		return true
+	}
+	for key, value := range selector.MatchLabels {
+		if labels[key] != value {
+			return false
+		}
+	}
+	for _, expr := range selector.MatchExpressions {
+		value, exists := labels[expr.Key]
+		switch expr.Operator {
+		case "In":
+			if !exists || !containsString(expr.Values, value) {
+				return false
+			}
+		case "NotIn":
+			if exists && containsString(expr.Values, value) {
+				return false
+			}
+		case "Exists":
+			if !exists {
+				return false
+			}
+		case "DoesNotExist":
+			if exists {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) getNamespaceLabels(ctx context.Context, namespace string) (map[string]string, error) {
+	kube, err := s.kubeClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig setup failed: %v", err)
+	}
+
+	object, err := kube.Get(ctx, "namespaces", "", namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var ns struct {
+		Metadata struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+	}
+	if err := decodeInto(object, &ns); err != nil {
+		return nil, fmt.Errorf("failed to parse namespace %s: %v", namespace, err)
+	}
+	if ns.Metadata.Labels == nil {
+		ns.Metadata.Labels = map[string]string{}
+	}
+	return ns.Metadata.Labels, nil
+}
@@ -0,0 +1,788 @@
+package main
+
+import "gopkg.in/yaml.v2"
+
+// Typed models of the Kubernetes resources the backend generates. Every generator
+// builds one of these and marshals it, so field names and quoting are always handled
+// by the YAML encoder rather than by string formatting.
+
+type TypeMeta struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+}
+
+type ObjectMeta struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// Gateway API: gateway.networking.k8s.io
+
+type GatewayResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta  `yaml:"metadata"`
+	Spec     GatewaySpec `yaml:"spec"`
+}
+
+type GatewaySpec struct {
+	GatewayClassName string                 `yaml:"gatewayClassName"`
+	Listeners        []GatewayListener      `yaml:"listeners"`
+	Addresses        []GatewayAddress       `yaml:"addresses,omitempty"`
+	Infrastructure   *GatewayInfrastructure `yaml:"infrastructure,omitempty"`
+}
+
+type GatewayListener struct {
+	Name          string            `yaml:"name"`
+	Hostname      string            `yaml:"hostname,omitempty"`
+	Port          int               `yaml:"port"`
+	Protocol      string            `yaml:"protocol"`
+	TLS           *GatewayTLSConfig `yaml:"tls,omitempty"`
+	AllowedRoutes *AllowedRoutes    `yaml:"allowedRoutes,omitempty"`
+}
+
+type GatewayTLSConfig struct {
+	Mode            string                  `yaml:"mode,omitempty"`
+	CertificateRefs []SecretObjectReference `yaml:"certificateRefs,omitempty"`
+}
+
+// AllowedRoutes is also the listener form input, so it and its parts carry json tags too
+type AllowedRoutes struct {
+	Namespaces *RouteNamespaces `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	Kinds      []RouteGroupKind `json:"kinds,omitempty" yaml:"kinds,omitempty"`
+}
+
+type RouteNamespaces struct {
+	From     string         `json:"from,omitempty" yaml:"from,omitempty"` // "All", "Same" or "Selector"
+	Selector *LabelSelector `json:"selector,omitempty" yaml:"selector,omitempty"`
+}
+
+type RouteGroupKind struct {
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+	Kind  string `json:"kind" yaml:"kind"`
+}
+
+type LabelSelector struct {
+	MatchLabels      map[string]string          `json:"matchLabels,omitempty" yaml:"matchLabels,omitempty"`
+	MatchExpressions []LabelSelectorRequirement `json:"matchExpressions,omitempty" yaml:"matchExpressions,omitempty"`
+}
+
+type LabelSelectorRequirement struct {
+	Key      string   `json:"key" yaml:"key"`
+	Operator string   `json:"operator" yaml:"operator"` // "In", "NotIn", "Exists" or "DoesNotExist"
+	Values   []string `json:"values,omitempty" yaml:"values,omitempty"`
+}
+
+type SecretObjectReference struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+type GatewayClassResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta       `yaml:"metadata"`
+	Spec     GatewayClassSpec `yaml:"spec"`
+}
+
+type GatewayClassSpec struct {
+	ControllerName string               `yaml:"controllerName"`
+	ParametersRef  *ParametersReference `yaml:"parametersRef,omitempty"`
+	Description    string               `yaml:"description,omitempty"`
+}
+
+type ParametersReference struct {
+	Group     string `yaml:"group"`
+	Kind      string `yaml:"kind"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+type ParentReference struct {
+	Namespace   string `yaml:"namespace,omitempty"`
+	Name        string `yaml:"name"`
+	SectionName string `yaml:"sectionName,omitempty"`
+	Port        int    `yaml:"port,omitempty"`
+}
+
+type BackendObjectReference struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+	Port      int    `yaml:"port,omitempty"`
+}
+
+type HTTPRouteResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta    `yaml:"metadata"`
+	Spec     HTTPRouteSpec `yaml:"spec"`
+}
+
+type HTTPRouteSpec struct {
+	ParentRefs []ParentReference `yaml:"parentRefs"`
+	Hostnames  []string          `yaml:"hostnames,omitempty"`
+	Rules      []HTTPRouteRule   `yaml:"rules"`
+}
+
+type HTTPRouteRule struct {
+	Name        string             `yaml:"name,omitempty"`
+	Matches     []HTTPRouteMatch   `yaml:"matches,omitempty"`
+	Filters     []HTTPRouteFilter  `yaml:"filters,omitempty"`
+	BackendRefs []HTTPBackendRef   `yaml:"backendRefs"`
+	Timeouts    *HTTPRouteTimeouts `yaml:"timeouts,omitempty"`
+}
+
+type HTTPRouteMatch struct {
+	Path        *HTTPPathMatch        `yaml:"path,omitempty"`
+	Headers     []HTTPHeaderMatch     `yaml:"headers,omitempty"`
+	QueryParams []HTTPQueryParamMatch `yaml:"queryParams,omitempty"`
+	Method      string                `yaml:"method,omitempty"`
+}
+
+type HTTPPathMatch struct {
+	Type  string `yaml:"type,omitempty"`
+	Value string `yaml:"value"`
+}
+
+type HTTPHeaderMatch struct {
+	Type  string `yaml:"type,omitempty"`
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type HTTPQueryParamMatch struct {
+	Type  string `yaml:"type,omitempty"`
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// HTTPBackendRef keeps Weight as a pointer so that an explicit weight of 0, which
+// drains a backend, is written out instead of falling back to the default of 1
+type HTTPBackendRef struct {
+	BackendObjectReference `yaml:",inline"`
+	Weight                 *int              `yaml:"weight,omitempty"`
+	Filters                []HTTPRouteFilter `yaml:"filters,omitempty"`
+}
+
+type HTTPRouteFilter struct {
+	Type                   string                     `yaml:"type"`
+	RequestHeaderModifier  *HTTPHeaderFilter          `yaml:"requestHeaderModifier,omitempty"`
+	ResponseHeaderModifier *HTTPHeaderFilter          `yaml:"responseHeaderModifier,omitempty"`
+	RequestMirror          *HTTPRequestMirrorFilter   `yaml:"requestMirror,omitempty"`
+	RequestRedirect        *HTTPRequestRedirectFilter `yaml:"requestRedirect,omitempty"`
+	URLRewrite             *HTTPURLRewriteFilter      `yaml:"urlRewrite,omitempty"`
+}
+
+type HTTPHeaderFilter struct {
+	Set    []HTTPHeader `yaml:"set,omitempty"`
+	Add    []HTTPHeader `yaml:"add,omitempty"`
+	Remove []string     `yaml:"remove,omitempty"`
+}
+
+type HTTPHeader struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type HTTPRequestRedirectFilter struct {
+	Scheme     string            `yaml:"scheme,omitempty"`
+	Hostname   string            `yaml:"hostname,omitempty"`
+	Path       *HTTPPathModifier `yaml:"path,omitempty"`
+	Port       int               `yaml:"port,omitempty"`
+	StatusCode int               `yaml:"statusCode,omitempty"`
+}
+
+type HTTPURLRewriteFilter struct {
+	Hostname string            `yaml:"hostname,omitempty"`
+	Path     *HTTPPathModifier `yaml:"path,omitempty"`
+}
+
+type HTTPPathModifier struct {
+	Type               string `yaml:"type"`
+	ReplaceFullPath    string `yaml:"replaceFullPath,omitempty"`
+	ReplacePrefixMatch string `yaml:"replacePrefixMatch,omitempty"`
+}
+
+type HTTPRequestMirrorFilter struct {
+	BackendRef BackendObjectReference `yaml:"backendRef"`
+	Percent    int                    `yaml:"percent,omitempty"`
+	Fraction   *MirrorFraction        `yaml:"fraction,omitempty"`
+}
+
+type MirrorFraction struct {
+	Numerator   int `yaml:"numerator"`
+	Denominator int `yaml:"denominator,omitempty"`
+}
+
+type HTTPRouteTimeouts struct {
+	Request        string `yaml:"request,omitempty"`
+	BackendRequest string `yaml:"backendRequest,omitempty"`
+}
+
+type GRPCRouteResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta    `yaml:"metadata"`
+	Spec     GRPCRouteSpec `yaml:"spec"`
+}
+
+type GRPCRouteSpec struct {
+	ParentRefs []ParentReference `yaml:"parentRefs"`
+	Hostnames  []string          `yaml:"hostnames,omitempty"`
+	Rules      []GRPCRouteRule   `yaml:"rules"`
+}
+
+type GRPCRouteRule struct {
+	Name        string            `yaml:"name,omitempty"`
+	Matches     []GRPCRouteMatch  `yaml:"matches,omitempty"`
+	Filters     []GRPCRouteFilter `yaml:"filters,omitempty"`
+	BackendRefs []GRPCBackendRef  `yaml:"backendRefs"`
+}
+
+type GRPCRouteMatch struct {
+	Method  *GRPCMethodMatch  `yaml:"method,omitempty"`
+	Headers []HTTPHeaderMatch `yaml:"headers,omitempty"`
+}
+
+type GRPCMethodMatch struct {
+	Type    string `yaml:"type,omitempty"`
+	Service string `yaml:"service,omitempty"`
+	Method  string `yaml:"method,omitempty"`
+}
+
+type GRPCBackendRef struct {
+	BackendObjectReference `yaml:",inline"`
+	Weight                 *int              `yaml:"weight,omitempty"`
+	Filters                []GRPCRouteFilter `yaml:"filters,omitempty"`
+}
+
+type GRPCRouteFilter struct {
+	Type                   string                   `yaml:"type"`
+	RequestHeaderModifier  *HTTPHeaderFilter        `yaml:"requestHeaderModifier,omitempty"`
+	ResponseHeaderModifier *HTTPHeaderFilter        `yaml:"responseHeaderModifier,omitempty"`
+	RequestMirror          *HTTPRequestMirrorFilter `yaml:"requestMirror,omitempty"`
+}
+
+// L4RouteResource covers TCPRoute, UDPRoute and TLSRoute, which only differ in kind
+// and in TLSRoute accepting hostnames
+type L4RouteResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta  `yaml:"metadata"`
+	Spec     L4RouteSpec `yaml:"spec"`
+}
+
+type L4RouteSpec struct {
+	ParentRefs []ParentReference `yaml:"parentRefs"`
+	Hostnames  []string          `yaml:"hostnames,omitempty"`
+	Rules      []L4RouteRule     `yaml:"rules"`
+}
+
+type L4RouteRule struct {
+	BackendRefs []L4BackendRef `yaml:"backendRefs"`
+}
+
+type L4BackendRef struct {
+	BackendObjectReference `yaml:",inline"`
+	Weight                 *int `yaml:"weight,omitempty"`
+}
+
+type ReferenceGrantResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta         `yaml:"metadata"`
+	Spec     ReferenceGrantSpec `yaml:"spec"`
+}
+
+type ReferenceGrantSpec struct {
+	From []ReferenceGrantFrom `yaml:"from"`
+	To   []ReferenceGrantTo   `yaml:"to"`
+}
+
+type ReferenceGrantFrom struct {
+	Group     string `yaml:"group"`
+	Kind      string `yaml:"kind"`
+	Namespace string `yaml:"namespace"`
+}
+
+// ReferenceGrantTo always writes group, since the core API group is the empty string
+type ReferenceGrantTo struct {
+	Group string `yaml:"group"`
+	Kind  string `yaml:"kind"`
+	Name  string `yaml:"name,omitempty"`
+}
+
+type BackendTLSPolicyResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta           `yaml:"metadata"`
+	Spec     BackendTLSPolicySpec `yaml:"spec"`
+}
+
+type BackendTLSPolicySpec struct {
+	TargetRefs []LocalPolicyTargetReference `yaml:"targetRefs"`
+	Validation BackendTLSPolicyValidation   `yaml:"validation"`
+}
+
+type BackendTLSPolicyValidation struct {
+	CACertificateRefs       []LocalObjectReference `yaml:"caCertificateRefs,omitempty"`
+	WellKnownCACertificates string                 `yaml:"wellKnownCACertificates,omitempty"`
+	Hostname                string                 `yaml:"hostname"`
+}
+
+// LocalPolicyTargetReference always writes group, since Services live in the core API
+// group, which is the empty string
+type LocalPolicyTargetReference struct {
+	Group       string `yaml:"group"`
+	Kind        string `yaml:"kind"`
+	Name        string `yaml:"name"`
+	SectionName string `yaml:"sectionName,omitempty"`
+}
+
+type LocalObjectReference struct {
+	Group string `yaml:"group"`
+	Kind  string `yaml:"kind"`
+	Name  string `yaml:"name"`
+}
+
+// cert-manager: cert-manager.io
+
+type CertificateResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta      `yaml:"metadata"`
+	Spec     CertificateSpec `yaml:"spec"`
+}
+
+type CertificateSpec struct {
+	DNSNames   []string        `yaml:"dnsNames"`
+	SecretName string          `yaml:"secretName"`
+	IssuerRef  IssuerReference `yaml:"issuerRef"`
+}
+
+type IssuerReference struct {
+	Name string `yaml:"name"`
+	Kind string `yaml:"kind"`
+}
+
+type ClusterIssuerResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta        `yaml:"metadata"`
+	Spec     ClusterIssuerSpec `yaml:"spec"`
+}
+
+type ClusterIssuerSpec struct {
+	SelfSigned *struct{} `yaml:"selfSigned,omitempty"`
+}
+
+// Envoy Gateway: gateway.envoyproxy.io
+
+type SecurityPolicyResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta         `yaml:"metadata"`
+	Spec     SecurityPolicySpec `yaml:"spec"`
+}
+
+type SecurityPolicySpec struct {
+	TargetRefs    []LocalPolicyTargetReference `yaml:"targetRefs"`
+	CORS          *CORS                        `yaml:"cors,omitempty"`
+	BasicAuth     *BasicAuth                   `yaml:"basicAuth,omitempty"`
+	JWT           *JWT                         `yaml:"jwt,omitempty"`
+	OIDC          *OIDC                        `yaml:"oidc,omitempty"`
+	Authorization *Authorization               `yaml:"authorization,omitempty"`
+}
+
+type CORS struct {
+	AllowOrigins     []string `yaml:"allowOrigins"`
+	AllowMethods     []string `yaml:"allowMethods,omitempty"`
+	AllowHeaders     []string `yaml:"allowHeaders,omitempty"`
+	ExposeHeaders    []string `yaml:"exposeHeaders,omitempty"`
+	MaxAge           string   `yaml:"maxAge,omitempty"`
+	AllowCredentials bool     `yaml:"allowCredentials,omitempty"`
+}
+
+type BasicAuth struct {
+	Users SecretObjectReference `yaml:"users"`
+}
+
+type JWT struct {
+	Providers []JWTProvider `yaml:"providers"`
+}
+
+type JWTProvider struct {
+	Name           string          `yaml:"name"`
+	Issuer         string          `yaml:"issuer,omitempty"`
+	Audiences      []string        `yaml:"audiences,omitempty"`
+	RemoteJWKS     *RemoteJWKS     `yaml:"remoteJWKS,omitempty"`
+	LocalJWKS      *LocalJWKS      `yaml:"localJWKS,omitempty"`
+	ClaimToHeaders []ClaimToHeader `yaml:"claimToHeaders,omitempty"`
+}
+
+type RemoteJWKS struct {
+	URI string `yaml:"uri"`
+}
+
+type LocalJWKS struct {
+	Type   string `yaml:"type"`
+	Inline string `yaml:"inline"`
+}
+
+type ClaimToHeader struct {
+	Header string `yaml:"header"`
+	Claim  string `yaml:"claim"`
+}
+
+type OIDC struct {
+	Provider     OIDCProvider          `yaml:"provider"`
+	ClientID     string                `yaml:"clientID"`
+	ClientSecret SecretObjectReference `yaml:"clientSecret"`
+	Scopes       []string              `yaml:"scopes,omitempty"`
+	RedirectURL  string                `yaml:"redirectURL,omitempty"`
+	LogoutPath   string                `yaml:"logoutPath,omitempty"`
+}
+
+type OIDCProvider struct {
+	Issuer string `yaml:"issuer"`
+}
+
+type Authorization struct {
+	Rules         []AuthorizationRule `yaml:"rules"`
+	DefaultAction string              `yaml:"defaultAction,omitempty"`
+}
+
+type AuthorizationRule struct {
+	Name      string    `yaml:"name,omitempty"`
+	Action    string    `yaml:"action"`
+	Principal Principal `yaml:"principal"`
+}
+
+type Principal struct {
+	ClientCIDRs []string `yaml:"clientCIDRs"`
+}
+
+type BackendTrafficPolicyResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta               `yaml:"metadata"`
+	Spec     BackendTrafficPolicySpec `yaml:"spec"`
+}
+
+type BackendTrafficPolicySpec struct {
+	TargetRefs     []LocalPolicyTargetReference `yaml:"targetRefs"`
+	RateLimit      *RateLimit                   `yaml:"rateLimit,omitempty"`
+	LoadBalancer   *LoadBalancer                `yaml:"loadBalancer,omitempty"`
+	CircuitBreaker *CircuitBreaker              `yaml:"circuitBreaker,omitempty"`
+	HealthCheck    *HealthCheck                 `yaml:"healthCheck,omitempty"`
+	Retry          *Retry                       `yaml:"retry,omitempty"`
+}
+
+type RateLimit struct {
+	Type  string          `yaml:"type"`
+	Local *LocalRateLimit `yaml:"local,omitempty"`
+}
+
+type LocalRateLimit struct {
+	Rules []RateLimitRule `yaml:"rules"`
+}
+
+type RateLimitRule struct {
+	ClientSelectors []RateLimitSelectCondition `yaml:"clientSelectors,omitempty"`
+	Limit           RateLimitValue             `yaml:"limit"`
+}
+
+type RateLimitSelectCondition struct {
+	Headers []HTTPHeaderMatch `yaml:"headers,omitempty"`
+}
+
+type RateLimitValue struct {
+	Requests int    `yaml:"requests"`
+	Unit     string `yaml:"unit"`
+}
+
+type LoadBalancer struct {
+	Type           string          `yaml:"type"`
+	ConsistentHash *ConsistentHash `yaml:"consistentHash,omitempty"`
+	SlowStart      *SlowStart      `yaml:"slowStart,omitempty"`
+}
+
+type ConsistentHash struct {
+	Type   string      `yaml:"type"`
+	Header *HeaderHash `yaml:"header,omitempty"`
+	Cookie *CookieHash `yaml:"cookie,omitempty"`
+}
+
+type HeaderHash struct {
+	Name string `yaml:"name"`
+}
+
+type CookieHash struct {
+	Name string `yaml:"name"`
+	TTL  string `yaml:"ttl,omitempty"`
+}
+
+type SlowStart struct {
+	Window string `yaml:"window"`
+}
+
+type CircuitBreaker struct {
+	MaxConnections           int `yaml:"maxConnections,omitempty"`
+	MaxPendingRequests       int `yaml:"maxPendingRequests,omitempty"`
+	MaxParallelRequests      int `yaml:"maxParallelRequests,omitempty"`
+	MaxParallelRetries       int `yaml:"maxParallelRetries,omitempty"`
+	MaxRequestsPerConnection int `yaml:"maxRequestsPerConnection,omitempty"`
+}
+
+type HealthCheck struct {
+	Active  *ActiveHealthCheck  `yaml:"active,omitempty"`
+	Passive *PassiveHealthCheck `yaml:"passive,omitempty"`
+}
+
+type ActiveHealthCheck struct {
+	Type               string                   `yaml:"type"`
+	Timeout            string                   `yaml:"timeout,omitempty"`
+	Interval           string                   `yaml:"interval,omitempty"`
+	UnhealthyThreshold int                      `yaml:"unhealthyThreshold,omitempty"`
+	HealthyThreshold   int                      `yaml:"healthyThreshold,omitempty"`
+	HTTP               *HTTPActiveHealthChecker `yaml:"http,omitempty"`
+}
+
+type HTTPActiveHealthChecker struct {
+	Path             string `yaml:"path"`
+	Method           string `yaml:"method,omitempty"`
+	ExpectedStatuses []int  `yaml:"expectedStatuses,omitempty"`
+}
+
+type PassiveHealthCheck struct {
+	Consecutive5XxErrors     int    `yaml:"consecutive5XxErrors,omitempty"`
+	ConsecutiveGatewayErrors int    `yaml:"consecutiveGatewayErrors,omitempty"`
+	Interval                 string `yaml:"interval,omitempty"`
+	BaseEjectionTime         string `yaml:"baseEjectionTime,omitempty"`
+	MaxEjectionPercent       int    `yaml:"maxEjectionPercent,omitempty"`
+}
+
+// Retry keeps NumRetries as a pointer so that an explicit 0, which disables retries,
+// is written out instead of falling back to Envoy Gateway's default of 2
+type Retry struct {
+	NumRetries *int            `yaml:"numRetries,omitempty"`
+	RetryOn    *RetryOn        `yaml:"retryOn,omitempty"`
+	PerRetry   *PerRetryPolicy `yaml:"perRetry,omitempty"`
+}
+
+type RetryOn struct {
+	Triggers        []string `yaml:"triggers,omitempty"`
+	HTTPStatusCodes []int    `yaml:"httpStatusCodes,omitempty"`
+}
+
+type PerRetryPolicy struct {
+	Timeout string         `yaml:"timeout,omitempty"`
+	BackOff *BackOffPolicy `yaml:"backOff,omitempty"`
+}
+
+type BackOffPolicy struct {
+	BaseInterval string `yaml:"baseInterval,omitempty"`
+	MaxInterval  string `yaml:"maxInterval,omitempty"`
+}
+
+type ClientTrafficPolicyResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta              `yaml:"metadata"`
+	Spec     ClientTrafficPolicySpec `yaml:"spec"`
+}
+
+// ClientTrafficPolicySpec writes HTTP3 as an empty object, which is how Envoy Gateway
+// enables HTTP/3 on the targeted listeners
+type ClientTrafficPolicySpec struct {
+	TargetRefs          []LocalPolicyTargetReference `yaml:"targetRefs"`
+	TCPKeepalive        *TCPKeepalive                `yaml:"tcpKeepalive,omitempty"`
+	EnableProxyProtocol bool                         `yaml:"enableProxyProtocol,omitempty"`
+	ClientIPDetection   *ClientIPDetection           `yaml:"clientIPDetection,omitempty"`
+	TLS                 *ClientTLSSettings           `yaml:"tls,omitempty"`
+	Path                *PathSettings                `yaml:"path,omitempty"`
+	HTTP2               *HTTP2Settings               `yaml:"http2,omitempty"`
+	HTTP3               *struct{}                    `yaml:"http3,omitempty"`
+	Connection          *ClientConnection            `yaml:"connection,omitempty"`
+}
+
+type TCPKeepalive struct {
+	Probes   int    `yaml:"probes,omitempty"`
+	IdleTime string `yaml:"idleTime,omitempty"`
+	Interval string `yaml:"interval,omitempty"`
+}
+
+type ClientIPDetection struct {
+	XForwardedFor *XForwardedForSettings `yaml:"xForwardedFor,omitempty"`
+}
+
+type XForwardedForSettings struct {
+	NumTrustedHops int `yaml:"numTrustedHops"`
+}
+
+type ClientTLSSettings struct {
+	MinVersion    string   `yaml:"minVersion,omitempty"`
+	MaxVersion    string   `yaml:"maxVersion,omitempty"`
+	Ciphers       []string `yaml:"ciphers,omitempty"`
+	ALPNProtocols []string `yaml:"alpnProtocols,omitempty"`
+}
+
+type PathSettings struct {
+	EscapedSlashesAction string `yaml:"escapedSlashesAction,omitempty"`
+	DisableMergeSlashes  bool   `yaml:"disableMergeSlashes,omitempty"`
+}
+
+type HTTP2Settings struct {
+	MaxConcurrentStreams int `yaml:"maxConcurrentStreams,omitempty"`
+}
+
+type ClientConnection struct {
+	ConnectionLimit *ConnectionLimit `yaml:"connectionLimit,omitempty"`
+	BufferLimit     string           `yaml:"bufferLimit,omitempty"`
+}
+
+type ConnectionLimit struct {
+	Value      int    `yaml:"value"`
+	CloseDelay string `yaml:"closeDelay,omitempty"`
+}
+
+type EnvoyExtensionPolicyResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta               `yaml:"metadata"`
+	Spec     EnvoyExtensionPolicySpec `yaml:"spec"`
+}
+
+type EnvoyExtensionPolicySpec struct {
+	TargetRefs []LocalPolicyTargetReference `yaml:"targetRefs"`
+	Wasm       []Wasm                       `yaml:"wasm,omitempty"`
+	ExtProc    []ExtProc                    `yaml:"extProc,omitempty"`
+	Lua        []Lua                        `yaml:"lua,omitempty"`
+}
+
+// Wasm carries its config as the decoded JSON value, since its schema is up to the module
+type Wasm struct {
+	Name     string         `yaml:"name"`
+	RootID   string         `yaml:"rootID,omitempty"`
+	Code     WasmCodeSource `yaml:"code"`
+	Config   interface{}    `yaml:"config,omitempty"`
+	FailOpen bool           `yaml:"failOpen,omitempty"`
+}
+
+type WasmCodeSource struct {
+	Type  string      `yaml:"type"`
+	HTTP  *WasmSource `yaml:"http,omitempty"`
+	Image *WasmSource `yaml:"image,omitempty"`
+}
+
+type WasmSource struct {
+	URL    string `yaml:"url"`
+	SHA256 string `yaml:"sha256,omitempty"`
+}
+
+type ExtProc struct {
+	BackendRefs    []BackendObjectReference `yaml:"backendRefs"`
+	ProcessingMode *ExtProcProcessingMode   `yaml:"processingMode,omitempty"`
+	MessageTimeout string                   `yaml:"messageTimeout,omitempty"`
+	FailOpen       bool                     `yaml:"failOpen,omitempty"`
+}
+
+type ExtProcProcessingMode struct {
+	Request  *ProcessingModeOptions `yaml:"request,omitempty"`
+	Response *ProcessingModeOptions `yaml:"response,omitempty"`
+}
+
+type ProcessingModeOptions struct {
+	Body string `yaml:"body,omitempty"`
+}
+
+type Lua struct {
+	Type   string `yaml:"type"`
+	Inline string `yaml:"inline"`
+}
+
+type EnvoyPatchPolicyResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta           `yaml:"metadata"`
+	Spec     EnvoyPatchPolicySpec `yaml:"spec"`
+}
+
+type EnvoyPatchPolicySpec struct {
+	Type        string                     `yaml:"type"`
+	JSONPatches []EnvoyJSONPatchConfig     `yaml:"jsonPatches"`
+	TargetRef   LocalPolicyTargetReference `yaml:"targetRef"`
+	Priority    int                        `yaml:"priority,omitempty"`
+}
+
+type EnvoyJSONPatchConfig struct {
+	Type      string             `yaml:"type"`
+	Name      string             `yaml:"name"`
+	Operation JSONPatchOperation `yaml:"operation"`
+}
+
+type JSONPatchOperation struct {
+	Op    string      `yaml:"op"`
+	Path  string      `yaml:"path"`
+	From  string      `yaml:"from,omitempty"`
+	Value interface{} `yaml:"value,omitempty"`
+}
+
+type EnvoyProxyResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta     `yaml:"metadata"`
+	Spec     EnvoyProxySpec `yaml:"spec"`
+}
+
+type EnvoyProxySpec struct {
+	Provider EnvoyProxyProvider `yaml:"provider"`
+	Logging  *ProxyLogging      `yaml:"logging,omitempty"`
+}
+
+type EnvoyProxyProvider struct {
+	Type       string                       `yaml:"type"`
+	Kubernetes EnvoyProxyKubernetesProvider `yaml:"kubernetes"`
+}
+
+type EnvoyProxyKubernetesProvider struct {
+	EnvoyDeployment *KubernetesDeploymentSpec `yaml:"envoyDeployment,omitempty"`
+	EnvoyService    *KubernetesServiceSpec    `yaml:"envoyService,omitempty"`
+}
+
+type KubernetesDeploymentSpec struct {
+	Replicas  int                      `yaml:"replicas,omitempty"`
+	Container *KubernetesContainerSpec `yaml:"container,omitempty"`
+}
+
+type KubernetesContainerSpec struct {
+	Resources ContainerResources `yaml:"resources"`
+}
+
+// ContainerResources mirrors the core ResourceRequirements, whose lists map a resource
+// name such as cpu or memory to a quantity
+type ContainerResources struct {
+	Requests map[string]string `yaml:"requests,omitempty"`
+	Limits   map[string]string `yaml:"limits,omitempty"`
+}
+
+type KubernetesServiceSpec struct {
+	Type        string            `yaml:"type,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// ProxyLogging maps a log component, or "default" for all of them, to its level
+type ProxyLogging struct {
+	Level map[string]string `yaml:"level"`
+}
+
+// Core: v1
+
+type SecretResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta        `yaml:"metadata"`
+	Type     string            `yaml:"type"`
+	Data     map[string]string `yaml:"data"`
+}
+
+type ConfigMapResource struct {
+	TypeMeta `yaml:",inline"`
+	Metadata ObjectMeta        `yaml:"metadata"`
+	Data     map[string]string `yaml:"data"`
+}
+
+// marshalResource renders any of the typed resources above as YAML
+func marshalResource(resource interface{}) (string, error) {
+	yamlBytes, err := yaml.Marshal(resource)
+	if err != nil {
+		return "", err
+	}
+	return string(yamlBytes), nil
+}
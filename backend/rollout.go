@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// rolloutPreviousSpecAnnotation holds the HTTPRoute spec from before the last rollout
+// change, so a revert is a single patch and survives backend restarts
+const rolloutPreviousSpecAnnotation = "envoy-gateway-extension/previous-spec"
+
+type RouteRolloutFormData struct {
+	RouteName string                         `json:"routeName"`
+	Namespace string                         `json:"namespace"`
+	RuleIndex int                            `json:"ruleIndex"`
+	Strategy  string                         `json:"strategy"` // "BlueGreen" or "HeaderCanary"
+	Target    HTTPBackendRefFormData         `json:"target"`   // the backend that receives all traffic, or the canary backend
+	Headers   []HTTPRouteHeaderMatchFormData `json:"headers,omitempty"`
+	Cookie    *HTTPHeaderFormData            `json:"cookie,omitempty"` // routes requests carrying this cookie name and value
+	Remove    bool                           `json:"remove,omitempty"` // HeaderCanary only: delete the canary rule again
+}
+
+type RouteRevertFormData struct {
+	RouteName string `json:"routeName"`
+	Namespace string `json:"namespace"`
+}
+
+type liveHTTPRoute struct {
+	Metadata struct {
+		ResourceVersion string            `json:"resourceVersion"`
+		Annotations     map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec map[string]interface{} `json:"spec"`
+}
+
+func (s *Server) handleRouteRollout(w http.ResponseWriter, r *http.Request) {
+	var rolloutData RouteRolloutFormData
+	if err := json.NewDecoder(r.Body).Decode(&rolloutData); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if errs := validateRouteRolloutFormData(rolloutData); len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	route, err := getLiveHTTPRoute(r.Context(), kube, rolloutData.Namespace, rolloutData.RouteName)
+	if err != nil {
+		s.sendError(w, err.Error(), kubeErrorStatus(err, http.StatusBadRequest))
+		return
+	}
+	rules, _ := route.Spec["rules"].([]interface{})
+	if rolloutData.RuleIndex >= len(rules) {
+		s.sendError(w, fmt.Sprintf("HTTPRoute %s has no rule %d", rolloutData.RouteName, rolloutData.RuleIndex), http.StatusBadRequest)
+		return
+	}
+
+	var newRules []interface{}
+	var message string
+	switch rolloutData.Strategy {
+	case "BlueGreen":
+		newRules = blueGreenRules(rules, rolloutData)
+		message = fmt.Sprintf("All traffic of rule %d now goes to %s", rolloutData.RuleIndex, rolloutData.Target.Name)
+	case "HeaderCanary":
+		newRules, err = headerCanaryRules(rules, rolloutData)
+		if err != nil {
+			s.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		message = fmt.Sprintf("Requests matching the canary headers now go to %s", rolloutData.Target.Name)
+		if rolloutData.Remove {
+			message = fmt.Sprintf("Header canary rule for %s removed", rolloutData.Target.Name)
+		}
+	}
+
+	if err := patchRouteSpec(r.Context(), kube, rolloutData.Namespace, rolloutData.RouteName, route, "/spec/rules", newRules); err != nil {
+		s.sendError(w, err.Error(), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Data:    fmt.Sprintf("HTTPRoute %s updated: %s. POST /revert-route-rollout to undo.", rolloutData.RouteName, message),
+	}
+	s.sendResponse(w, response)
+}
+
+// handleRevertRouteRollout swaps the route's spec with the one saved by the last rollout
+// change. Reverting twice therefore returns to the rolled-out state.
+func (s *Server) handleRevertRouteRollout(w http.ResponseWriter, r *http.Request) {
+	var revertData RouteRevertFormData
+	if err := json.NewDecoder(r.Body).Decode(&revertData); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	if revertData.RouteName == "" || revertData.Namespace == "" {
+		s.sendError(w, "routeName and namespace are required", http.StatusBadRequest)
+		return
+	}
+
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	route, err := getLiveHTTPRoute(r.Context(), kube, revertData.Namespace, revertData.RouteName)
+	if err != nil {
+		s.sendError(w, err.Error(), kubeErrorStatus(err, http.StatusBadRequest))
+		return
+	}
+	saved, ok := route.Metadata.Annotations[rolloutPreviousSpecAnnotation]
+	if !ok {
+		s.sendError(w, fmt.Sprintf("HTTPRoute %s has no saved spec to revert to", revertData.RouteName), http.StatusBadRequest)
+		return
+	}
+	var previousSpec map[string]interface{}
+	if err := json.Unmarshal([]byte(saved), &previousSpec); err != nil {
+		s.sendError(w, fmt.Sprintf("Saved spec on HTTPRoute %s is not valid JSON: %v", revertData.RouteName, err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := patchRouteSpec(r.Context(), kube, revertData.Namespace, revertData.RouteName, route, "/spec", previousSpec); err != nil {
+		s.sendError(w, err.Error(), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Data:    fmt.Sprintf("HTTPRoute %s reverted to its previous spec", revertData.RouteName),
+	}
+	s.sendResponse(w, response)
+}
+
+func validateRouteRolloutFormData(data RouteRolloutFormData) FieldErrors {
+	var errs FieldErrors
+	validateObjectName(&errs, "routeName", data.RouteName)
+	validateDNSLabel(&errs, "namespace", data.Namespace)
+	if data.RuleIndex < 0 {
+		errs.add("ruleIndex", "must not be negative")
+	}
+	validateBackendRef(&errs, "target", data.Target)
+
+	switch data.Strategy {
+	case "BlueGreen":
+		if len(data.Headers) > 0 || data.Cookie != nil {
+			errs.add("strategy", "BlueGreen does not take headers or a cookie")
+		}
+	case "HeaderCanary":
+		if !data.Remove && len(data.Headers) == 0 && data.Cookie == nil {
+			errs.add("headers", "at least one header or a cookie is required for a HeaderCanary")
+		}
+		for i, header := range data.Headers {
+			field := fmt.Sprintf("headers[%d]", i)
+			validateValueMatch(&errs, field, header.Type, header.Value)
+			if !headerNamePattern.MatchString(header.Name) {
+				errs.add(field+".name", "%q is not a valid header name", header.Name)
+			}
+		}
+		if data.Cookie != nil && !headerNamePattern.MatchString(data.Cookie.Name) {
+			errs.add("cookie.name", "%q is not a valid cookie name", data.Cookie.Name)
+		}
+	default:
+		errs.add("strategy", "must be BlueGreen or HeaderCanary")
+	}
+	return errs
+}
+
+// blueGreenRules flips every backendRef of the rule to weight 0 except the target, which
+// gets all the traffic. The other rules are passed through untouched.
+func blueGreenRules(rules []interface{}, data RouteRolloutFormData) []interface{} {
+	rule := copyJSONObject(rules[data.RuleIndex])
+	backendRefs, _ := rule["backendRefs"].([]interface{})
+
+	var updated []interface{}
+	hasTarget := false
+	for _, ref := range backendRefs {
+		refMap := copyJSONObject(ref)
+		if refMap["name"] == data.Target.Name && namespaceMatches(refMap, data.Target.Namespace) {
+			refMap["weight"] = 100
+			hasTarget = true
+		} else {
+			refMap["weight"] = 0
+		}
+		updated = append(updated, refMap)
+	}
+	if !hasTarget {
+		updated = append(updated, backendRefObject(data.Target, 100))
+	}
+	rule["backendRefs"] = updated
+
+	result := append([]interface{}{}, rules...)
+	result[data.RuleIndex] = rule
+	return result
+}
+
+// headerCanaryRules places a copy of the base rule, narrowed by the canary headers and
+// sent only to the canary backend, right before the base rule. A previous canary rule for
+// the same backend, recognised by its name, is replaced. Gateway API precedence prefers
+// the match with more header conditions, so the canary rule wins regardless of order.
+func headerCanaryRules(rules []interface{}, data RouteRolloutFormData) ([]interface{}, error) {
+	if isHeaderCanaryRule(rules[data.RuleIndex], data.Target.Name) {
+		return nil, fmt.Errorf("rule %d is itself a header canary rule; pass the index of the rule it was copied from", data.RuleIndex)
+	}
+
+	var result []interface{}
+	for i, rule := range rules {
+		if isHeaderCanaryRule(rule, data.Target.Name) {
+			continue
+		}
+		if i == data.RuleIndex && !data.Remove {
+			result = append(result, buildHeaderCanaryRule(rule, data))
+		}
+		result = append(result, rule)
+	}
+	return result, nil
+}
+
+func buildHeaderCanaryRule(baseRule interface{}, data RouteRolloutFormData) map[string]interface{} {
+	var headers []interface{}
+	for _, header := range data.Headers {
+		match := map[string]interface{}{"name": header.Name, "value": header.Value}
+		if header.Type != "" {
+			match["type"] = header.Type
+		}
+		headers = append(headers, match)
+	}
+	if data.Cookie != nil {
+		// Cookies share one header, so match the pair anywhere in the list
+		headers = append(headers, map[string]interface{}{
+			"type":  "RegularExpression",
+			"name":  "cookie",
+			"value": fmt.Sprintf(`(^|.*;\s*)%s=%s(;.*|$)`, regexp.QuoteMeta(data.Cookie.Name), regexp.QuoteMeta(data.Cookie.Value)),
+		})
+	}
+
+	rule := copyJSONObject(baseRule)
+	rule["name"] = headerCanaryRuleName(data.Target.Name)
+	matches, _ := rule["matches"].([]interface{})
+	if len(matches) == 0 {
+		// A rule without matches matches everything under PathPrefix "/"
+		matches = []interface{}{map[string]interface{}{
+			"path": map[string]interface{}{"type": "PathPrefix", "value": "/"},
+		}}
+	}
+
+	var canaryMatches []interface{}
+	for _, match := range matches {
+		canaryMatch := copyJSONObject(match)
+		existing, _ := canaryMatch["headers"].([]interface{})
+		canaryMatch["headers"] = append(append([]interface{}{}, existing...), headers...)
+		canaryMatches = append(canaryMatches, canaryMatch)
+	}
+	rule["matches"] = canaryMatches
+	rule["backendRefs"] = []interface{}{backendRefObject(data.Target, 0)}
+	return rule
+}
+
+// headerCanaryRuleName is the name given to the canary rule of a backend. Rule names are
+// unique within a route, and the name is what marks a rule as generated, so user rules of
+// the same shape are never replaced or removed.
+func headerCanaryRuleName(canaryName string) string {
+	return "canary-" + canaryName
+}
+
+func isHeaderCanaryRule(rule interface{}, canaryName string) bool {
+	name, _ := copyJSONObject(rule)["name"].(string)
+	return name == headerCanaryRuleName(canaryName)
+}
+
+func backendRefObject(ref HTTPBackendRefFormData, weight int) map[string]interface{} {
+	result := map[string]interface{}{
+		"name": ref.Name,
+		"port": ref.Port,
+	}
+	if ref.Namespace != "" {
+		result["namespace"] = ref.Namespace
+	}
+	if weight > 0 {
+		result["weight"] = weight
+	}
+	return result
+}
+
+func namespaceMatches(ref map[string]interface{}, namespace string) bool {
+	refNamespace, _ := ref["namespace"].(string)
+	return refNamespace == namespace
+}
+
+// copyJSONObject returns a shallow copy of a decoded JSON object, or an empty map
+func copyJSONObject(value interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	if object, ok := value.(map[string]interface{}); ok {
+		for key, field := range object {
+			result[key] = field
+		}
+	}
+	return result
+}
+
+func getLiveHTTPRoute(ctx context.Context, kube KubeClient, namespace, name string) (*liveHTTPRoute, error) {
+	object, err := kube.Get(ctx, "httproutes.gateway.networking.k8s.io", namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	var route liveHTTPRoute
+	if err := decodeInto(object, &route); err != nil {
+		return nil, fmt.Errorf("failed to parse HTTPRoute %s/%s: %v", namespace, name, err)
+	}
+	return &route, nil
+}
+
+// patchRouteSpec replaces path in the route and records the current spec in the
+// previous-spec annotation, all in one JSON patch. The resourceVersion test makes the
+// patch fail rather than overwrite a concurrent change.
+func patchRouteSpec(ctx context.Context, kube KubeClient, namespace, name string, route *liveHTTPRoute, path string, value interface{}) error {
+	currentSpec, err := json.Marshal(route.Spec)
+	if err != nil {
+		return err
+	}
+
+	operations := []map[string]interface{}{
+		{"op": "test", "path": "/metadata/resourceVersion", "value": route.Metadata.ResourceVersion},
+		{"op": "replace", "path": path, "value": value},
+	}
+	if route.Metadata.Annotations == nil {
+		operations = append(operations, map[string]interface{}{
+			"op": "add", "path": "/metadata/annotations", "value": map[string]string{rolloutPreviousSpecAnnotation: string(currentSpec)},
+		})
+	} else {
+		// "add" also replaces an existing member; "/" in the key is escaped as "~1"
+		key := strings.ReplaceAll(rolloutPreviousSpecAnnotation, "/", "~1")
+		operations = append(operations, map[string]interface{}{
+			"op": "add", "path": "/metadata/annotations/" + key, "value": string(currentSpec),
+		})
+	}
+
+	patch, err := json.Marshal(operations)
+	if err != nil {
+		return err
+	}
+	_, err = kube.Patch(ctx, "httproutes.gateway.networking.k8s.io", namespace, name, types.JSONPatchType, patch)
+	return err
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBlueGreenRules(t *testing.T) {
+	rules := []interface{}{
+		map[string]interface{}{
+			"backendRefs": []interface{}{
+				map[string]interface{}{"name": "web-blue", "port": 8080.0, "weight": 100.0},
+				map[string]interface{}{"name": "web-green", "port": 8080.0, "namespace": "staging"},
+				map[string]interface{}{"name": "web-green", "port": 8080.0},
+			},
+		},
+		map[string]interface{}{"backendRefs": []interface{}{map[string]interface{}{"name": "admin", "port": 9000.0}}},
+	}
+	data := RouteRolloutFormData{Strategy: "BlueGreen", Target: HTTPBackendRefFormData{Name: "web-green", Port: 8080}}
+
+	result := blueGreenRules(rules, data)
+	want := []interface{}{
+		map[string]interface{}{"name": "web-blue", "port": 8080.0, "weight": 0},
+		map[string]interface{}{"name": "web-green", "port": 8080.0, "namespace": "staging", "weight": 0},
+		map[string]interface{}{"name": "web-green", "port": 8080.0, "weight": 100},
+	}
+	if got := result[0].(map[string]interface{})["backendRefs"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("backendRefs = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(result[1], rules[1]) {
+		t.Errorf("other rule changed: %v", result[1])
+	}
+	if weight := rules[0].(map[string]interface{})["backendRefs"].([]interface{})[0].(map[string]interface{})["weight"]; weight != 100.0 {
+		t.Errorf("input rules were modified: weight = %v", weight)
+	}
+
+	// A target that is not in the rule yet is added with all the traffic
+	data.Target = HTTPBackendRefFormData{Name: "web-red", Port: 8081}
+	backendRefs := blueGreenRules(rules, data)[0].(map[string]interface{})["backendRefs"].([]interface{})
+	if last := backendRefs[len(backendRefs)-1]; !reflect.DeepEqual(last, map[string]interface{}{"name": "web-red", "port": 8081, "weight": 100}) {
+		t.Errorf("added target = %v", last)
+	}
+}
+
+func TestHeaderCanaryRules(t *testing.T) {
+	baseRule := map[string]interface{}{
+		"name": "api",
+		"matches": []interface{}{
+			map[string]interface{}{"path": map[string]interface{}{"type": "PathPrefix", "value": "/api"}},
+		},
+		"backendRefs": []interface{}{map[string]interface{}{"name": "web", "port": 8080.0}},
+	}
+	// A user rule of the same shape as a canary rule, which must be left alone
+	userRule := map[string]interface{}{
+		"name": "beta-testers",
+		"matches": []interface{}{
+			map[string]interface{}{"headers": []interface{}{map[string]interface{}{"name": "x-beta", "value": "1"}}},
+		},
+		"backendRefs": []interface{}{map[string]interface{}{"name": "web-v2", "port": 8080.0}},
+	}
+	rules := []interface{}{userRule, baseRule}
+	data := RouteRolloutFormData{
+		Strategy:  "HeaderCanary",
+		RuleIndex: 1,
+		Target:    HTTPBackendRefFormData{Name: "web-v2", Port: 8080},
+		Headers:   []HTTPRouteHeaderMatchFormData{{Name: "x-canary", Value: "true"}},
+	}
+
+	result, err := headerCanaryRules(rules, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canaryRule := map[string]interface{}{
+		"name": "canary-web-v2",
+		"matches": []interface{}{
+			map[string]interface{}{
+				"path":    map[string]interface{}{"type": "PathPrefix", "value": "/api"},
+				"headers": []interface{}{map[string]interface{}{"name": "x-canary", "value": "true"}},
+			},
+		},
+		"backendRefs": []interface{}{map[string]interface{}{"name": "web-v2", "port": 8080}},
+	}
+	if want := []interface{}{userRule, canaryRule, baseRule}; !reflect.DeepEqual(result, want) {
+		t.Fatalf("got %v\nwant %v", result, want)
+	}
+
+	// Rolling out again replaces the generated rule instead of adding a second one
+	data.RuleIndex = 2
+	data.Headers[0].Value = "yes"
+	again, err := headerCanaryRules(result, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 3 || !reflect.DeepEqual(again[0], userRule) || !reflect.DeepEqual(again[2], baseRule) {
+		t.Errorf("second rollout = %v", again)
+	}
+
+	// The generated rule cannot serve as the base of another canary
+	data.RuleIndex = 1
+	if _, err := headerCanaryRules(result, data); err == nil {
+		t.Error("expected an error for a canary rule as the base")
+	}
+
+	// Removing deletes only the generated rule
+	data.RuleIndex = 2
+	data.Remove = true
+	removed, err := headerCanaryRules(result, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{userRule, baseRule}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("after removal = %v, want %v", removed, want)
+	}
+}
+
+func TestBuildHeaderCanaryRuleWithoutMatches(t *testing.T) {
+	data := RouteRolloutFormData{
+		Target: HTTPBackendRefFormData{Name: "web-v2", Port: 8080},
+		Cookie: &HTTPHeaderFormData{Name: "canary", Value: "a.b"},
+	}
+	rule := buildHeaderCanaryRule(map[string]interface{}{"backendRefs": []interface{}{}}, data)
+	match := rule["matches"].([]interface{})[0].(map[string]interface{})
+	if path := match["path"]; !reflect.DeepEqual(path, map[string]interface{}{"type": "PathPrefix", "value": "/"}) {
+		t.Errorf("path = %v, want the default PathPrefix /", path)
+	}
+	header := match["headers"].([]interface{})[0].(map[string]interface{})
+	if header["name"] != "cookie" || header["value"] != `(^|.*;\s*)canary=a\.b(;.*|$)` {
+		t.Errorf("cookie match = %v", header)
+	}
+}
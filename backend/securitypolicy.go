@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type SecurityPolicyFormData struct {
+	Name          string                 `json:"name"`
+	Namespace     string                 `json:"namespace"`
+	TargetRefs    []PolicyTargetRef      `json:"targetRefs"`
+	JWT           *JWTFormData           `json:"jwt,omitempty"`
+	BasicAuth     *BasicAuthFormData     `json:"basicAuth,omitempty"`
+	CORS          *CORSFormData          `json:"cors,omitempty"`
+	Authorization *AuthorizationFormData `json:"authorization,omitempty"`
+	OIDC          *OIDCFormData          `json:"oidc,omitempty"`
+}
+
+// PolicyTargetRef points an Envoy Gateway policy at a Gateway or route in the policy's namespace
+type PolicyTargetRef struct {
+	Group       string `json:"group,omitempty"`
+	Kind        string `json:"kind"` // "Gateway", "HTTPRoute" or "GRPCRoute"
+	Name        string `json:"name"`
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+type JWTFormData struct {
+	Providers []JWTProviderFormData `json:"providers"`
+}
+
+type JWTProviderFormData struct {
+	Name           string                  `json:"name"`
+	Issuer         string                  `json:"issuer,omitempty"`
+	Audiences      []string                `json:"audiences,omitempty"`
+	RemoteJWKSURI  string                  `json:"remoteJwksUri,omitempty"`
+	LocalJWKS      string                  `json:"localJwks,omitempty"` // inline JWKS document
+	ClaimToHeaders []ClaimToHeaderFormData `json:"claimToHeaders,omitempty"`
+}
+
+type ClaimToHeaderFormData struct {
+	Claim  string `json:"claim"`
+	Header string `json:"header"`
+}
+
+type BasicAuthFormData struct {
+	SecretName string              `json:"secretName"`
+	Users      []BasicAuthUserData `json:"users,omitempty"` // when set, the htpasswd Secret is created from them
+}
+
+type BasicAuthUserData struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type CORSFormData struct {
+	AllowOrigins     []string `json:"allowOrigins"`
+	AllowMethods     []string `json:"allowMethods,omitempty"`
+	AllowHeaders     []string `json:"allowHeaders,omitempty"`
+	ExposeHeaders    []string `json:"exposeHeaders,omitempty"`
+	MaxAge           string   `json:"maxAge,omitempty"`
+	AllowCredentials bool     `json:"allowCredentials,omitempty"`
+}
+
+type AuthorizationFormData struct {
+	DefaultAction string                      `json:"defaultAction,omitempty"` // "Allow" or "Deny"
+	Rules         []AuthorizationRuleFormData `json:"rules"`
+}
+
+type AuthorizationRuleFormData struct {
+	Name        string   `json:"name,omitempty"`
+	Action      string   `json:"action"` // "Allow" or "Deny"
+	ClientCIDRs []string `json:"clientCIDRs"`
+}
+
+type OIDCFormData struct {
+	Issuer           string   `json:"issuer"`
+	ClientID         string   `json:"clientId"`
+	ClientSecretName string   `json:"clientSecretName,omitempty"` // defaults to <name>-oidc-client-secret when clientSecret is set
+	ClientSecret     string   `json:"clientSecret,omitempty"`     // when set, the client secret Secret is created
+	RedirectURL      string   `json:"redirectUrl,omitempty"`
+	LogoutPath       string   `json:"logoutPath,omitempty"`
+	Scopes           []string `json:"scopes,omitempty"`
+}
+
+func (s *Server) handleCreateSecurityPolicy(w http.ResponseWriter, r *http.Request) {
+	var policyData SecurityPolicyFormData
+	if err := json.NewDecoder(r.Body).Decode(&policyData); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if errs := validateSecurityPolicyFormData(policyData); len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+
+	if err := s.validatePolicyTargets(r.Context(), policyData.Namespace, policyData.TargetRefs); err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if policyData.OIDC != nil && policyData.OIDC.ClientSecretName == "" {
+		policyData.OIDC.ClientSecretName = policyData.Name + "-oidc-client-secret"
+	}
+
+	// Create the Secrets the policy refers to before the policy itself
+	if policyData.BasicAuth != nil && len(policyData.BasicAuth.Users) > 0 {
+		secretYAML, err := s.generateSecretYAML(policyData.BasicAuth.SecretName, policyData.Namespace,
+			map[string]string{".htpasswd": generateHtpasswd(policyData.BasicAuth.Users)})
+		if err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to generate htpasswd Secret YAML: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if err := s.applyYAML(r.Context(), secretYAML, "secret"); err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to apply htpasswd Secret: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+	}
+	if policyData.OIDC != nil && policyData.OIDC.ClientSecret != "" {
+		secretYAML, err := s.generateSecretYAML(policyData.OIDC.ClientSecretName, policyData.Namespace,
+			map[string]string{"client-secret": policyData.OIDC.ClientSecret})
+		if err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to generate OIDC client Secret YAML: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if err := s.applyYAML(r.Context(), secretYAML, "secret"); err != nil {
+			s.sendError(w, fmt.Sprintf("Failed to apply OIDC client Secret: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+	}
+
+	yamlContent, err := s.generateSecurityPolicyYAML(policyData)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to generate SecurityPolicy YAML: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, "securitypolicy"); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply SecurityPolicy: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Data:    fmt.Sprintf("SecurityPolicy %s created successfully in namespace %s", policyData.Name, policyData.Namespace),
+	}
+	s.sendResponse(w, response)
+}
+
+func validateSecurityPolicyFormData(data SecurityPolicyFormData) FieldErrors {
+	var errs FieldErrors
+	validateObjectName(&errs, "name", data.Name)
+	validateDNSLabel(&errs, "namespace", data.Namespace)
+	validatePolicyTargetRefs(&errs, data.TargetRefs, policyTargetKinds)
+	if data.JWT == nil && data.BasicAuth == nil && data.CORS == nil && data.Authorization == nil && data.OIDC == nil {
+		errs.add("", "at least one of jwt, basicAuth, cors, authorization or oidc is required")
+	}
+
+	if data.JWT != nil {
+		if len(data.JWT.Providers) == 0 {
+			errs.add("jwt.providers", "at least one provider is required")
+		}
+		for i, provider := range data.JWT.Providers {
+			field := fmt.Sprintf("jwt.providers[%d]", i)
+			if provider.Name == "" {
+				errs.add(field+".name", "is required")
+			}
+			if (provider.RemoteJWKSURI == "") == (provider.LocalJWKS == "") {
+				errs.add(field+".remoteJwksUri", "exactly one of remoteJwksUri or localJwks is required")
+			}
+			if provider.LocalJWKS != "" && !json.Valid([]byte(provider.LocalJWKS)) {
+				errs.add(field+".localJwks", "is not valid JSON")
+			}
+			for j, claim := range provider.ClaimToHeaders {
+				if claim.Claim == "" {
+					errs.add(fmt.Sprintf("%s.claimToHeaders[%d].claim", field, j), "is required")
+				}
+				if !headerNamePattern.MatchString(claim.Header) {
+					errs.add(fmt.Sprintf("%s.claimToHeaders[%d].header", field, j), "%q is not a valid header name", claim.Header)
+				}
+			}
+		}
+	}
+
+	if data.BasicAuth != nil {
+		validateObjectName(&errs, "basicAuth.secretName", data.BasicAuth.SecretName)
+		for i, user := range data.BasicAuth.Users {
+			field := fmt.Sprintf("basicAuth.users[%d]", i)
+			if user.Username == "" || strings.Contains(user.Username, ":") {
+				errs.add(field+".username", "is required and must not contain ':'")
+			}
+			if user.Password == "" {
+				errs.add(field+".password", "is required")
+			}
+		}
+	}
+
+	if data.CORS != nil {
+		if len(data.CORS.AllowOrigins) == 0 {
+			errs.add("cors.allowOrigins", "at least one origin is required")
+		}
+		validateGatewayDuration(&errs, "cors.maxAge", data.CORS.MaxAge)
+	}
+
+	if data.Authorization != nil {
+		if !isPolicyAction(data.Authorization.DefaultAction, true) {
+			errs.add("authorization.defaultAction", "must be Allow or Deny")
+		}
+		for i, rule := range data.Authorization.Rules {
+			field := fmt.Sprintf("authorization.rules[%d]", i)
+			if !isPolicyAction(rule.Action, false) {
+				errs.add(field+".action", "must be Allow or Deny")
+			}
+			if len(rule.ClientCIDRs) == 0 {
+				errs.add(field+".clientCIDRs", "at least one clientCIDR is required")
+			}
+			for j, cidr := range rule.ClientCIDRs {
+				if _, _, err := net.ParseCIDR(cidr); err != nil {
+					errs.add(fmt.Sprintf("%s.clientCIDRs[%d]", field, j), "%q is not a valid CIDR", cidr)
+				}
+			}
+		}
+	}
+
+	if data.OIDC != nil {
+		if data.OIDC.Issuer == "" {
+			errs.add("oidc.issuer", "is required")
+		}
+		if data.OIDC.ClientID == "" {
+			errs.add("oidc.clientId", "is required")
+		}
+		// Without a secret to create, the policy must name one that already exists
+		if data.OIDC.ClientSecret == "" && data.OIDC.ClientSecretName == "" {
+			errs.add("oidc.clientSecret", "clientSecret or clientSecretName is required")
+		}
+		if data.OIDC.ClientSecretName != "" {
+			validateObjectName(&errs, "oidc.clientSecretName", data.OIDC.ClientSecretName)
+		}
+	}
+
+	return errs
+}
+
+func isPolicyAction(action string, allowEmpty bool) bool {
+	return action == "Allow" || action == "Deny" || (allowEmpty && action == "")
+}
+
+// policyTargetKinds are the kinds an Envoy Gateway policy can attach to
+var policyTargetKinds = []string{"Gateway", "HTTPRoute", "GRPCRoute"}
+
+// validatePolicyTargetRefs checks the targetRefs of an Envoy Gateway policy, which must
+// name one of kinds in the policy's own namespace
+func validatePolicyTargetRefs(errs *FieldErrors, targetRefs []PolicyTargetRef, kinds []string) {
+	if len(targetRefs) == 0 {
+		errs.add("targetRefs", "at least one targetRef is required")
+	}
+	for i, ref := range targetRefs {
+		field := fmt.Sprintf("targetRefs[%d]", i)
+		if !containsString(kinds, ref.Kind) {
+			errs.add(field+".kind", "must be one of %s", strings.Join(kinds, ", "))
+		}
+		validateObjectName(errs, field+".name", ref.Name)
+		if ref.SectionName != "" {
+			validateObjectName(errs, field+".sectionName", ref.SectionName)
+		}
+	}
+}
+
+// validatePolicyTargets checks that every targetRef exists before a policy is applied,
+// since Envoy Gateway silently ignores policies whose target is missing
+func (s *Server) validatePolicyTargets(ctx context.Context, namespace string, targetRefs []PolicyTargetRef) error {
+	kube, err := s.kubeClient(ctx)
+	if err != nil {
+		return fmt.Errorf("kubeconfig setup failed: %v", err)
+	}
+
+	for i, ref := range targetRefs {
+		var resource string
+		switch ref.Kind {
+		case "Gateway":
+			resource = "gateways.gateway.networking.k8s.io"
+		case "HTTPRoute":
+			resource = "httproutes.gateway.networking.k8s.io"
+		case "GRPCRoute":
+			resource = "grpcroutes.gateway.networking.k8s.io"
+		default:
+			return fmt.Errorf("targetRefs[%d]: unsupported kind %q (expected Gateway, HTTPRoute or GRPCRoute)", i, ref.Kind)
+		}
+		if ref.Name == "" {
+			return fmt.Errorf("targetRefs[%d]: name is required", i)
+		}
+
+		if _, err := kube.Get(ctx, resource, namespace, ref.Name); err != nil {
+			log.Printf("Policy target %s %s/%s not found: %v", ref.Kind, namespace, ref.Name, err)
+			if !isKubeNotFound(err) {
+				return err
+			}
+			return fmt.Errorf("targetRefs[%d]: %s %s not found in namespace %s", i, ref.Kind, ref.Name, namespace)
+		}
+	}
+	return nil
+}
+
+func convertPolicyTargetRefs(targetRefs []PolicyTargetRef) []LocalPolicyTargetReference {
+	result := make([]LocalPolicyTargetReference, len(targetRefs))
+	for i, ref := range targetRefs {
+		group := ref.Group
+		if group == "" {
+			group = "gateway.networking.k8s.io"
+		}
+		result[i] = LocalPolicyTargetReference{
+			Group:       group,
+			Kind:        ref.Kind,
+			Name:        ref.Name,
+			SectionName: ref.SectionName,
+		}
+	}
+	return result
+}
+
+func (s *Server) generateSecurityPolicyYAML(data SecurityPolicyFormData) (string, error) {
+	policy := SecurityPolicyResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.envoyproxy.io/v1alpha1", Kind: "SecurityPolicy"},
+		Metadata: ObjectMeta{Name: data.Name, Namespace: data.Namespace},
+		Spec: SecurityPolicySpec{
+			TargetRefs: convertPolicyTargetRefs(data.TargetRefs),
+		},
+	}
+
+	if data.JWT != nil {
+		jwt := &JWT{Providers: make([]JWTProvider, len(data.JWT.Providers))}
+		for i, provider := range data.JWT.Providers {
+			jwtProvider := JWTProvider{
+				Name:      provider.Name,
+				Issuer:    provider.Issuer,
+				Audiences: provider.Audiences,
+			}
+			if provider.RemoteJWKSURI != "" {
+				jwtProvider.RemoteJWKS = &RemoteJWKS{URI: provider.RemoteJWKSURI}
+			} else {
+				jwtProvider.LocalJWKS = &LocalJWKS{Type: "Inline", Inline: provider.LocalJWKS}
+			}
+			for _, claim := range provider.ClaimToHeaders {
+				jwtProvider.ClaimToHeaders = append(jwtProvider.ClaimToHeaders, ClaimToHeader{
+					Header: claim.Header,
+					Claim:  claim.Claim,
+				})
+			}
+			jwt.Providers[i] = jwtProvider
+		}
+		policy.Spec.JWT = jwt
+	}
+
+	if data.BasicAuth != nil {
+		policy.Spec.BasicAuth = &BasicAuth{
+			Users: SecretObjectReference{Name: data.BasicAuth.SecretName},
+		}
+	}
+
+	if data.CORS != nil {
+		policy.Spec.CORS = &CORS{
+			AllowOrigins:     data.CORS.AllowOrigins,
+			AllowMethods:     data.CORS.AllowMethods,
+			AllowHeaders:     data.CORS.AllowHeaders,
+			ExposeHeaders:    data.CORS.ExposeHeaders,
+			MaxAge:           data.CORS.MaxAge,
+			AllowCredentials: data.CORS.AllowCredentials,
+		}
+	}
+
+	if data.Authorization != nil {
+		authorization := &Authorization{
+			Rules:         make([]AuthorizationRule, len(data.Authorization.Rules)),
+			DefaultAction: data.Authorization.DefaultAction,
+		}
+		for i, rule := range data.Authorization.Rules {
+			authorization.Rules[i] = AuthorizationRule{
+				Name:      rule.Name,
+				Action:    rule.Action,
+				Principal: Principal{ClientCIDRs: rule.ClientCIDRs},
+			}
+		}
+		policy.Spec.Authorization = authorization
+	}
+
+	if data.OIDC != nil {
+		policy.Spec.OIDC = &OIDC{
+			Provider:     OIDCProvider{Issuer: data.OIDC.Issuer},
+			ClientID:     data.OIDC.ClientID,
+			ClientSecret: SecretObjectReference{Name: data.OIDC.ClientSecretName},
+			Scopes:       data.OIDC.Scopes,
+			RedirectURL:  data.OIDC.RedirectURL,
+			LogoutPath:   data.OIDC.LogoutPath,
+		}
+	}
+
+	return marshalResource(policy)
+}
+
+// generateHtpasswd renders users in the {SHA} htpasswd format, the only hash Envoy's
+// basic auth filter accepts
+func generateHtpasswd(users []BasicAuthUserData) string {
+	var builder strings.Builder
+	for _, user := range users {
+		sum := sha1.Sum([]byte(user.Password))
+		builder.WriteString(fmt.Sprintf("%s:{SHA}%s\n", user.Username, base64.StdEncoding.EncodeToString(sum[:])))
+	}
+	return builder.String()
+}
+
+func (s *Server) generateSecretYAML(name, namespace string, data map[string]string) (string, error) {
+	encoded := make(map[string]string, len(data))
+	for key, value := range data {
+		encoded[key] = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	secret := SecretResource{
+		TypeMeta: TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		Metadata: ObjectMeta{Name: name, Namespace: namespace},
+		Type:     "Opaque",
+		Data:     encoded,
+	}
+	return marshalResource(secret)
+}
@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestValidateSecurityPolicyWithoutFeatures(t *testing.T) {
+	data := SecurityPolicyFormData{
+		Name:       "auth",
+		Namespace:  "default",
+		TargetRefs: []PolicyTargetRef{{Kind: "HTTPRoute", Name: "web"}},
+	}
+	errs := validateSecurityPolicyFormData(data)
+	checkFieldErrors(t, "no features", errs, []string{""})
+	if got, want := errs.Error(), "at least one of jwt, basicAuth, cors, authorization or oidc is required"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+
+	data.CORS = &CORSFormData{AllowOrigins: []string{"https://example.com"}}
+	checkFieldErrors(t, "cors", validateSecurityPolicyFormData(data), nil)
+}
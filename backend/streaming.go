@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// sseHeartbeat is how often an idle stream sends a comment, so that it is not closed as
+// dead along the way
+const sseHeartbeat = 15 * time.Second
+
+// gatewayPodResync is how often /gateway-logs looks for Envoy pods started after it began
+const gatewayPodResync = 10 * time.Second
+
+// maxStreamLine bounds a single line of streamed output; longer lines end the stream
+const maxStreamLine = 1024 * 1024
+
+// StreamLine is the data of a "line" event
+type StreamLine struct {
+	Stream    string `json:"stream,omitempty"` // "stdout" or "stderr" for kubectl
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	Text      string `json:"text"`
+}
+
+// PodStreamStatus is the data of a "pod" event, sent when a pod's log starts or stops
+// being followed
+type PodStreamStatus struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container,omitempty"`
+	State     string `json:"state"` // "following" or "ended"
+	Error     string `json:"error,omitempty"`
+}
+
+// StreamEnd is the data of the "end" event, the last one on every stream
+type StreamEnd struct {
+	ExitCode *int   `json:"exitCode,omitempty"` // kubectl only
+	Error    string `json:"error,omitempty"`
+}
+
+// StreamError is the data of an "error" event, a problem that does not end the stream
+type StreamError struct {
+	Error string `json:"error"`
+}
+
+type sseEvent struct {
+	id   string // sent back by EventSource as Last-Event-ID when it reconnects
+	name string
+	data interface{}
+}
+
+// emit queues an event unless the stream has been cancelled
+func emit(ctx context.Context, events chan<- sseEvent, name string, data interface{}) bool {
+	select {
+	case events <- sseEvent{name: name, data: data}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// sseStream writes Server-Sent Events. Everything before it is opened is answered as a
+// normal JSON response, so errors in the request still get a status code.
+type sseStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newSSEStream(w http.ResponseWriter) (*sseStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming is not supported by this connection")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &sseStream{w: w, flusher: flusher}, nil
+}
+
+func (s *sseStream) send(name string, data interface{}) error {
+	return s.sendEvent(sseEvent{name: name, data: data})
+}
+
+func (s *sseStream) sendEvent(event sseEvent) error {
+	payload, err := json.Marshal(event.data)
+	if err != nil {
+		return err
+	}
+	if event.id != "" {
+		if _, err := fmt.Fprintf(s.w, "id: %s\n", event.id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event.name, payload); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// relay writes events until the channel is closed or ctx is done, with heartbeats in
+// between
+func (s *sseStream) relay(ctx context.Context, events <-chan sseEvent) error {
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := s.sendEvent(event); err != nil {
+				return err
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(s.w, ": heartbeat\n\n"); err != nil {
+				return err
+			}
+			s.flusher.Flush()
+		}
+	}
+}
+
+// scanLines emits a "line" event for every line read from reader
+func scanLines(ctx context.Context, reader io.Reader, template StreamLine, events chan<- sseEvent) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		line := template
+		line.Text = scanner.Text()
+		if !emit(ctx, events, "line", line) {
+			return ctx.Err()
+		}
+	}
+	return scanner.Err()
+}
+
+// handleKubectlStream runs a kubectl command and streams its output as "line" events,
+// ending with an "end" event that carries the exit code. It takes the same JSON body as
+// /kubectl on POST, or repeated "arg" parameters and "confirmToken" on GET for
+// EventSource. The command is killed when the client disconnects.
+func (s *Server) handleKubectlStream(w http.ResponseWriter, r *http.Request) {
+	var req KubectlRequest
+	if r.Method == http.MethodGet {
+		req.Args = r.URL.Query()["arg"]
+		req.ConfirmToken = r.URL.Query().Get("confirmToken")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	command, entry, ok := s.authorizeKubectl(w, r, kube, req)
+	if !ok {
+		return
+	}
+	stream, err := newSSEStream(w)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = streamKubectl(r.Context(), kube, req.Args, stream)
+	if command.mutating() {
+		entry.Result, entry.Error = auditResult(err)
+		s.audit.record(r.Context(), entry)
+	}
+}
+
+// streamKubectl runs kubectl until it exits or ctx is cancelled and reports how it ended
+func streamKubectl(ctx context.Context, kube KubeClient, args []string, stream *sseStream) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := kube.KubectlCommand(ctx, args...)
+	cmd.WaitDelay = time.Second
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		stream.send("end", StreamEnd{Error: err.Error()})
+		return err
+	}
+
+	events := make(chan sseEvent, 64)
+	var readers sync.WaitGroup
+	for name, pipe := range map[string]io.Reader{"stdout": stdout, "stderr": stderr} {
+		readers.Add(1)
+		go func(name string, pipe io.Reader) {
+			defer readers.Done()
+			scanLines(ctx, pipe, StreamLine{Stream: name}, events)
+		}(name, pipe)
+	}
+	go func() {
+		readers.Wait()
+		close(events)
+	}()
+
+	if err := stream.relay(ctx, events); err != nil {
+		// The client went away; stop kubectl and let the readers finish
+		cancel()
+		readers.Wait()
+		cmd.Wait()
+		return err
+	}
+
+	err = cmd.Wait()
+	end := StreamEnd{}
+	var exitErr *exec.ExitError
+	if err == nil || errors.As(err, &exitErr) {
+		code := cmd.ProcessState.ExitCode()
+		end.ExitCode = &code
+	}
+	if err != nil {
+		end.Error = err.Error()
+	}
+	stream.send("end", end)
+	return err
+}
+
+// podLogOptions reads the log options shared by /pod-logs and /gateway-logs. Logs are
+// followed unless follow=false.
+func podLogOptions(query url.Values) (*corev1.PodLogOptions, error) {
+	opts := &corev1.PodLogOptions{Follow: true, Container: query.Get("container")}
+	for _, flag := range []struct {
+		name  string
+		value *bool
+	}{{"follow", &opts.Follow}, {"timestamps", &opts.Timestamps}, {"previous", &opts.Previous}} {
+		if raw := query.Get(flag.name); raw != "" {
+			parsed, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be true or false", flag.name)
+			}
+			*flag.value = parsed
+		}
+	}
+	if raw := query.Get("tailLines"); raw != "" {
+		lines, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || lines < 0 {
+			return nil, fmt.Errorf("tailLines must be a non-negative number")
+		}
+		opts.TailLines = &lines
+	}
+	if raw := query.Get("sinceSeconds"); raw != "" {
+		seconds, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("sinceSeconds must be a positive number")
+		}
+		opts.SinceSeconds = &seconds
+	}
+	return opts, nil
+}
+
+// streamPodLogs emits the log of one pod's container, bracketed by "pod" events
+func streamPodLogs(ctx context.Context, kube KubeClient, namespace, pod string, opts *corev1.PodLogOptions, events chan<- sseEvent) {
+	status := PodStreamStatus{Pod: pod, Container: opts.Container, State: "following"}
+	if !emit(ctx, events, "pod", status) {
+		return
+	}
+
+	var err error
+	var logs io.ReadCloser
+	if logs, err = kube.PodLogs(ctx, namespace, pod, opts); err == nil {
+		err = scanLines(ctx, logs, StreamLine{Pod: pod, Container: opts.Container}, events)
+		logs.Close()
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	status.State = "ended"
+	if err != nil {
+		status.Error = err.Error()
+	}
+	emit(ctx, events, "pod", status)
+}
+
+// handleStreamPodLogs streams a pod's log. Query parameters: namespace, pod, container,
+// follow, tailLines, sinceSeconds, timestamps and previous.
+func (s *Server) handleStreamPodLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	namespace, pod := query.Get("namespace"), query.Get("pod")
+	if namespace == "" || pod == "" {
+		s.sendError(w, "namespace and pod are required", http.StatusBadRequest)
+		return
+	}
+	opts, err := podLogOptions(query)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	// Check the pod up front so that a typo is a 404 rather than a stream that ends at once
+	if _, err := kube.Get(r.Context(), "pods", namespace, pod); err != nil {
+		s.sendError(w, err.Error(), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	stream, err := newSSEStream(w)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	events := make(chan sseEvent, 64)
+	go func() {
+		defer close(events)
+		streamPodLogs(r.Context(), kube, namespace, pod, opts, events)
+	}()
+	if stream.relay(r.Context(), events) == nil {
+		stream.send("end", StreamEnd{})
+	}
+}
+
+// handleStreamGatewayLogs follows the logs of every Envoy pod running a Gateway, as one
+// stream of "line" events tagged with the pod. While following, pods started later (on
+// scale-up or a rollout) are picked up too. Query parameters: namespace, gateway and the
+// log options of /pod-logs; container defaults to "envoy".
+func (s *Server) handleStreamGatewayLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	namespace, gateway := query.Get("namespace"), query.Get("gateway")
+	if namespace == "" || gateway == "" {
+		s.sendError(w, "namespace and gateway are required", http.StatusBadRequest)
+		return
+	}
+	opts, err := podLogOptions(query)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Container == "" {
+		opts.Container = "envoy"
+	}
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if _, err := kube.Get(r.Context(), "gateways.gateway.networking.k8s.io", namespace, gateway); err != nil {
+		s.sendError(w, err.Error(), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	stream, err := newSSEStream(w)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	events := make(chan sseEvent, 64)
+	go followGatewayLogs(r.Context(), kube, namespace, gateway, opts, events)
+	if stream.relay(r.Context(), events) == nil {
+		stream.send("end", StreamEnd{})
+	}
+}
+
+// followGatewayLogs streams every Envoy pod of a Gateway and closes events when they have
+// all ended, or, when following, once ctx is done
+func followGatewayLogs(ctx context.Context, kube KubeClient, namespace, gateway string, opts *corev1.PodLogOptions, events chan<- sseEvent) {
+	var streams sync.WaitGroup
+	defer close(events)
+	defer streams.Wait()
+
+	started := make(map[string]bool)
+	startNew := func() error {
+		pods, err := kube.List(ctx, "pods", envoyGatewayNamespace, metav1.ListOptions{LabelSelector: envoyPodSelector(namespace, gateway)})
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods {
+			// A pending pod has no log yet; it is picked up on a later resync
+			phase, _, _ := unstructured.NestedString(pod.Object, "status", "phase")
+			if started[pod.GetName()] || phase == string(corev1.PodPending) {
+				continue
+			}
+			started[pod.GetName()] = true
+			streams.Add(1)
+			go func(name string) {
+				defer streams.Done()
+				streamPodLogs(ctx, kube, envoyGatewayNamespace, name, opts, events)
+			}(pod.GetName())
+		}
+		return nil
+	}
+
+	if err := startNew(); err != nil {
+		emit(ctx, events, "error", StreamError{Error: err.Error()})
+		return
+	}
+	if len(started) == 0 {
+		message := fmt.Sprintf("no running Envoy pod found for Gateway %s/%s", namespace, gateway)
+		if !opts.Follow {
+			emit(ctx, events, "error", StreamError{Error: message})
+			return
+		}
+		emit(ctx, events, "error", StreamError{Error: message + "; waiting for one to start"})
+	}
+	if !opts.Follow {
+		return
+	}
+
+	resync := time.NewTicker(gatewayPodResync)
+	defer resync.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-resync.C:
+			if err := startNew(); err != nil && ctx.Err() == nil {
+				emit(ctx, events, "error", StreamError{Error: err.Error()})
+			}
+		}
+	}
+}
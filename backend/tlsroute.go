@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type TLSRouteFormData struct {
+	Name       string              `json:"name"`
+	Namespace  string              `json:"namespace"`
+	ParentRefs []ParentRefFormData `json:"parentRefs"`
+	Hostnames  []string            `json:"hostnames"` // SNI hostnames matched against the ClientHello
+	Rules      []L4RuleFormData    `json:"rules"`
+}
+
+func (s *Server) handleCreateTLSRoute(w http.ResponseWriter, r *http.Request) {
+	var routeData TLSRouteFormData
+	if err := json.NewDecoder(r.Body).Decode(&routeData); err != nil {
+		s.sendError(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if errs := validateTLSRouteFormData(routeData); len(errs) > 0 {
+		s.sendFieldErrors(w, errs)
+		return
+	}
+
+	if err := s.validateRouteParentRefs(r.Context(), "TLSRoute", routeData.Namespace, routeData.ParentRefs); err != nil {
+		s.sendError(w, err.Error(), kubeErrorStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	yamlContent, err := s.generateTLSRouteYAML(routeData)
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to generate TLSRoute YAML: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.applyYAML(r.Context(), yamlContent, "tlsroute"); err != nil {
+		s.sendError(w, fmt.Sprintf("Failed to apply TLSRoute: %v", err), kubeErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Data:    fmt.Sprintf("TLSRoute %s created successfully in namespace %s", routeData.Name, routeData.Namespace),
+	}
+	s.sendResponse(w, response)
+}
+
+func (s *Server) generateTLSRouteYAML(data TLSRouteFormData) (string, error) {
+	route := L4RouteResource{
+		TypeMeta: TypeMeta{APIVersion: "gateway.networking.k8s.io/v1alpha2", Kind: "TLSRoute"},
+		Metadata: ObjectMeta{Name: data.Name, Namespace: data.Namespace},
+		Spec: L4RouteSpec{
+			ParentRefs: s.convertParentRefs(data.ParentRefs),
+			Hostnames:  data.Hostnames,
+			Rules:      s.convertL4RulesFromFormData(data.Rules),
+		},
+	}
+	return marshalResource(route)
+}
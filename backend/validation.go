@@ -0,0 +1,608 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FieldError reports one invalid form field by its JSON path, e.g. "listeners[1].hostname".
+// An empty path is the form as a whole.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type FieldErrors []FieldError
+
+func (errs *FieldErrors) add(field, format string, args ...interface{}) {
+	*errs = append(*errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (errs FieldErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Message
+		if err.Field != "" {
+			messages[i] = err.Field + ": " + err.Message
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (s *Server) sendFieldErrors(w http.ResponseWriter, errs FieldErrors) {
+	w.WriteHeader(http.StatusBadRequest)
+	response := APIResponse{Success: false, Error: errs.Error(), Errors: errs}
+	s.sendResponse(w, response)
+}
+
+var (
+	dns1123LabelPattern     = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	dns1123SubdomainPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	headerNamePattern       = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+\\-.^_`|~]+$")
+	// Gateway API and Envoy Gateway durations are a restricted form of Go durations, e.g.
+	// "1h30m" or "500ms": no fractions, signs or units below milliseconds
+	gatewayDurationPattern = regexp.MustCompile(`^([0-9]{1,5}(h|m|s|ms)){1,4}$`)
+)
+
+var httpMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "DELETE": true,
+	"CONNECT": true, "OPTIONS": true, "TRACE": true, "PATCH": true,
+}
+
+func validateObjectName(errs *FieldErrors, field, name string) {
+	if name == "" {
+		errs.add(field, "is required")
+	} else if len(name) > 253 || !dns1123SubdomainPattern.MatchString(name) {
+		errs.add(field, "must be a lowercase RFC 1123 subdomain (a-z, 0-9, '-' and '.')")
+	}
+}
+
+func validateDNSLabel(errs *FieldErrors, field, label string) {
+	if label == "" {
+		errs.add(field, "is required")
+	} else if len(label) > 63 || !dns1123LabelPattern.MatchString(label) {
+		errs.add(field, "must be a lowercase RFC 1123 label (a-z, 0-9 and '-', at most 63 characters)")
+	}
+}
+
+// validateHostname checks an RFC 1123 hostname. The Gateway API and cert-manager both
+// accept a single leading "*." wildcard label, and neither accepts IP addresses.
+func validateHostname(errs *FieldErrors, field, hostname string, allowWildcard bool) {
+	name := hostname
+	if allowWildcard {
+		name = strings.TrimPrefix(name, "*.")
+	}
+	if net.ParseIP(hostname) != nil {
+		errs.add(field, "must be a hostname, not an IP address")
+		return
+	}
+	if len(hostname) > 253 || !dns1123SubdomainPattern.MatchString(name) {
+		if allowWildcard {
+			errs.add(field, "%q is not a valid RFC 1123 hostname (a single leading '*.' wildcard is allowed)", hostname)
+		} else {
+			errs.add(field, "%q is not a valid RFC 1123 hostname", hostname)
+		}
+	}
+}
+
+func validatePort(errs *FieldErrors, field string, port int) {
+	if port < 1 || port > 65535 {
+		errs.add(field, "must be between 1 and 65535")
+	}
+}
+
+func validateNonNegative(errs *FieldErrors, field string, value int) {
+	if value < 0 {
+		errs.add(field, "must not be negative")
+	}
+}
+
+func validateRegex(errs *FieldErrors, field, pattern string) {
+	if _, err := regexp.Compile(pattern); err != nil {
+		errs.add(field, "invalid regular expression: %v", err)
+	}
+}
+
+func validateGatewayDuration(errs *FieldErrors, field, duration string) {
+	if duration != "" && !gatewayDurationPattern.MatchString(duration) {
+		errs.add(field, "%q is not a valid duration (use up to four h/m/s/ms units, e.g. 10s or 1m30s)", duration)
+	}
+}
+
+func validateGatewayFormData(data GatewayFormData) FieldErrors {
+	var errs FieldErrors
+	validateObjectName(&errs, "name", data.Name)
+	validateDNSLabel(&errs, "namespace", data.Namespace)
+	validateObjectName(&errs, "gatewayClassName", data.GatewayClassName)
+
+	if len(data.Listeners) == 0 {
+		errs.add("listeners", "at least one listener is required")
+	}
+	names := map[string]int{}
+	endpoints := map[string]int{}
+	for i, listener := range data.Listeners {
+		field := fmt.Sprintf("listeners[%d]", i)
+		validateObjectName(&errs, field+".name", listener.Name)
+		if first, ok := names[listener.Name]; ok && listener.Name != "" {
+			errs.add(field+".name", "duplicates the name of listeners[%d]", first)
+		} else {
+			names[listener.Name] = i
+		}
+
+		validatePort(&errs, field+".port", listener.Port)
+		switch listener.Protocol {
+		case "HTTP", "HTTPS", "TLS", "TCP", "UDP":
+		default:
+			errs.add(field+".protocol", "must be HTTP, HTTPS, TLS, TCP or UDP")
+		}
+		if listener.Hostname != "" {
+			validateHostname(&errs, field+".hostname", listener.Hostname, true)
+		}
+
+		// Listeners must be distinct, otherwise the Gateway reports them as Conflicted
+		endpoint := fmt.Sprintf("%d/%s/%s", listener.Port, listener.Protocol, listener.Hostname)
+		if first, ok := endpoints[endpoint]; ok {
+			errs.add(field, "has the same port, protocol and hostname as listeners[%d]", first)
+		} else {
+			endpoints[endpoint] = i
+		}
+
+		validateListenerTLS(&errs, field, listener)
+		validateListenerAllowedRoutes(&errs, field+".allowedRoutes", listener.AllowedRoutes)
+	}
+
+	for i, address := range data.Addresses {
+		field := fmt.Sprintf("addresses[%d].value", i)
+		switch address.Type {
+		case "", "IPAddress":
+			if net.ParseIP(address.Value) == nil {
+				errs.add(field, "%q is not a valid IP address", address.Value)
+			}
+		case "Hostname":
+			validateHostname(&errs, field, address.Value, false)
+		default:
+			errs.add(fmt.Sprintf("addresses[%d].type", i), "must be IPAddress or Hostname")
+		}
+	}
+
+	return errs
+}
+
+// validateListenerTLS rejects listener TLS settings the Gateway API would never accept,
+// so the user gets a clear error before anything is sent to kubectl
+func validateListenerTLS(errs *FieldErrors, field string, listener Listener) {
+	switch listener.Protocol {
+	case "HTTPS", "TLS":
+		if listener.TLS == nil {
+			errs.add(field+".tls", "is required for protocol %s", listener.Protocol)
+			return
+		}
+	default:
+		if listener.TLS != nil {
+			errs.add(field+".tls", "is only supported for HTTPS and TLS listeners, not %s", listener.Protocol)
+		}
+		return
+	}
+
+	switch listener.TLS.Mode {
+	case "", "Terminate":
+		if len(listener.TLS.CertificateRefs) == 0 {
+			errs.add(field+".tls.certificateRefs", "at least one certificateRef is required for TLS mode Terminate")
+		}
+	case "Passthrough":
+		if listener.Protocol != "TLS" {
+			errs.add(field+".tls.mode", "Passthrough is only supported with protocol TLS, not %s", listener.Protocol)
+		}
+		if len(listener.TLS.CertificateRefs) > 0 {
+			errs.add(field+".tls.certificateRefs", "cannot be combined with TLS mode Passthrough")
+		}
+	default:
+		errs.add(field+".tls.mode", "must be Terminate or Passthrough")
+	}
+	for j, ref := range listener.TLS.CertificateRefs {
+		validateObjectName(errs, fmt.Sprintf("%s.tls.certificateRefs[%d].name", field, j), ref.Name)
+	}
+}
+
+// validateListenerAllowedRoutes rejects allowedRoutes settings the API server would refuse
+func validateListenerAllowedRoutes(errs *FieldErrors, field string, allowed *AllowedRoutes) {
+	if allowed == nil {
+		return
+	}
+	for i, kind := range allowed.Kinds {
+		if kind.Kind == "" {
+			errs.add(fmt.Sprintf("%s.kinds[%d].kind", field, i), "is required")
+		}
+	}
+	if allowed.Namespaces == nil {
+		return
+	}
+
+	namespaces := allowed.Namespaces
+	switch namespaces.From {
+	case "", "All", "Same":
+	case "Selector":
+		selector := namespaces.Selector
+		if selector == nil || (len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0) {
+			errs.add(field+".namespaces.selector", "is required when from is Selector")
+			return
+		}
+		for i, expr := range selector.MatchExpressions {
+			exprField := fmt.Sprintf("%s.namespaces.selector.matchExpressions[%d]", field, i)
+			if expr.Key == "" {
+				errs.add(exprField+".key", "is required")
+			}
+			switch expr.Operator {
+			case "In", "NotIn":
+				if len(expr.Values) == 0 {
+					errs.add(exprField+".values", "are required for operator %s", expr.Operator)
+				}
+			case "Exists", "DoesNotExist":
+				if len(expr.Values) > 0 {
+					errs.add(exprField+".values", "must be empty for operator %s", expr.Operator)
+				}
+			default:
+				errs.add(exprField+".operator", "must be In, NotIn, Exists or DoesNotExist")
+			}
+		}
+	default:
+		errs.add(field+".namespaces.from", "must be All, Same or Selector")
+	}
+}
+
+func validateHTTPRouteFormData(data HTTPRouteFormData) FieldErrors {
+	var errs FieldErrors
+	validateObjectName(&errs, "name", data.Name)
+	validateDNSLabel(&errs, "namespace", data.Namespace)
+	validateObjectName(&errs, "parentGateway", data.ParentGateway)
+	if data.ParentGatewayNamespace != "" {
+		validateDNSLabel(&errs, "parentGatewayNamespace", data.ParentGatewayNamespace)
+	}
+	if data.ParentPort != 0 {
+		validatePort(&errs, "parentPort", data.ParentPort)
+	}
+	for i, hostname := range data.Hostnames {
+		validateHostname(&errs, fmt.Sprintf("hostnames[%d]", i), hostname, true)
+	}
+
+	for i, rule := range data.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		for j, match := range rule.Matches {
+			validateHTTPRouteMatch(&errs, fmt.Sprintf("%s.matches[%d]", field, j), match)
+		}
+
+		validateHTTPFilters(&errs, field+".filters", rule.Filters, rule.Matches)
+		for j, ref := range rule.BackendRefs {
+			refField := fmt.Sprintf("%s.backendRefs[%d]", field, j)
+			validateBackendRef(&errs, refField, ref)
+			validateHTTPFilters(&errs, refField+".filters", ref.Filters, rule.Matches)
+		}
+
+		validateGatewayDuration(&errs, field+".requestTimeout", rule.RequestTimeout)
+		validateGatewayDuration(&errs, field+".backendRequestTimeout", rule.BackendRequestTimeout)
+		if rule.RequestTimeout != "" && rule.BackendRequestTimeout != "" {
+			request, requestErr := time.ParseDuration(rule.RequestTimeout)
+			backendRequest, backendErr := time.ParseDuration(rule.BackendRequestTimeout)
+			// A request timeout of 0s disables it, so any backend timeout fits inside
+			if requestErr == nil && backendErr == nil && request > 0 && backendRequest > request {
+				errs.add(field+".backendRequestTimeout", "must not be longer than requestTimeout")
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateHTTPRouteMatch(errs *FieldErrors, field string, match HTTPRouteMatchFormData) {
+	switch match.PathType {
+	case "Exact", "PathPrefix":
+		if !strings.HasPrefix(match.PathValue, "/") {
+			errs.add(field+".pathValue", "must start with '/'")
+		} else if strings.Contains(match.PathValue, "//") {
+			errs.add(field+".pathValue", "must not contain '//'")
+		}
+	case "RegularExpression":
+		validateRegex(errs, field+".pathValue", match.PathValue)
+	case "":
+		if match.PathValue != "" {
+			errs.add(field+".pathType", "is required when pathValue is set")
+		}
+	default:
+		errs.add(field+".pathType", "must be Exact, PathPrefix or RegularExpression")
+	}
+
+	if match.Method != "" && !httpMethods[match.Method] {
+		errs.add(field+".method", "%q is not a supported HTTP method", match.Method)
+	}
+
+	for k, header := range match.Headers {
+		validateValueMatch(errs, fmt.Sprintf("%s.headers[%d]", field, k), header.Type, header.Value)
+		if !headerNamePattern.MatchString(header.Name) {
+			errs.add(fmt.Sprintf("%s.headers[%d].name", field, k), "%q is not a valid header name", header.Name)
+		}
+	}
+	for k, param := range match.QueryParams {
+		validateValueMatch(errs, fmt.Sprintf("%s.queryParams[%d]", field, k), param.Type, param.Value)
+		if param.Name == "" {
+			errs.add(fmt.Sprintf("%s.queryParams[%d].name", field, k), "is required")
+		}
+	}
+}
+
+func validateValueMatch(errs *FieldErrors, field, matchType, value string) {
+	switch matchType {
+	case "", "Exact":
+	case "RegularExpression":
+		validateRegex(errs, field+".value", value)
+	default:
+		errs.add(field+".type", "must be Exact or RegularExpression")
+	}
+}
+
+func validateBackendRef(errs *FieldErrors, field string, ref HTTPBackendRefFormData) {
+	validateDNSLabel(errs, field+".name", ref.Name)
+	if ref.Namespace != "" {
+		validateDNSLabel(errs, field+".namespace", ref.Namespace)
+	}
+	validatePort(errs, field+".port", ref.Port)
+	if ref.Weight != nil && (*ref.Weight < 0 || *ref.Weight > 1000000) {
+		errs.add(field+".weight", "must be between 0 and 1000000")
+	}
+}
+
+func validateHTTPFilters(errs *FieldErrors, field string, filters []HTTPRouteFilterFormData, matches []HTTPRouteMatchFormData) {
+	for i, filter := range filters {
+		filterField := fmt.Sprintf("%s[%d]", field, i)
+		switch filter.Type {
+		case "RequestHeaderModifier":
+			validateHeaderModifier(errs, filterField+".requestHeaderModifier", filter.RequestHeaderModifier)
+		case "ResponseHeaderModifier":
+			validateHeaderModifier(errs, filterField+".responseHeaderModifier", filter.ResponseHeaderModifier)
+		case "RequestRedirect":
+			redirect := filter.RequestRedirect
+			if redirect == nil {
+				errs.add(filterField+".requestRedirect", "is required for a RequestRedirect filter")
+				continue
+			}
+			if redirect.Scheme != "" && redirect.Scheme != "http" && redirect.Scheme != "https" {
+				errs.add(filterField+".requestRedirect.scheme", "must be http or https")
+			}
+			if redirect.Hostname != "" {
+				validateHostname(errs, filterField+".requestRedirect.hostname", redirect.Hostname, false)
+			}
+			if redirect.Port != 0 {
+				validatePort(errs, filterField+".requestRedirect.port", redirect.Port)
+			}
+			if redirect.StatusCode != 0 && redirect.StatusCode != 301 && redirect.StatusCode != 302 {
+				errs.add(filterField+".requestRedirect.statusCode", "must be 301 or 302")
+			}
+			validatePathModifier(errs, filterField+".requestRedirect.path", redirect.Path, matches)
+		case "URLRewrite":
+			rewrite := filter.URLRewrite
+			if rewrite == nil {
+				errs.add(filterField+".urlRewrite", "is required for a URLRewrite filter")
+				continue
+			}
+			if rewrite.Hostname != "" {
+				validateHostname(errs, filterField+".urlRewrite.hostname", rewrite.Hostname, false)
+			}
+			validatePathModifier(errs, filterField+".urlRewrite.path", rewrite.Path, matches)
+		case "RequestMirror":
+			mirror := filter.RequestMirror
+			if mirror == nil {
+				errs.add(filterField+".requestMirror", "is required for a RequestMirror filter")
+				continue
+			}
+			validateBackendRef(errs, filterField+".requestMirror.backendRef", mirror.BackendRef)
+			if mirror.Percent < 0 || mirror.Percent > 100 {
+				errs.add(filterField+".requestMirror.percent", "must be between 0 and 100")
+			}
+			if fraction := mirror.Fraction; fraction != nil {
+				denominator := fraction.Denominator
+				if denominator == 0 {
+					denominator = 100
+				}
+				if fraction.Numerator < 0 || fraction.Numerator > denominator {
+					errs.add(filterField+".requestMirror.fraction", "numerator must be between 0 and the denominator")
+				}
+			}
+		default:
+			errs.add(filterField+".type", "must be RequestHeaderModifier, ResponseHeaderModifier, RequestRedirect, URLRewrite or RequestMirror")
+		}
+	}
+}
+
+func validateHeaderModifier(errs *FieldErrors, field string, modifier *HeaderModifierFormData) {
+	if modifier == nil {
+		errs.add(field, "is required for this filter type")
+		return
+	}
+	for i, header := range modifier.Set {
+		if !headerNamePattern.MatchString(header.Name) {
+			errs.add(fmt.Sprintf("%s.set[%d].name", field, i), "%q is not a valid header name", header.Name)
+		}
+	}
+	for i, header := range modifier.Add {
+		if !headerNamePattern.MatchString(header.Name) {
+			errs.add(fmt.Sprintf("%s.add[%d].name", field, i), "%q is not a valid header name", header.Name)
+		}
+	}
+	for i, name := range modifier.Remove {
+		if !headerNamePattern.MatchString(name) {
+			errs.add(fmt.Sprintf("%s.remove[%d]", field, i), "%q is not a valid header name", name)
+		}
+	}
+}
+
+func validatePathModifier(errs *FieldErrors, field string, path *HTTPPathModifierFormData, matches []HTTPRouteMatchFormData) {
+	if path == nil {
+		return
+	}
+	switch path.Type {
+	case "ReplaceFullPath":
+	case "ReplacePrefixMatch":
+		// The API only defines a prefix replacement relative to a PathPrefix match; a
+		// rule without matches, or a match without a path, gets the default PathPrefix "/"
+		for _, match := range matches {
+			if match.PathType != "" && match.PathType != "PathPrefix" {
+				errs.add(field+".type", "ReplacePrefixMatch requires every match in the rule to be a PathPrefix match")
+				break
+			}
+		}
+	default:
+		errs.add(field+".type", "must be ReplaceFullPath or ReplacePrefixMatch")
+	}
+	if !strings.HasPrefix(path.Value, "/") {
+		errs.add(field+".value", "must start with '/'")
+	}
+}
+
+func validateGRPCRouteFormData(data GRPCRouteFormData) FieldErrors {
+	var errs FieldErrors
+	validateObjectName(&errs, "name", data.Name)
+	validateDNSLabel(&errs, "namespace", data.Namespace)
+	validateObjectName(&errs, "parentGateway", data.ParentGateway)
+	if data.ParentGatewayNamespace != "" {
+		validateDNSLabel(&errs, "parentGatewayNamespace", data.ParentGatewayNamespace)
+	}
+	for i, hostname := range data.Hostnames {
+		validateHostname(&errs, fmt.Sprintf("hostnames[%d]", i), hostname, true)
+	}
+
+	for i, rule := range data.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		for j, match := range rule.Matches {
+			matchField := fmt.Sprintf("%s.matches[%d]", field, j)
+			switch match.MethodType {
+			case "", "Exact":
+				// The Gateway API requires at least one of service or method for an Exact match
+				if match.MethodType == "Exact" && match.Service == "" && match.Method == "" {
+					errs.add(matchField+".service", "service or method is required for an Exact match")
+				}
+			case "RegularExpression":
+				validateRegex(&errs, matchField+".service", match.Service)
+				validateRegex(&errs, matchField+".method", match.Method)
+			default:
+				errs.add(matchField+".methodType", "must be Exact or RegularExpression")
+			}
+			for k, header := range match.Headers {
+				validateValueMatch(&errs, fmt.Sprintf("%s.headers[%d]", matchField, k), header.Type, header.Value)
+				if !headerNamePattern.MatchString(header.Name) {
+					errs.add(fmt.Sprintf("%s.headers[%d].name", matchField, k), "%q is not a valid header name", header.Name)
+				}
+			}
+		}
+
+		validateGRPCFilters(&errs, field+".filters", rule.Filters)
+		if len(rule.BackendRefs) == 0 {
+			errs.add(field+".backendRefs", "at least one backendRef is required")
+		}
+		for j, ref := range rule.BackendRefs {
+			refField := fmt.Sprintf("%s.backendRefs[%d]", field, j)
+			validateBackendRef(&errs, refField, HTTPBackendRefFormData{Name: ref.Name, Port: ref.Port, Weight: ref.Weight})
+			validateGRPCFilters(&errs, refField+".filters", ref.Filters)
+		}
+	}
+
+	return errs
+}
+
+func validateGRPCFilters(errs *FieldErrors, field string, filters []GRPCRouteFilterFormData) {
+	for i, filter := range filters {
+		filterField := fmt.Sprintf("%s[%d]", field, i)
+		switch filter.Type {
+		case "RequestHeaderModifier":
+			validateHeaderModifier(errs, filterField+".requestHeaderModifier", filter.RequestHeaderModifier)
+		case "ResponseHeaderModifier":
+			validateHeaderModifier(errs, filterField+".responseHeaderModifier", filter.ResponseHeaderModifier)
+		case "RequestMirror":
+			if filter.RequestMirror == nil {
+				errs.add(filterField+".requestMirror", "is required for a RequestMirror filter")
+				continue
+			}
+			validateDNSLabel(errs, filterField+".requestMirror.name", filter.RequestMirror.Name)
+			validatePort(errs, filterField+".requestMirror.port", filter.RequestMirror.Port)
+		default:
+			errs.add(filterField+".type", "must be RequestHeaderModifier, ResponseHeaderModifier or RequestMirror")
+		}
+	}
+}
+
+func validateL4RouteFormData(data L4RouteFormData) FieldErrors {
+	var errs FieldErrors
+	validateObjectName(&errs, "name", data.Name)
+	validateDNSLabel(&errs, "namespace", data.Namespace)
+	validateParentRefs(&errs, data.ParentRefs)
+	validateL4Rules(&errs, data.Rules)
+	return errs
+}
+
+func validateTLSRouteFormData(data TLSRouteFormData) FieldErrors {
+	var errs FieldErrors
+	validateObjectName(&errs, "name", data.Name)
+	validateDNSLabel(&errs, "namespace", data.Namespace)
+	validateParentRefs(&errs, data.ParentRefs)
+	for i, hostname := range data.Hostnames {
+		validateHostname(&errs, fmt.Sprintf("hostnames[%d]", i), hostname, true)
+	}
+	validateL4Rules(&errs, data.Rules)
+	return errs
+}
+
+func validateParentRefs(errs *FieldErrors, parentRefs []ParentRefFormData) {
+	if len(parentRefs) == 0 {
+		errs.add("parentRefs", "at least one parentRef is required")
+	}
+	for i, ref := range parentRefs {
+		field := fmt.Sprintf("parentRefs[%d]", i)
+		validateObjectName(errs, field+".name", ref.Name)
+		if ref.Namespace != "" {
+			validateDNSLabel(errs, field+".namespace", ref.Namespace)
+		}
+		if ref.Port != 0 {
+			validatePort(errs, field+".port", ref.Port)
+		}
+	}
+}
+
+func validateL4Rules(errs *FieldErrors, rules []L4RuleFormData) {
+	if len(rules) == 0 {
+		errs.add("rules", "at least one rule is required")
+	}
+	for i, rule := range rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		if len(rule.BackendRefs) == 0 {
+			errs.add(field+".backendRefs", "at least one backendRef is required")
+		}
+		for j, ref := range rule.BackendRefs {
+			validateBackendRef(errs, fmt.Sprintf("%s.backendRefs[%d]", field, j), ref)
+		}
+	}
+}
+
+func validateCertificateFormData(data CertificateFormData) FieldErrors {
+	var errs FieldErrors
+	validateObjectName(&errs, "name", data.Name)
+	validateDNSLabel(&errs, "namespace", data.Namespace)
+
+	if len(data.DNSNames) == 0 {
+		errs.add("dnsNames", "at least one DNS name is required")
+	}
+	for i, dnsName := range data.DNSNames {
+		validateHostname(&errs, fmt.Sprintf("dnsNames[%d]", i), dnsName, true)
+	}
+
+	switch data.IssuerType {
+	case "self-signed":
+	case "ca-issuer":
+		validateObjectName(&errs, "issuerName", data.IssuerName)
+	default:
+		errs.add("issuerType", "must be self-signed or ca-issuer")
+	}
+
+	return errs
+}
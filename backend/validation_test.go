@@ -0,0 +1,222 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// errorFields lists the fields of errs in order, for comparing against the expected paths
+func errorFields(errs FieldErrors) []string {
+	var fields []string
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+	return fields
+}
+
+func checkFieldErrors(t *testing.T, name string, errs FieldErrors, want []string) {
+	t.Helper()
+	if got := errorFields(errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: error fields = %v, want %v (%v)", name, got, want, errs)
+	}
+}
+
+func validGatewayFormData() GatewayFormData {
+	return GatewayFormData{
+		Name:             "eg",
+		Namespace:        "default",
+		GatewayClassName: "eg",
+		Listeners: []Listener{
+			{Name: "http", Port: 80, Protocol: "HTTP"},
+			{Name: "https", Port: 443, Protocol: "HTTPS", Hostname: "*.example.com", TLS: &TLS{Mode: "Terminate", CertificateRefs: []CertRef{{Name: "example-tls"}}}},
+		},
+	}
+}
+
+func TestValidateGatewayFormData(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(data *GatewayFormData)
+		want   []string
+	}{
+		{"valid", func(data *GatewayFormData) {}, nil},
+		{"no listeners", func(data *GatewayFormData) { data.Listeners = nil }, []string{"listeners"}},
+		{"bad name", func(data *GatewayFormData) { data.Name = "Not_Valid" }, []string{"name"}},
+		{"duplicate listener", func(data *GatewayFormData) {
+			data.Listeners = append(data.Listeners, Listener{Name: "http", Port: 80, Protocol: "HTTP"})
+		}, []string{"listeners[2].name", "listeners[2]"}},
+		{"bad protocol and port", func(data *GatewayFormData) {
+			data.Listeners[0].Protocol = "QUIC"
+			data.Listeners[0].Port = 70000
+		}, []string{"listeners[0].port", "listeners[0].protocol"}},
+		{"https without tls", func(data *GatewayFormData) { data.Listeners[1].TLS = nil }, []string{"listeners[1].tls"}},
+		{"tls on http", func(data *GatewayFormData) { data.Listeners[0].TLS = &TLS{} }, []string{"listeners[0].tls"}},
+		{"passthrough on https", func(data *GatewayFormData) { data.Listeners[1].TLS.Mode = "Passthrough" }, []string{
+			"listeners[1].tls.mode", "listeners[1].tls.certificateRefs",
+		}},
+		{"selector without labels", func(data *GatewayFormData) {
+			data.Listeners[0].AllowedRoutes = &AllowedRoutes{Namespaces: &RouteNamespaces{From: "Selector"}}
+		}, []string{"listeners[0].allowedRoutes.namespaces.selector"}},
+		{"selector expression", func(data *GatewayFormData) {
+			data.Listeners[0].AllowedRoutes = &AllowedRoutes{
+				Kinds: []RouteGroupKind{{}},
+				Namespaces: &RouteNamespaces{From: "Selector", Selector: &LabelSelector{
+					MatchExpressions: []LabelSelectorRequirement{{Key: "team", Operator: "In"}},
+				}},
+			}
+		}, []string{"listeners[0].allowedRoutes.kinds[0].kind", "listeners[0].allowedRoutes.namespaces.selector.matchExpressions[0].values"}},
+		{"addresses", func(data *GatewayFormData) {
+			data.Addresses = []GatewayAddress{{Value: "10.0.0.1"}, {Value: "not-an-ip"}, {Type: "Hostname", Value: "lb.example.com"}, {Type: "Named", Value: "x"}}
+		}, []string{"addresses[1].value", "addresses[3].type"}},
+	}
+	for _, test := range tests {
+		data := validGatewayFormData()
+		test.modify(&data)
+		checkFieldErrors(t, test.name, validateGatewayFormData(data), test.want)
+	}
+}
+
+func validHTTPRouteFormData() HTTPRouteFormData {
+	return HTTPRouteFormData{
+		Name:          "web",
+		Namespace:     "default",
+		ParentGateway: "eg",
+		Hostnames:     []string{"www.example.com"},
+		Rules: []HTTPRuleFormData{{
+			Matches:     []HTTPRouteMatchFormData{{PathType: "PathPrefix", PathValue: "/api"}},
+			BackendRefs: []HTTPBackendRefFormData{{Name: "web", Port: 8080}},
+		}},
+	}
+}
+
+func TestValidateHTTPRouteFormData(t *testing.T) {
+	weight := -1
+	prefixRewrite := []HTTPRouteFilterFormData{{
+		Type:       "URLRewrite",
+		URLRewrite: &HTTPURLRewriteFormData{Path: &HTTPPathModifierFormData{Type: "ReplacePrefixMatch", Value: "/v2"}},
+	}}
+	tests := []struct {
+		name   string
+		modify func(data *HTTPRouteFormData)
+		want   []string
+	}{
+		{"valid", func(data *HTTPRouteFormData) {}, nil},
+		{"path without slash", func(data *HTTPRouteFormData) { data.Rules[0].Matches[0].PathValue = "api" }, []string{"rules[0].matches[0].pathValue"}},
+		{"path value without type", func(data *HTTPRouteFormData) { data.Rules[0].Matches[0].PathType = "" }, []string{"rules[0].matches[0].pathType"}},
+		{"bad regex and method", func(data *HTTPRouteFormData) {
+			data.Rules[0].Matches[0] = HTTPRouteMatchFormData{PathType: "RegularExpression", PathValue: "(", Method: "FETCH"}
+		}, []string{"rules[0].matches[0].pathValue", "rules[0].matches[0].method"}},
+		{"bad header match", func(data *HTTPRouteFormData) {
+			data.Rules[0].Matches[0].Headers = []HTTPRouteHeaderMatchFormData{{Type: "Prefix", Name: "bad header", Value: "x"}}
+		}, []string{"rules[0].matches[0].headers[0].type", "rules[0].matches[0].headers[0].name"}},
+		{"backend", func(data *HTTPRouteFormData) {
+			data.Rules[0].BackendRefs[0] = HTTPBackendRefFormData{Name: "Web", Port: 0, Weight: &weight}
+		}, []string{"rules[0].backendRefs[0].name", "rules[0].backendRefs[0].port", "rules[0].backendRefs[0].weight"}},
+		{"wildcard hostname", func(data *HTTPRouteFormData) { data.Hostnames = []string{"*.example.com"} }, nil},
+		{"timeouts", func(data *HTTPRouteFormData) {
+			data.Rules[0].RequestTimeout = "10s"
+			data.Rules[0].BackendRequestTimeout = "30s"
+		}, []string{"rules[0].backendRequestTimeout"}},
+		{"bad duration", func(data *HTTPRouteFormData) { data.Rules[0].RequestTimeout = "10 seconds" }, []string{"rules[0].requestTimeout"}},
+		{"prefix rewrite", func(data *HTTPRouteFormData) { data.Rules[0].Filters = prefixRewrite }, nil},
+		{"prefix rewrite without matches", func(data *HTTPRouteFormData) {
+			data.Rules[0].Matches = nil
+			data.Rules[0].Filters = prefixRewrite
+		}, nil},
+		{"prefix rewrite of a header-only match", func(data *HTTPRouteFormData) {
+			data.Rules[0].Matches = []HTTPRouteMatchFormData{{Headers: []HTTPRouteHeaderMatchFormData{{Name: "x-canary", Value: "true"}}}}
+			data.Rules[0].Filters = prefixRewrite
+		}, nil},
+		{"prefix rewrite of an exact match", func(data *HTTPRouteFormData) {
+			data.Rules[0].Matches[0].PathType = "Exact"
+			data.Rules[0].Filters = prefixRewrite
+		}, []string{"rules[0].filters[0].urlRewrite.path.type"}},
+		{"redirect", func(data *HTTPRouteFormData) {
+			data.Rules[0].Filters = []HTTPRouteFilterFormData{{
+				Type:            "RequestRedirect",
+				RequestRedirect: &HTTPRedirectFormData{Scheme: "ftp", StatusCode: 307, Path: &HTTPPathModifierFormData{Type: "ReplaceFullPath", Value: "v2"}},
+			}}
+		}, []string{"rules[0].filters[0].requestRedirect.scheme", "rules[0].filters[0].requestRedirect.statusCode", "rules[0].filters[0].requestRedirect.path.value"}},
+		{"mirror fraction", func(data *HTTPRouteFormData) {
+			data.Rules[0].BackendRefs[0].Filters = []HTTPRouteFilterFormData{{
+				Type: "RequestMirror",
+				RequestMirror: &HTTPRequestMirrorFormData{
+					BackendRef: HTTPBackendRefFormData{Name: "shadow", Port: 8080},
+					Fraction:   &MirrorFractionFormData{Numerator: 150},
+				},
+			}}
+		}, []string{"rules[0].backendRefs[0].filters[0].requestMirror.fraction"}},
+		{"filter without settings", func(data *HTTPRouteFormData) {
+			data.Rules[0].Filters = []HTTPRouteFilterFormData{{Type: "RequestHeaderModifier"}, {Type: "Rewrite"}}
+		}, []string{"rules[0].filters[0].requestHeaderModifier", "rules[0].filters[1].type"}},
+	}
+	for _, test := range tests {
+		data := validHTTPRouteFormData()
+		test.modify(&data)
+		checkFieldErrors(t, test.name, validateHTTPRouteFormData(data), test.want)
+	}
+}
+
+func TestValidateGRPCRouteFormData(t *testing.T) {
+	valid := func() GRPCRouteFormData {
+		return GRPCRouteFormData{
+			Name:          "grpc",
+			Namespace:     "default",
+			ParentGateway: "eg",
+			Rules: []GRPCRuleFormData{{
+				Matches:     []GRPCRouteMatchFormData{{MethodType: "Exact", Service: "helloworld.Greeter"}},
+				BackendRefs: []GRPCBackendRefFormData{{Name: "greeter", Port: 9000}},
+			}},
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(data *GRPCRouteFormData)
+		want   []string
+	}{
+		{"valid", func(data *GRPCRouteFormData) {}, nil},
+		{"exact without service or method", func(data *GRPCRouteFormData) { data.Rules[0].Matches[0].Service = "" }, []string{"rules[0].matches[0].service"}},
+		{"bad regex", func(data *GRPCRouteFormData) {
+			data.Rules[0].Matches[0] = GRPCRouteMatchFormData{MethodType: "RegularExpression", Service: "(", Method: "Say.*"}
+		}, []string{"rules[0].matches[0].service"}},
+		{"no backends", func(data *GRPCRouteFormData) { data.Rules[0].BackendRefs = nil }, []string{"rules[0].backendRefs"}},
+		{"mirror without backend", func(data *GRPCRouteFormData) {
+			data.Rules[0].Filters = []GRPCRouteFilterFormData{{Type: "RequestMirror"}}
+		}, []string{"rules[0].filters[0].requestMirror"}},
+	}
+	for _, test := range tests {
+		data := valid()
+		test.modify(&data)
+		checkFieldErrors(t, test.name, validateGRPCRouteFormData(data), test.want)
+	}
+}
+
+func TestValidateL4AndTLSRouteFormData(t *testing.T) {
+	rules := []L4RuleFormData{{BackendRefs: []HTTPBackendRefFormData{{Name: "db", Port: 5432}}}}
+	parentRefs := []ParentRefFormData{{Name: "eg", SectionName: "tcp"}}
+
+	checkFieldErrors(t, "valid L4", validateL4RouteFormData(L4RouteFormData{Name: "db", Namespace: "default", ParentRefs: parentRefs, Rules: rules}), nil)
+	checkFieldErrors(t, "empty L4", validateL4RouteFormData(L4RouteFormData{Name: "db", Namespace: "default"}), []string{"parentRefs", "rules"})
+	checkFieldErrors(t, "bad parentRef", validateL4RouteFormData(L4RouteFormData{
+		Name: "db", Namespace: "default", ParentRefs: []ParentRefFormData{{Name: "eg", Namespace: "Infra", Port: 99999}}, Rules: []L4RuleFormData{{}},
+	}), []string{"parentRefs[0].namespace", "parentRefs[0].port", "rules[0].backendRefs"})
+
+	checkFieldErrors(t, "valid TLS", validateTLSRouteFormData(TLSRouteFormData{
+		Name: "db", Namespace: "default", ParentRefs: parentRefs, Hostnames: []string{"*.example.com"}, Rules: rules,
+	}), nil)
+	checkFieldErrors(t, "bad TLS hostname", validateTLSRouteFormData(TLSRouteFormData{
+		Name: "db", Namespace: "default", ParentRefs: parentRefs, Hostnames: []string{"bad_host"}, Rules: rules,
+	}), []string{"hostnames[0]"})
+}
+
+func TestValidateCertificateFormData(t *testing.T) {
+	valid := CertificateFormData{Name: "web", Namespace: "default", DNSNames: []string{"www.example.com"}, IssuerType: "self-signed"}
+	checkFieldErrors(t, "valid", validateCertificateFormData(valid), nil)
+
+	caIssuer := valid
+	caIssuer.IssuerType = "ca-issuer"
+	checkFieldErrors(t, "ca issuer without name", validateCertificateFormData(caIssuer), []string{"issuerName"})
+
+	invalid := CertificateFormData{Name: "web", Namespace: "default", IssuerType: "acme"}
+	checkFieldErrors(t, "invalid", validateCertificateFormData(invalid), []string{"dnsNames", "issuerType"})
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// maxWatchBackoff caps the wait before a failed watch is retried
+const maxWatchBackoff = 30 * time.Second
+
+// errWatchExpired means the resourceVersion being watched from is too old, so the kind
+// has to be listed again
+var errWatchExpired = errors.New("resourceVersion expired")
+
+// watchKind is a resource type /watch can stream. normalize turns an object into the
+// event's payload and returns its conditions, for reporting transitions.
+type watchKind struct {
+	inventoryKind
+	normalize func(kind watchKind, object *unstructured.Unstructured) (interface{}, []InventoryCondition, error)
+}
+
+// defaultWatchKinds are the inventory kinds, which /watch streams when kinds is not given
+func defaultWatchKinds() []watchKind {
+	kinds := make([]watchKind, 0, len(inventoryKinds))
+	for _, kind := range inventoryKinds {
+		kinds = append(kinds, watchKind{inventoryKind: kind, normalize: normalizeWatchedInventory})
+	}
+	return kinds
+}
+
+// backendWatchKinds are the Services and EndpointSlices behind routes. A cluster has far
+// more of them than Gateway API objects and they change with every rollout, so they are
+// only streamed when named in kinds.
+var backendWatchKinds = []watchKind{
+	{inventoryKind{"services", "Service", "services", true}, normalizeWatchedService},
+	{inventoryKind{"endpointslices", "EndpointSlice", "endpointslices.discovery.k8s.io", true}, normalizeWatchedEndpointSlice},
+}
+
+func normalizeWatchedInventory(kind watchKind, object *unstructured.Unstructured) (interface{}, []InventoryCondition, error) {
+	item, err := normalizeInventoryItem(kind.inventoryKind, object)
+	return item, item.Conditions, err
+}
+
+type WatchedService struct {
+	Kind                  string            `json:"kind"`
+	Name                  string            `json:"name"`
+	Namespace             string            `json:"namespace"`
+	Type                  string            `json:"type"`
+	ClusterIP             string            `json:"clusterIP,omitempty"`
+	Ports                 []string          `json:"ports,omitempty"` // "80/TCP"
+	Selector              map[string]string `json:"selector,omitempty"`
+	LoadBalancerAddresses []string          `json:"loadBalancerAddresses,omitempty"`
+}
+
+func normalizeWatchedService(kind watchKind, object *unstructured.Unstructured) (interface{}, []InventoryCondition, error) {
+	var service corev1.Service
+	if err := decodeInto(object.Object, &service); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse Service %s: %v", object.GetName(), err)
+	}
+	result := WatchedService{
+		Kind:      kind.Kind,
+		Name:      service.Name,
+		Namespace: service.Namespace,
+		Type:      string(service.Spec.Type),
+		ClusterIP: service.Spec.ClusterIP,
+		Selector:  service.Spec.Selector,
+	}
+	for _, port := range service.Spec.Ports {
+		result.Ports = append(result.Ports, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+	}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			result.LoadBalancerAddresses = append(result.LoadBalancerAddresses, ingress.IP)
+		} else if ingress.Hostname != "" {
+			result.LoadBalancerAddresses = append(result.LoadBalancerAddresses, ingress.Hostname)
+		}
+	}
+	return result, nil, nil
+}
+
+// WatchedEndpointSlice counts the endpoints of a Service that can and cannot take traffic
+type WatchedEndpointSlice struct {
+	Kind        string   `json:"kind"`
+	Name        string   `json:"name"`
+	Namespace   string   `json:"namespace"`
+	Service     string   `json:"service,omitempty"`
+	AddressType string   `json:"addressType"`
+	Ready       int      `json:"ready"`
+	NotReady    int      `json:"notReady"`
+	Ports       []string `json:"ports,omitempty"`
+}
+
+func normalizeWatchedEndpointSlice(kind watchKind, object *unstructured.Unstructured) (interface{}, []InventoryCondition, error) {
+	var slice discoveryv1.EndpointSlice
+	if err := decodeInto(object.Object, &slice); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse EndpointSlice %s: %v", object.GetName(), err)
+	}
+	result := WatchedEndpointSlice{
+		Kind:        kind.Kind,
+		Name:        slice.Name,
+		Namespace:   slice.Namespace,
+		Service:     slice.Labels[discoveryv1.LabelServiceName],
+		AddressType: string(slice.AddressType),
+	}
+	for _, endpoint := range slice.Endpoints {
+		// A nil ready condition means ready, as the API documents
+		if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+			result.Ready++
+		} else {
+			result.NotReady++
+		}
+	}
+	for _, port := range slice.Ports {
+		if port.Port != nil && port.Protocol != nil {
+			result.Ports = append(result.Ports, fmt.Sprintf("%d/%s", *port.Port, *port.Protocol))
+		}
+	}
+	return result, nil, nil
+}
+
+// WatchEvent is the data of an "added", "modified" or "deleted" event
+type WatchEvent struct {
+	Type            string                `json:"type"`
+	Kind            string                `json:"kind"`
+	Namespace       string                `json:"namespace,omitempty"`
+	Name            string                `json:"name"`
+	ResourceVersion string                `json:"resourceVersion"`
+	Object          interface{}           `json:"object"`
+	Transitions     []ConditionTransition `json:"transitions,omitempty"`
+}
+
+// ConditionTransition is a condition whose status changed in a "modified" event
+type ConditionTransition struct {
+	Parent  string `json:"parent,omitempty"`
+	Type    string `json:"type"`
+	From    string `json:"from,omitempty"` // empty when the condition is new
+	To      string `json:"to"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// WatchSnapshot is the data of a "snapshot" event: every object of a kind, sent when the
+// stream starts without a bookmark for the kind and whenever the kind has to be listed
+// again. It replaces what the client knows about the kind.
+type WatchSnapshot struct {
+	Kind            string        `json:"kind"`
+	ResourceVersion string        `json:"resourceVersion"`
+	Items           []interface{} `json:"items"`
+}
+
+// WatchBookmark is the data of a "bookmark" event, which only moves the stream's id on
+type WatchBookmark struct {
+	Kind            string `json:"kind"`
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// WatchError is the data of an "error" event. The kind is retried unless it is not
+// installed in the cluster.
+type WatchError struct {
+	Kind  string `json:"kind,omitempty"`
+	Error string `json:"error"`
+}
+
+// watchBookmarks maps each kind to the resourceVersion the client has seen up to. It is
+// the id of every event, so an EventSource resumes from it after a reconnect.
+type watchBookmarks map[string]string
+
+func (b watchBookmarks) encode() string {
+	data, _ := json.Marshal(b)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeWatchBookmarks(id string) (watchBookmarks, error) {
+	bookmarks := watchBookmarks{}
+	if id == "" {
+		return bookmarks, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(id)
+	if err == nil {
+		err = json.Unmarshal(data, &bookmarks)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid watch bookmark: %v", err)
+	}
+	return bookmarks, nil
+}
+
+// watchUpdate is an event from one kind's watcher, with the resourceVersion it brings the
+// kind up to
+type watchUpdate struct {
+	kind            string
+	resourceVersion string
+	event           sseEvent
+}
+
+// kindWatcher follows one kind: it lists it when there is no resourceVersion to resume
+// from, then watches, and lists again when the resourceVersion expires
+type kindWatcher struct {
+	kube            KubeClient
+	kind            watchKind
+	namespace       string
+	labelSelector   string
+	resourceVersion string
+	conditions      map[string][]InventoryCondition // by namespace/name, for transitions
+	updates         chan<- watchUpdate
+}
+
+func (w *kindWatcher) send(ctx context.Context, resourceVersion string, event sseEvent) bool {
+	select {
+	case w.updates <- watchUpdate{kind: w.kind.Name, resourceVersion: resourceVersion, event: event}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (w *kindWatcher) sendError(ctx context.Context, err error) {
+	w.send(ctx, "", sseEvent{name: "error", data: WatchError{Kind: w.kind.Name, Error: err.Error()}})
+}
+
+func (w *kindWatcher) run(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		var err error
+		if w.resourceVersion == "" {
+			err = w.snapshot(ctx)
+		}
+		if err == nil {
+			err = w.watch(ctx)
+		}
+
+		switch {
+		case err == nil:
+			// The API server closes watches after a while; pick up where it left off
+			backoff = time.Second
+			continue
+		case errors.Is(err, errWatchExpired):
+			w.resourceVersion = ""
+			continue
+		case ctx.Err() != nil:
+			return
+		case kubeErrorReason(err) == KubeErrorUnknownResource:
+			w.sendError(ctx, fmt.Errorf("%s is not installed in the cluster", w.kind.Kind))
+			return
+		}
+
+		w.sendError(ctx, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
+		}
+	}
+}
+
+func (w *kindWatcher) namespaceFor() string {
+	if w.kind.Namespaced {
+		return w.namespace
+	}
+	return ""
+}
+
+func (w *kindWatcher) snapshot(ctx context.Context) error {
+	objects, resourceVersion, err := w.kube.ListWithVersion(ctx, w.kind.Resource, w.namespaceFor(), metav1.ListOptions{LabelSelector: w.labelSelector})
+	if err != nil {
+		return err
+	}
+
+	snapshot := WatchSnapshot{Kind: w.kind.Name, ResourceVersion: resourceVersion, Items: make([]interface{}, 0, len(objects))}
+	w.conditions = make(map[string][]InventoryCondition, len(objects))
+	for i := range objects {
+		item, conditions, err := w.kind.normalize(w.kind, &objects[i])
+		if err != nil {
+			return err
+		}
+		snapshot.Items = append(snapshot.Items, item)
+		w.conditions[objects[i].GetNamespace()+"/"+objects[i].GetName()] = conditions
+	}
+	w.resourceVersion = resourceVersion
+	w.send(ctx, resourceVersion, sseEvent{name: "snapshot", data: snapshot})
+	return nil
+}
+
+func (w *kindWatcher) watch(ctx context.Context) error {
+	watcher, err := w.kube.Watch(ctx, w.kind.Resource, w.namespaceFor(), metav1.ListOptions{
+		LabelSelector:       w.labelSelector,
+		ResourceVersion:     w.resourceVersion,
+		AllowWatchBookmarks: true,
+	})
+	if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+		return errWatchExpired
+	}
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return nil
+			}
+			if err := w.handle(ctx, event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *kindWatcher) handle(ctx context.Context, event watch.Event) error {
+	if event.Type == watch.Error {
+		err := apierrors.FromObject(event.Object)
+		if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+			return errWatchExpired
+		}
+		return err
+	}
+	object, ok := event.Object.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unexpected %T in %s watch", event.Object, w.kind.Name)
+	}
+	w.resourceVersion = object.GetResourceVersion()
+	if event.Type == watch.Bookmark {
+		w.send(ctx, w.resourceVersion, sseEvent{name: "bookmark", data: WatchBookmark{Kind: w.kind.Name, ResourceVersion: w.resourceVersion}})
+		return nil
+	}
+
+	item, conditions, err := w.kind.normalize(w.kind, object)
+	if err != nil {
+		return err
+	}
+	change := WatchEvent{
+		Type:            strings.ToLower(string(event.Type)),
+		Kind:            w.kind.Name,
+		Namespace:       object.GetNamespace(),
+		Name:            object.GetName(),
+		ResourceVersion: w.resourceVersion,
+		Object:          item,
+	}
+	key := object.GetNamespace() + "/" + object.GetName()
+	switch event.Type {
+	case watch.Modified:
+		// Without a previous state, e.g. right after resuming, there is nothing to compare
+		if previous, ok := w.conditions[key]; ok {
+			change.Transitions = conditionTransitions(previous, conditions)
+		}
+		w.conditions[key] = conditions
+	case watch.Added:
+		w.conditions[key] = conditions
+	case watch.Deleted:
+		delete(w.conditions, key)
+	}
+	w.send(ctx, w.resourceVersion, sseEvent{name: change.Type, data: change})
+	return nil
+}
+
+// conditionTransitions reports the conditions that are new or changed status
+func conditionTransitions(previous, current []InventoryCondition) []ConditionTransition {
+	before := make(map[string]string, len(previous))
+	for _, condition := range previous {
+		before[condition.Parent+"\x00"+condition.Type] = condition.Status
+	}
+	var transitions []ConditionTransition
+	for _, condition := range current {
+		from := before[condition.Parent+"\x00"+condition.Type]
+		if from == condition.Status {
+			continue
+		}
+		transitions = append(transitions, ConditionTransition{
+			Parent:  condition.Parent,
+			Type:    condition.Type,
+			From:    from,
+			To:      condition.Status,
+			Reason:  condition.Reason,
+			Message: condition.Message,
+		})
+	}
+	return transitions
+}
+
+// handleWatch streams changes to Gateway API and Envoy Gateway resources, and on request
+// Services and EndpointSlices, as Server-Sent Events, one stream for all kinds. Query
+// parameters: kinds (comma-separated, default every inventory kind; "services" and
+// "endpointslices" must be named), namespace (default all) and labelSelector.
+//
+// Each kind starts with a "snapshot" event, followed by "added", "modified" and
+// "deleted" events; "modified" carries the conditions whose status changed. Every event's
+// id records how far each kind has been seen, so a reconnecting EventSource (through
+// Last-Event-ID) or a client passing the last id as "since" resumes without a snapshot,
+// unless the API server no longer has that history.
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	selected := defaultWatchKinds()
+	if names := query.Get("kinds"); names != "" {
+		selected = nil
+		for _, name := range strings.Split(names, ",") {
+			kind, ok := lookupWatchKind(strings.TrimSpace(name))
+			if !ok {
+				s.sendError(w, fmt.Sprintf("Unknown watch kind %q", name), http.StatusBadRequest)
+				return
+			}
+			selected = append(selected, kind)
+		}
+	}
+	labelSelector := query.Get("labelSelector")
+	if labelSelector != "" {
+		if _, err := labels.Parse(labelSelector); err != nil {
+			s.sendError(w, fmt.Sprintf("Invalid labelSelector: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	since := r.Header.Get("Last-Event-ID")
+	if since == "" {
+		since = query.Get("since")
+	}
+	bookmarks, err := decodeWatchBookmarks(since)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	kube, err := s.kubeClient(r.Context())
+	if err != nil {
+		s.sendError(w, fmt.Sprintf("Kubeconfig setup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	stream, err := newSSEStream(w)
+	if err != nil {
+		s.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	updates := make(chan watchUpdate, 64)
+	for _, kind := range selected {
+		watcher := &kindWatcher{
+			kube:            kube,
+			kind:            kind,
+			namespace:       query.Get("namespace"),
+			labelSelector:   labelSelector,
+			resourceVersion: bookmarks[kind.Name],
+			conditions:      make(map[string][]InventoryCondition),
+			updates:         updates,
+		}
+		go watcher.run(ctx)
+	}
+
+	// Stamp every event with the bookmarks as of that event
+	events := make(chan sseEvent, 64)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case update := <-updates:
+				if update.resourceVersion != "" {
+					bookmarks[update.kind] = update.resourceVersion
+				}
+				update.event.id = bookmarks.encode()
+				select {
+				case events <- update.event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	stream.relay(ctx, events)
+}
+
+func lookupWatchKind(name string) (watchKind, bool) {
+	name = strings.ToLower(name)
+	for _, kind := range append(defaultWatchKinds(), backendWatchKinds...) {
+		if name == kind.Name || name == strings.ToLower(kind.Kind) {
+			return kind, true
+		}
+	}
+	return watchKind{}, false
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConditionTransitions(t *testing.T) {
+	previous := []InventoryCondition{
+		{Type: "Accepted", Status: "True"},
+		{Type: "Programmed", Status: "False", Reason: "Pending"},
+		{Parent: "default/eg", Type: "ResolvedRefs", Status: "True"},
+	}
+	current := []InventoryCondition{
+		{Type: "Accepted", Status: "True"},
+		{Type: "Programmed", Status: "True", Reason: "Programmed", Message: "Address assigned"},
+		{Parent: "default/eg", Type: "ResolvedRefs", Status: "False", Reason: "BackendNotFound"},
+		{Parent: "default/other", Type: "ResolvedRefs", Status: "True"},
+	}
+
+	want := []ConditionTransition{
+		{Type: "Programmed", From: "False", To: "True", Reason: "Programmed", Message: "Address assigned"},
+		{Parent: "default/eg", Type: "ResolvedRefs", From: "True", To: "False", Reason: "BackendNotFound"},
+		{Parent: "default/other", Type: "ResolvedRefs", To: "True"},
+	}
+	if got := conditionTransitions(previous, current); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if got := conditionTransitions(current, current); got != nil {
+		t.Errorf("unchanged conditions reported transitions: %+v", got)
+	}
+}
+
+func TestWatchBookmarks(t *testing.T) {
+	bookmarks := watchBookmarks{"gateways": "1200", "httproutes": "1185"}
+	decoded, err := decodeWatchBookmarks(bookmarks.encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, bookmarks) {
+		t.Errorf("round trip = %v, want %v", decoded, bookmarks)
+	}
+
+	empty, err := decodeWatchBookmarks("")
+	if err != nil || empty == nil || len(empty) != 0 {
+		t.Errorf("empty id = %v, %v; want an empty map", empty, err)
+	}
+
+	for _, id := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, err := decodeWatchBookmarks(id); err == nil {
+			t.Errorf("%q: expected an error", id)
+		}
+	}
+}
+
+func TestWatchKinds(t *testing.T) {
+	for _, kind := range defaultWatchKinds() {
+		if kind.Name == "services" || kind.Name == "endpointslices" {
+			t.Errorf("%s is watched by default", kind.Name)
+		}
+	}
+	for _, name := range []string{"services", "Service", "endpointslices", "gateways", "HTTPRoute"} {
+		if _, ok := lookupWatchKind(name); !ok {
+			t.Errorf("lookupWatchKind(%q) found nothing", name)
+		}
+	}
+	if _, ok := lookupWatchKind("pods"); ok {
+		t.Error("lookupWatchKind(\"pods\") found a kind")
+	}
+}